@@ -11,8 +11,10 @@ import (
 	"os"
 	"path/filepath"
 
+	"github.com/bouncepaw/mycorrhiza/history"
 	"github.com/bouncepaw/mycorrhiza/internal/cfg"
 	"github.com/bouncepaw/mycorrhiza/internal/files"
+	"github.com/bouncepaw/mycorrhiza/internal/hyphae"
 	"github.com/bouncepaw/mycorrhiza/internal/user"
 	"github.com/bouncepaw/mycorrhiza/internal/version"
 
@@ -21,6 +23,10 @@ import (
 
 // CLI options are read and parsed here.
 
+// checkLinksFlag tells to check links instead of running the wiki. The check
+// needs the hyphae to be indexed, so it is run by main.
+var checkLinksFlag bool
+
 // printHelp prints the help message.
 func printHelp() {
 	_, _ = fmt.Fprintf(
@@ -38,6 +44,7 @@ func parseCliArgs() error {
 
 	flag.StringVar(&cfg.ListenAddr, "listen-addr", "", "Address to listen on. For example, 127.0.0.1:1737 or /run/mycorrhiza.sock.")
 	flag.StringVar(&createAdminName, "create-admin", "", "Create a new admin. The password will be prompted in the terminal.")
+	flag.BoolVar(&checkLinksFlag, "check-links", false, "Print broken links in all hyphae and exit. The exit status is 1 if there are any.")
 	flag.BoolVar(&versionFlag, "version", false, "Print version information and exit.")
 	flag.Usage = printHelp
 	flag.Parse()
@@ -92,6 +99,20 @@ func createAdminCommand(name string) error {
 	return nil
 }
 
+// checkLinksCommand prints broken links and returns the exit status.
+func checkLinksCommand() int {
+	problems := hyphae.LintLinks(history.FileReader())
+	for _, problem := range problems {
+		fmt.Println(problem)
+	}
+	if len(problems) > 0 {
+		slog.Error("Found broken links", "count", len(problems))
+		return 1
+	}
+	slog.Info("Found no broken links")
+	return 0
+}
+
 func askPass(prompt string) (string, error) {
 	var password []byte
 	var err error
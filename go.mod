@@ -6,16 +6,22 @@ require (
 	git.sr.ht/~bouncepaw/mycomarkup/v5 v5.6.0
 	github.com/SiverPineValley/parseduration v0.0.0-20240823050328-d9b7165d7d3a
 	github.com/c2h5oh/datasize v0.0.0-20231215233829-aa82cc1e6500
+	github.com/fxamacker/cbor/v2 v2.9.0
 	github.com/go-ini/ini v1.67.0
+	github.com/go-ldap/ldap/v3 v3.4.8
 	github.com/gorilla/feeds v1.2.0
 	github.com/gorilla/mux v1.8.1
 	golang.org/x/crypto v0.31.0
 	golang.org/x/term v0.27.0
 	golang.org/x/text v0.21.0
+	rsc.io/qr v0.2.0
 )
 
 require (
-	github.com/stretchr/testify v1.8.1 // indirect
+	github.com/Azure/go-ntlmssp v0.0.0-20221128193559-754e69321358 // indirect
+	github.com/go-asn1-ber/asn1-ber v1.5.5 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	github.com/x448/float16 v0.8.4 // indirect
 	golang.org/x/sys v0.28.0 // indirect
 )
 
@@ -36,13 +36,23 @@ var (
 {{define "rename"}}Переименовывание{{end}}
 {{define "special pages"}}Специальные страницы{{end}}
 {{define "recent_changes"}}Свежие правки{{end}}
+{{define "history"}}История{{end}}
 {{define "feeds"}}Ленты{{end}}
 {{define "orphans"}}Гифы-сироты{{end}}
+{{define "wanted"}}Желаемые гифы{{end}}
+{{define "deleted"}}Удалённые гифы{{end}}
+{{define "search"}}Поиск{{end}}
+{{define "stats"}}Статистика{{end}}
 {{define "configuration"}}Конфигурация (для администраторов){{end}}
 {{define "config_file"}}Файл конфигурации{{end}}
 {{define "lock"}}Замок{{end}}
 {{define "whitelist"}}Белый список{{end}}
 {{define "telegram"}}Вход через Телеграм{{end}}
+{{define "oidc"}}Вход через OpenID Connect{{end}}
+{{define "ldap"}}Вход через LDAP{{end}}
+{{define "proxy auth"}}Вход через обратный прокси{{end}}
+{{define "totp"}}Двухфакторная аутентификация{{end}}
+{{define "passkeys"}}Ключи доступа{{end}}
 {{define "interwiki"}}Интервики{{end}}
 {{define "file structure"}}Файловая структура{{end}}
 `
@@ -0,0 +1,108 @@
+package history
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/bouncepaw/mycorrhiza/util"
+)
+
+// BlameLine is a line of a hypha text.
+type BlameLine struct {
+	Number int
+	Text   string
+}
+
+// BlameRun is a group of consecutive lines last changed by the same
+// revision. The revision is nil for lines that are not committed yet.
+type BlameRun struct {
+	Revision *Revision
+	Lines    []BlameLine
+}
+
+// blameParser parses the output of git blame --porcelain. Details of a commit
+// are only given the first time the commit is met.
+type blameParser struct {
+	runs    []BlameRun
+	commits map[string]*Revision
+	curr    *Revision
+	number  int
+}
+
+func (p *blameParser) parse(line []byte) (bool, error) {
+	switch {
+	case len(line) > 0 && line[0] == '\t':
+		p.appendLine(string(line[1:]))
+	case p.curr == nil || p.number == 0:
+		return p.parseHeader(line)
+	default:
+		p.parseField(line)
+	}
+	return true, nil
+}
+
+// parseHeader parses the line starting a group: the commit hash, the line
+// number in the original file, the line number in the final file and
+// optionally the number of lines in the group.
+func (p *blameParser) parseHeader(line []byte) (bool, error) {
+	fields := strings.Fields(string(line))
+	if len(fields) < 3 || !util.IsRevHash(fields[0]) {
+		return false, fmt.Errorf("failed to parse git blame output: %q", line)
+	}
+	number, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return false, fmt.Errorf("failed to parse git blame line number: %q", line)
+	}
+	rev, ok := p.commits[fields[0]]
+	if !ok {
+		rev = &Revision{Hash: fields[0]}
+		p.commits[fields[0]] = rev
+	}
+	p.curr, p.number = rev, number
+	return true, nil
+}
+
+func (p *blameParser) parseField(line []byte) {
+	key, value, _ := bytes.Cut(line, []byte{' '})
+	switch string(key) {
+	case "author-mail":
+		mail := strings.Trim(string(value), "<>")
+		p.curr.Username, _, _ = strings.Cut(mail, "@")
+	case "author-time":
+		if tm := unixTimestampAsTime(string(value)); tm != nil {
+			p.curr.Time = *tm
+		}
+	case "summary":
+		p.curr.Message = string(value)
+	}
+}
+
+func (p *blameParser) appendLine(text string) {
+	rev := p.curr
+	if strings.Trim(rev.Hash, "0") == "" {
+		rev = nil
+	}
+	line := BlameLine{Number: p.number, Text: text}
+	if n := len(p.runs); n > 0 && p.runs[n - 1].Revision == rev {
+		p.runs[n - 1].Lines = append(p.runs[n - 1].Lines, line)
+	} else {
+		p.runs = append(p.runs, BlameRun{Revision: rev, Lines: []BlameLine{line}})
+	}
+	p.number = 0
+}
+
+// Blame finds the revision that last changed every line of the file and
+// groups the lines by them.
+func Blame(filepath string) ([]BlameRun, error) {
+	gitMutex.RLock()
+	defer gitMutex.RUnlock()
+
+	parser := blameParser{commits: make(map[string]*Revision)}
+	args := []string{"blame", "--porcelain", "--", util.ShorterPath(filepath)}
+	if err := gitPipe(args, parser.parse); err != nil {
+		return nil, err
+	}
+	return parser.runs, nil
+}
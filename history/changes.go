@@ -0,0 +1,319 @@
+package history
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bouncepaw/mycorrhiza/internal/categories"
+	"github.com/bouncepaw/mycorrhiza/internal/cfg"
+	"github.com/bouncepaw/mycorrhiza/internal/process"
+	"github.com/bouncepaw/mycorrhiza/util"
+)
+
+// Kinds of actions revisions are made by.
+const (
+	ActionCreate   = "create"
+	ActionEdit     = "edit"
+	ActionRename   = "rename"
+	ActionDelete   = "delete"
+	ActionUpload   = "upload"
+	ActionRevert   = "revert"
+	ActionUndelete = "undelete"
+)
+
+// Actions are all kinds of actions, in the order they are shown to users.
+var Actions = []string{
+	ActionCreate, ActionEdit, ActionRename, ActionDelete, ActionUpload, ActionRevert,
+	ActionUndelete,
+}
+
+// actionPrefixes map beginnings of commit messages to actions.
+var actionPrefixes = []struct {
+	prefix string
+	action string
+}{
+	{"Create ‘", ActionCreate},
+	{"Edit ‘", ActionEdit},
+	{"Rename ‘", ActionRename},
+	{"Delete ‘", ActionDelete},
+	{"Remove media from ‘", ActionDelete},
+	{"Upload media for ‘", ActionUpload},
+	{"Revert ‘", ActionRevert},
+	{"Undelete ‘", ActionUndelete},
+}
+
+// Action tells what was done in the revision, judging by its message. It is
+// empty if the message is not made by the wiki.
+func (rev Revision) Action() string {
+	for _, p := range actionPrefixes {
+		if strings.HasPrefix(rev.Message, p.prefix) {
+			return p.action
+		}
+	}
+	return ""
+}
+
+// dateFormat is the format of dates in change filters.
+const dateFormat = "2006-01-02"
+
+// ChangeFilter narrows down the list of changes. Empty fields match all
+// changes.
+type ChangeFilter struct {
+	Username string
+	Hypha    string
+	// Prefix matches changes of the hypha and its subhyphae.
+	Prefix string
+	// Category matches changes of hyphae that are in the category now.
+	Category string
+	Action   string
+	// Since and Until are the first and the last days of changes, in UTC.
+	Since time.Time
+	Until time.Time
+}
+
+// ParseChangeFilter reads the filter from the user, hypha, prefix, category,
+// action, from and to parameters.
+func ParseChangeFilter(query url.Values) (ChangeFilter, error) {
+	var (
+		filter = ChangeFilter{
+			Username: strings.TrimSpace(query.Get("user")),
+			Hypha:    util.CanonicalName(strings.Trim(query.Get("hypha"), " /")),
+			Prefix:   util.CanonicalName(strings.Trim(query.Get("prefix"), " /")),
+			Category: util.CanonicalName(strings.TrimSpace(query.Get("category"))),
+			Action:   query.Get("action"),
+		}
+		err error
+	)
+	if filter.Action != "" && !slices.Contains(Actions, filter.Action) {
+		return ChangeFilter{}, fmt.Errorf("unknown action %s", filter.Action)
+	}
+	if from := query.Get("from"); from != "" {
+		filter.Since, err = time.Parse(dateFormat, from)
+		if err != nil {
+			return ChangeFilter{}, err
+		}
+	}
+	if to := query.Get("to"); to != "" {
+		filter.Until, err = time.Parse(dateFormat, to)
+		if err != nil {
+			return ChangeFilter{}, err
+		}
+	}
+	return filter, nil
+}
+
+// IsZero tells if the filter matches all changes.
+func (f ChangeFilter) IsZero() bool {
+	return f == ChangeFilter{}
+}
+
+// Query returns the parameters ParseChangeFilter reads the filter from.
+func (f ChangeFilter) Query() url.Values {
+	query := url.Values{}
+	set := func(key, value string) {
+		if value != "" {
+			query.Set(key, value)
+		}
+	}
+	set("user", f.Username)
+	set("hypha", f.Hypha)
+	set("prefix", f.Prefix)
+	set("category", f.Category)
+	set("action", f.Action)
+	if !f.Since.IsZero() {
+		query.Set("from", f.Since.Format(dateFormat))
+	}
+	if !f.Until.IsZero() {
+		query.Set("to", f.Until.Format(dateFormat))
+	}
+	return query
+}
+
+// SinceString and UntilString are the dates of the filter as they are
+// entered by users.
+func (f ChangeFilter) SinceString() string {
+	return f.Query().Get("from")
+}
+
+func (f ChangeFilter) UntilString() string {
+	return f.Query().Get("to")
+}
+
+// globEscaper escapes the characters allowed in hypha names that have
+// a meaning in glob pathspecs.
+var globEscaper = strings.NewReplacer("[", `\[`, "]", `\]`)
+
+// gitArgs returns git log options for the parts of the filter git can check.
+// The rest is checked by match.
+func (f ChangeFilter) gitArgs() (opts []string, paths []string) {
+	if f.Username != "" {
+		opts = append(opts, "--fixed-strings", "--author=<" + f.Username + "@mycorrhiza>")
+	}
+	if !f.Since.IsZero() {
+		opts = append(opts, "--since=" + strconv.FormatInt(f.Since.Unix(), 10))
+	}
+	if !f.Until.IsZero() {
+		until := f.Until.AddDate(0, 0, 1).Add(-time.Second)
+		opts = append(opts, "--until=" + strconv.FormatInt(until.Unix(), 10))
+	}
+	if f.Hypha != "" {
+		paths = append(paths, ":(glob)" + globEscaper.Replace(f.Hypha) + ".*")
+	}
+	if f.Prefix != "" {
+		prefix := globEscaper.Replace(f.Prefix)
+		paths = append(paths, ":(glob)" + prefix + ".*", ":(glob)" + prefix + "/**")
+	}
+	return opts, paths
+}
+
+// matcher returns a function checking the parts of the filter git cannot
+// check.
+func (f ChangeFilter) matcher() func(rev *Revision) bool {
+	var inCategory map[string]struct{}
+	if f.Category != "" {
+		inCategory = make(map[string]struct{})
+		for _, hyphaName := range categories.HyphaeInCategory(f.Category) {
+			inCategory[hyphaName] = struct{}{}
+		}
+	}
+	matchHypha := func(hyphaName string) bool {
+		if f.Hypha != "" && hyphaName != f.Hypha {
+			return false
+		}
+		if f.Prefix != "" && hyphaName != f.Prefix && !strings.HasPrefix(hyphaName, f.Prefix + "/") {
+			return false
+		}
+		if _, ok := inCategory[hyphaName]; f.Category != "" && !ok {
+			return false
+		}
+		return true
+	}
+	return func(rev *Revision) bool {
+		if f.Action != "" && rev.Action() != f.Action {
+			return false
+		}
+		if f.Hypha == "" && f.Prefix == "" && f.Category == "" {
+			return true
+		}
+		return slices.ContainsFunc(rev.hyphaeAffected(), matchHypha)
+	}
+}
+
+// changesParser parses git log output with the names of changed files.
+type changesParser struct {
+	match  func(rev *Revision) bool
+	limit  int
+	res    []Revision
+	curr   *Revision
+	stray  string
+	// last is the hash of the last revision looked at, matching or not.
+	last   string
+}
+
+func (p *changesParser) parse(line []byte) (bool, error) {
+	switch {
+	case len(line) == 0:
+	case line[0] == 0:
+		if !p.flush() {
+			return false, nil
+		}
+		rev := parseRevisionLine(line[1:])
+		rev.filesAffectedBuf = []string{}
+		p.curr = &rev
+	case p.curr == nil:
+		if p.stray == "" {
+			p.stray = string(line)
+		}
+	default:
+		p.curr.filesAffectedBuf = append(p.curr.filesAffectedBuf, string(line))
+	}
+	return true, nil
+}
+
+// flush adds the current revision if it matches. It tells if there is room
+// for more revisions.
+func (p *changesParser) flush() bool {
+	if p.curr != nil {
+		if p.match(p.curr) {
+			p.res = append(p.res, *p.curr)
+		}
+		p.last = p.curr.Hash
+	}
+	p.curr = nil
+	return len(p.res) < p.limit
+}
+
+// flushPartial adds the current revision if it matches, though not all its
+// files might be read. Otherwise it is left to be looked at again.
+func (p *changesParser) flushPartial() {
+	if p.curr != nil && p.match(p.curr) {
+		p.flush()
+	}
+}
+
+// Changes returns at most n revisions matching the filter, most recent first.
+// If after is not empty, the revisions made before the revision with that hash
+// are returned. next is the hash to pass as after to get more revisions, it is
+// empty if there are no more. If the search times out, the revisions found so
+// far are returned and complete is false. Then next is the last revision
+// looked at, if any.
+func Changes(
+	filter ChangeFilter,
+	after string,
+	n int,
+) (revs []Revision, next string, complete bool, err error) {
+	opts, paths := filter.gitArgs()
+	args := []string{
+		"log", "--abbrev-commit", "--no-merges", "--no-renames",
+		"--format=%x00%h\t%ae\t%at\t%s", "--name-only",
+	}
+	args = append(args, opts...)
+	if after == "" {
+		args = append(args, "HEAD")
+	} else {
+		// after is the last revision shown, so skip it
+		args = append(args, "--skip=1", after)
+	}
+	args = append(args, "--")
+	args = append(args, paths...)
+
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+		parser = changesParser{match: filter.matcher(), limit: n + 1}
+	)
+	if cfg.GrepTimeout > 0 && !filter.IsZero() {
+		ctx, cancel = context.WithTimeout(process.Context(), cfg.GrepTimeout)
+	} else {
+		ctx, cancel = context.WithCancel(process.Context())
+	}
+	defer cancel()
+
+	err = gitPipeContext(args, ctx, cancel, parser.parse)
+	complete = true
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		slog.Info("Timeout while looking for changes", "filter", filter)
+		parser.flushPartial()
+		next, complete = parser.last, false
+	case err != nil && strings.Contains(parser.stray, "bad revision 'HEAD'"):
+		// There are no commits yet
+		return nil, "", true, nil
+	case err != nil:
+		return nil, "", false, err
+	default:
+		parser.flush()
+	}
+	revs = parser.res
+	if len(revs) > n {
+		return revs[:n], revs[n - 1].Hash, true, nil
+	}
+	return revs, next, complete, nil
+}
@@ -0,0 +1,123 @@
+package history
+
+import (
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/bouncepaw/mycorrhiza/internal/mimetype"
+)
+
+// Deletion is a hypha whose files were removed in the revision.
+type Deletion struct {
+	Revision
+	HyphaName string
+}
+
+// deletionsParser parses git log output with the names of removed files.
+type deletionsParser struct {
+	res  []Deletion
+	curr Revision
+	seen map[string]struct{}
+}
+
+func (p *deletionsParser) parse(line []byte) (bool, error) {
+	switch {
+	case len(line) == 0:
+	case line[0] == 0:
+		p.curr = parseRevisionLine(line[1:])
+	default:
+		hyphaName, _, skip := mimetype.DataFromFilename(string(line))
+		if _, seen := p.seen[hyphaName]; !skip && !seen {
+			p.seen[hyphaName] = struct{}{}
+			p.res = append(p.res, Deletion{p.curr, hyphaName})
+		}
+	}
+	return true, nil
+}
+
+// Deletions returns the last removal of every hypha that was ever removed,
+// most recent first. Renamed hyphae are not considered removed. The hyphae
+// may have been created again since.
+func Deletions() ([]Deletion, error) {
+	gitMutex.RLock()
+	defer gitMutex.RUnlock()
+
+	out, err := gitsh("rev-parse", "--verify", "--quiet", "HEAD")
+	head := strings.TrimSpace(string(out))
+	switch {
+	case err != nil && head == "":
+		// There are no commits yet
+		return nil, nil
+	case err != nil:
+		return nil, err
+	}
+
+	parser := deletionsParser{seen: make(map[string]struct{})}
+	args := []string{
+		"log", "--abbrev-commit", "--no-merges", "--find-renames",
+		"--diff-filter=D", "--format=%x00%h\t%ae\t%at\t%s", "--name-only",
+		head, "--",
+	}
+	if err := gitPipe(args, parser.parse); err != nil {
+		return nil, err
+	}
+	return parser.res, nil
+}
+
+// DeletedFiles returns the paths of the files removed in the revision,
+// relative to the repository. Renamed files are not considered removed. It
+// does not lock the repository, so call it during an operation.
+func DeletedFiles(revHash string) ([]string, error) {
+	out, err := gitsh(
+		"show", "--find-renames", "--diff-filter=D", "--format=", "--name-only",
+		revHash, "--",
+	)
+	if err != nil {
+		return nil, err
+	}
+	var res []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if line != "" {
+			res = append(res, line)
+		}
+	}
+	return res, nil
+}
+
+// categoriesNotePrefix begins the lines of deletion commit messages that
+// record the categories the hyphae were in.
+const categoriesNotePrefix = "Categories of "
+
+// CategoriesNote returns the commit message lines recording the categories
+// of the hyphae, which are lost when the hyphae are deleted.
+func CategoriesNote(categoriesByHypha map[string][]string) []string {
+	var lines []string
+	for _, hyphaName := range slices.Sorted(maps.Keys(categoriesByHypha)) {
+		if cats := categoriesByHypha[hyphaName]; len(cats) > 0 {
+			lines = append(lines, categoriesNotePrefix + hyphaName + ": " + strings.Join(cats, " "))
+		}
+	}
+	return lines
+}
+
+// NotedCategories reads the categories recorded by CategoriesNote in the
+// message of the revision. It does not lock the repository, so call it during
+// an operation.
+func NotedCategories(revHash string) (map[string][]string, error) {
+	out, err := gitsh("show", "--no-patch", "--format=%b", revHash, "--")
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[string][]string)
+	for _, line := range strings.Split(string(out), "\n") {
+		note, ok := strings.CutPrefix(line, categoriesNotePrefix)
+		if !ok {
+			continue
+		}
+		if hyphaName, cats, found := strings.Cut(note, ": "); found {
+			res[hyphaName] = strings.Fields(cats)
+		}
+	}
+	return res, nil
+}
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/bouncepaw/mycorrhiza/internal/cfg"
+	"github.com/bouncepaw/mycorrhiza/util"
 
 	"github.com/gorilla/feeds"
 )
@@ -17,11 +18,15 @@ const changeGroupMaxSize = 30
 func recentChangesFeed(opts FeedOptions) *feeds.Feed {
 	feed := &feeds.Feed{
 		Title:       cfg.WikiName + " (recent changes)",
-		Link:        &feeds.Link{Href: cfg.URL},
+		Link:        &feeds.Link{Href: cfg.URL + opts.link},
 		Description: fmt.Sprintf("List of %d recent changes on the wiki", changeGroupMaxSize),
 		Updated:     time.Now(),
 	}
-	revs := newRecentChangesStream()
+	if opts.subject != "" {
+		feed.Title = fmt.Sprintf("%s (%s)", cfg.WikiName, opts.subject)
+		feed.Description = fmt.Sprintf("List of %d recent changes on the wiki: %s", changeGroupMaxSize, opts.subject)
+	}
+	revs := newRecentChangesStream(opts.filter)
 	groups := groupRevisions(revs, opts)
 	for _, grp := range groups {
 		item := grp.feedItem(opts)
@@ -178,14 +183,54 @@ type feedOptionParserState struct {
 // feedGrouping represents a set of conditions that must all be satisfied for revisions to be grouped.
 // If there are no conditions, revisions will never be grouped.
 type FeedOptions struct {
-	conds []groupingCondition
-	order feedGroupOrder
+	conds  []groupingCondition
+	order  feedGroupOrder
+	filter ChangeFilter
+	// subject tells what the changes in the feed are about if they are not
+	// all changes. link is the address of the page about them.
+	subject string
+	link    string
+}
+
+// ForHypha narrows the feed down to the history of the hypha and, if asked,
+// its subhyphae.
+func (opts FeedOptions) ForHypha(hyphaName string, subhyphae bool) FeedOptions {
+	if subhyphae {
+		opts.filter.Hypha, opts.filter.Prefix = "", hyphaName
+		opts.subject = "history of " + util.BeautifulName(hyphaName) + " and its subhyphae"
+	} else {
+		opts.filter.Hypha, opts.filter.Prefix = hyphaName, ""
+		opts.subject = "history of " + util.BeautifulName(hyphaName)
+	}
+	opts.link = "/history/" + hyphaName
+	return opts
+}
+
+// ForCategory narrows the feed down to the changes of hyphae in the category.
+func (opts FeedOptions) ForCategory(catName string) FeedOptions {
+	opts.filter.Category = catName
+	opts.subject = "category " + util.BeautifulName(catName)
+	opts.link = "/category/" + catName
+	return opts
+}
+
+// ForUser narrows the feed down to the changes made by the user.
+func (opts FeedOptions) ForUser(username string) FeedOptions {
+	opts.filter.Username = username
+	opts.subject = "contributions of " + username
+	opts.link = "/contributions/" + username
+	return opts
 }
 
 func ParseFeedOptions(query url.Values) (FeedOptions, error) {
 	parser := feedOptionParserState{}
 
-	err := parser.parseFeedGroupingPeriod(query)
+	filter, err := ParseChangeFilter(query)
+	if err != nil {
+		return FeedOptions{}, err
+	}
+
+	err = parser.parseFeedGroupingPeriod(query)
 	if err != nil {
 		return FeedOptions{}, err
 	}
@@ -205,7 +250,7 @@ func ParseFeedOptions(query url.Values) (FeedOptions, error) {
 		// if no options are applied, do no grouping instead of using the default options
 		conds = nil
 	}
-	return FeedOptions{conds: conds, order: parser.order}, nil
+	return FeedOptions{conds: conds, order: parser.order, filter: filter}, nil
 }
 
 func (parser *feedOptionParserState) parseFeedGroupingPeriod(query url.Values) error {
@@ -0,0 +1,98 @@
+package histweb
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/bouncepaw/mycorrhiza/history"
+	"github.com/bouncepaw/mycorrhiza/internal/cfg"
+	"github.com/bouncepaw/mycorrhiza/util"
+
+	"github.com/gorilla/mux"
+)
+
+// feedFormat is a format the feeds are available in.
+type feedFormat struct {
+	suffix      string
+	name        string
+	contentType string
+	feed        func(history.FeedOptions) (string, error)
+}
+
+var feedFormats = []feedFormat{
+	{"rss", "RSS", "application/rss+xml", history.RecentChangesRSS},
+	{"atom", "Atom", "application/atom+xml", history.RecentChangesAtom},
+	{"json", "JSON feed", "application/feed+json", history.RecentChangesJSON},
+}
+
+// feedSubject is a part of the wiki there are feeds of changes about.
+type feedSubject struct {
+	// action is the beginning of the feed addresses, like history for
+	// /history-rss/<hypha>.
+	action string
+	// narrow narrows the feed down to the subject named in the address.
+	narrow func(opts history.FeedOptions, name string, rq *http.Request) history.FeedOptions
+}
+
+var feedSubjects = []feedSubject{
+	{"history", func(opts history.FeedOptions, name string, rq *http.Request) history.FeedOptions {
+		return opts.ForHypha(name, rq.URL.Query().Get("subhyphae") != "")
+	}},
+	{"category", func(opts history.FeedOptions, name string, rq *http.Request) history.FeedOptions {
+		return opts.ForCategory(name)
+	}},
+	{"contributions", func(opts history.FeedOptions, name string, rq *http.Request) history.FeedOptions {
+		return opts.ForUser(name)
+	}},
+}
+
+func initFeedHandlers(rtr *mux.Router) {
+	for _, subject := range feedSubjects {
+		for _, format := range feedFormats {
+			rtr.PathPrefix("/" + subject.action + "-" + format.suffix + "/").
+				HandlerFunc(subject.handler(format)).
+				Methods("GET")
+		}
+	}
+}
+
+// handler returns the handler of the feeds about the subject in the format.
+func (subject feedSubject) handler(format feedFormat) http.HandlerFunc {
+	prefix := subject.action + "-" + format.suffix
+	return func(w http.ResponseWriter, rq *http.Request) {
+		name := strings.Trim(strings.TrimPrefix(rq.URL.Path, cfg.Root + prefix), "/")
+		if name == "" {
+			http.Error(w, "404 not found", http.StatusNotFound)
+			return
+		}
+		name = util.CanonicalName(name)
+		feed := func(opts history.FeedOptions) (string, error) {
+			return format.feed(subject.narrow(opts, name, rq))
+		}
+		genericHandlerOfFeeds(w, rq, feed, format.name, format.contentType)
+	}
+}
+
+// FeedLinks returns the <link rel="alternate"> elements of the feeds about
+// the subject with the given name. The action is history, category or
+// contributions, query is added to the addresses if not empty.
+func FeedLinks(action, name, title string, query url.Values) []template.HTML {
+	var links []template.HTML
+	for _, format := range feedFormats {
+		addr := fmt.Sprintf("%s%s-%s/%s", cfg.Root, action, format.suffix, name)
+		if len(query) > 0 {
+			addr += "?" + query.Encode()
+		}
+		links = append(links, template.HTML(fmt.Sprintf(
+			`<link rel="alternate" type="%s" title="%s (%s)" href="%s">`,
+			format.contentType,
+			template.HTMLEscapeString(title),
+			format.name,
+			template.HTMLEscapeString(addr),
+		)))
+	}
+	return links
+}
@@ -3,6 +3,7 @@ package histweb
 
 import (
 	"embed"
+	"errors"
 	"fmt"
 	"html/template"
 	"log/slog"
@@ -12,7 +13,9 @@ import (
 
 	"github.com/bouncepaw/mycorrhiza/history"
 	"github.com/bouncepaw/mycorrhiza/internal/cfg"
+	"github.com/bouncepaw/mycorrhiza/internal/diff"
 	"github.com/bouncepaw/mycorrhiza/internal/hyphae"
+	"github.com/bouncepaw/mycorrhiza/internal/search"
 	"github.com/bouncepaw/mycorrhiza/util"
 	"github.com/bouncepaw/mycorrhiza/web/viewutil"
 
@@ -21,18 +24,27 @@ import (
 
 func InitHandlers(rtr *mux.Router) {
 	rtr.PathPrefix("/primitive-diff/").HandlerFunc(handlerPrimitiveDiff).Methods("GET")
+	rtr.PathPrefix("/diff/").HandlerFunc(handlerDiff).Methods("GET")
 	rtr.HandleFunc("/recent-changes/{count:[0-9]+}", handlerRecentChanges).Methods("GET")
 	rtr.HandleFunc("/recent-changes/", func(w http.ResponseWriter, rq *http.Request) {
 		http.Redirect(w, rq, cfg.Root + "recent-changes/20", http.StatusSeeOther)
 	}).Methods("GET")
 	rtr.PathPrefix("/history/").HandlerFunc(handlerHistory).Methods("GET")
+	rtr.PathPrefix("/blame/").HandlerFunc(handlerBlame).Methods("GET")
+	rtr.PathPrefix("/contributions/").HandlerFunc(handlerContributions).Methods("GET")
+	rtr.HandleFunc("/history-search/", handlerHistorySearch).Methods("GET")
 	rtr.HandleFunc("/recent-changes-rss", handlerRecentChangesRSS).Methods("GET")
 	rtr.HandleFunc("/recent-changes-atom", handlerRecentChangesAtom).Methods("GET")
 	rtr.HandleFunc("/recent-changes-json", handlerRecentChangesJSON).Methods("GET")
+	initFeedHandlers(rtr)
 
 	chainPrimitiveDiff = viewutil.CopyEnRuWith(fs, "view_primitive_diff.html", ruTranslation)
+	chainDiff = viewutil.CopyEnRuWith(fs, "view_diff.html", ruTranslation)
 	chainRecentChanges = viewutil.CopyEnRuWith(fs, "view_recent_changes.html", ruTranslation)
 	chainHistory = viewutil.CopyEnRuWith(fs, "view_history.html", ruTranslation)
+	chainHistorySearch = viewutil.CopyEnRuWith(fs, "view_history_search.html", ruTranslation)
+	chainBlame = viewutil.CopyEnRuWith(fs, "view_blame.html", ruTranslation)
+	chainContributions = viewutil.CopyEnRuWith(fs, "view_contributions.html", ruTranslation)
 }
 
 func handlerPrimitiveDiff(w http.ResponseWriter, rq *http.Request) {
@@ -51,7 +63,61 @@ func handlerPrimitiveDiff(w http.ResponseWriter, rq *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	primitiveDiff(viewutil.MetaFrom(w, rq), h, revHash, text)
+	parent, err := history.ParentRevision(revHash)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	primitiveDiff(viewutil.MetaFrom(w, rq), h, revHash, parent, text)
+}
+
+// handlerDiff compares the hypha text at two revisions. The revision picker
+// of the history page sends them as form values, so they are redirected to
+// the canonical address.
+//
+// /diff/<from>..<to>/<hyphaName>
+func handlerDiff(w http.ResponseWriter, rq *http.Request) {
+	var (
+		shorterURL            = strings.TrimPrefix(rq.URL.Path, cfg.Root + "diff/")
+		revRange, slug, found = strings.Cut(shorterURL, "/")
+		from, to, isRange     = strings.Cut(revRange, "..")
+		mode                  = diffMode(rq)
+	)
+	if !found || !isRange || !util.IsRevHash(from) || !util.IsRevHash(to) || len(slug) < 1 {
+		hyphaName := util.CanonicalName(shorterURL)
+		from, to = rq.FormValue("from"), rq.FormValue("to")
+		if hyphaName == "" || !util.IsRevHash(from) || !util.IsRevHash(to) {
+			http.Error(w, "400 bad request", http.StatusBadRequest)
+			return
+		}
+		http.Redirect(w, rq, diffAddr(from, to, hyphaName, mode), http.StatusSeeOther)
+		return
+	}
+	hyphaName := util.CanonicalName(slug)
+	oldText, err := history.TextAtRevision(hyphaName, from)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	newText, err := history.TextAtRevision(hyphaName, to)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	data := diffData{
+		BaseData:  &viewutil.BaseData{},
+		HyphaName: hyphaName,
+		From:      from,
+		To:        to,
+		Mode:      mode,
+	}
+	switch {
+	case mode != diffRendered:
+		data.Hunks = diff.Lines(oldText, newText, diffContext)
+	case oldText != newText:
+		data.Rendered = template.HTML(visualDiff(hyphaName, oldText, newText))
+	}
+	viewutil.ExecutePage(viewutil.MetaFrom(w, rq), chainDiff, data)
 }
 
 // handlerRecentChanges displays the /recent-changes/ page.
@@ -62,7 +128,22 @@ func handlerRecentChanges(w http.ResponseWriter, rq *http.Request) {
 		http.Error(w, "400 bad request", http.StatusBadRequest)
 		return
 	}
-	recentChanges(viewutil.MetaFrom(w, rq), editCount, history.RecentChanges(editCount))
+	filter, err := history.ParseChangeFilter(rq.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	after := rq.URL.Query().Get("after")
+	if after != "" && !util.IsRevHash(after) {
+		http.Error(w, "400 bad request", http.StatusBadRequest)
+		return
+	}
+	changes, next, complete, err := history.Changes(filter, after, editCount)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	recentChanges(viewutil.MetaFrom(w, rq), editCount, filter, after, next, complete, changes)
 }
 
 // handlerHistory lists all revisions of a hypha.
@@ -79,7 +160,73 @@ func handlerHistory(w http.ResponseWriter, rq *http.Request) {
 	// TODO: extra log, not needed?
 	slog.Info("Found revisions", "hyphaName", hyphaName, "n", len(revs), "err", err)
 
-	historyView(viewutil.MetaFrom(w, rq), hyphaName, list)
+	historyView(viewutil.MetaFrom(w, rq), hyphaName, list, len(revs) > 1)
+}
+
+// handlerBlame shows who last changed every line of the hypha text.
+func handlerBlame(w http.ResponseWriter, rq *http.Request) {
+	var (
+		hyphaName = util.HyphaNameFromRq(rq, "blame")
+		h         = hyphae.ByName(hyphaName)
+	)
+	if !h.HasTextFile() {
+		http.Error(w, "404 hypha has no text", http.StatusNotFound)
+		return
+	}
+	runs, err := history.Blame(h.TextFilePath())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	blameView(viewutil.MetaFrom(w, rq), hyphaName, runs)
+}
+
+// handlerContributions lists the revisions made by a user.
+func handlerContributions(w http.ResponseWriter, rq *http.Request) {
+	username := strings.Trim(strings.TrimPrefix(rq.URL.Path, cfg.Root + "contributions/"), "/")
+	if username == "" {
+		http.Error(w, "404 not found", http.StatusNotFound)
+		return
+	}
+	page := 1
+	if s := rq.URL.Query().Get("page"); s != "" {
+		var err error
+		page, err = strconv.Atoi(s)
+		if err != nil || page < 1 {
+			http.Error(w, "400 bad request", http.StatusBadRequest)
+			return
+		}
+	}
+	revs, more, err := history.Contributions(username, (page - 1) * contributionsPerPage, contributionsPerPage)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	contributions(viewutil.MetaFrom(w, rq), username, page, more, revs)
+}
+
+// handlerHistorySearch finds revisions that added or removed a string.
+func handlerHistorySearch(w http.ResponseWriter, rq *http.Request) {
+	var (
+		meta      = viewutil.MetaFrom(w, rq)
+		query     = rq.FormValue("q")
+		hyphaName = util.CanonicalName(strings.TrimSpace(rq.FormValue("hypha")))
+		regex     = rq.FormValue("regex") != ""
+		results   *history.HistorySearchResults
+		err       error
+	)
+	if query != "" {
+		results, err = history.SearchHistory(query, regex, hyphaName, historySearchLimit)
+	}
+	switch {
+	case errors.Is(err, search.ErrQuerySyntax):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	historySearch(meta, query, hyphaName, regex, results)
 }
 
 // genericHandlerOfFeeds is a helper function for the web feed handlers.
@@ -124,42 +271,158 @@ var (
 {{define "diff for at heading"}}Разница для <a href="{{.Meta.Root}}hypha/{{.HyphaName}}">{{beautifulName .HyphaName}}</a> для {{.Hash}}{{end}}
 {{define "no text diff available"}}Нет текстовой разницы.{{end}}
 
+{{define "diff of title"}}Разница для {{beautifulName .HyphaName}} между {{.From}} и {{.To}}{{end}}
+{{define "diff of heading"}}Разница для <a class="wikilink" href="{{.Meta.Root}}hypha/{{.HyphaName}}">{{beautifulName .HyphaName}}</a> между <a class="wikilink" href="{{.Meta.Root}}rev/{{.From}}/{{.HyphaName}}">{{.From}}</a> и <a class="wikilink" href="{{.Meta.Root}}rev/{{.To}}/{{.HyphaName}}">{{.To}}</a>{{end}}
+{{define "diff inline"}}Построчно{{end}}
+{{define "diff side by side"}}Рядом{{end}}
+{{define "diff rendered"}}Как на странице{{end}}
+{{define "diff mode"}}Показать{{end}}
+{{define "compare with parent"}}Сравнить с предыдущей правкой:{{end}}
+{{define "diff swap"}}Поменять местами{{end}}
+{{define "diff history"}}История{{end}}
+{{define "diff no changes"}}Тексты совпадают.{{end}}
+{{define "history subscribe via"}}Подписаться на историю через <a class="wikilink" href="{{.Meta.Root}}history-rss/{{.HyphaName}}">RSS</a>, <a class="wikilink" href="{{.Meta.Root}}history-atom/{{.HyphaName}}">Atom</a> или <a class="wikilink" href="{{.Meta.Root}}history-json/{{.HyphaName}}">JSON-ленту</a>.{{end}}
+{{define "compare revisions"}}Сравнить выбранные правки{{end}}
+
 {{define "count pre"}}Отобразить{{end}}
 {{define "count post"}}свежих правок.{{end}}
-{{define "subscribe via"}}Подписаться через <a href="{{.Meta.Root}}recent-changes-rss">RSS</a>, <a href="{{.Meta.Root}}recent-changes-atom">Atom</a> или <a href="{{.Meta.Root}}recent-changes-json">JSON-ленту</a>.{{end}}
+{{define "subscribe via"}}Подписаться через <a href="{{.Meta.Root}}recent-changes-rss{{.FeedQuery}}">RSS</a>, <a href="{{.Meta.Root}}recent-changes-atom{{.FeedQuery}}">Atom</a> или <a href="{{.Meta.Root}}recent-changes-json{{.FeedQuery}}">JSON-ленту</a>.{{end}}
+{{define "filter changes"}}Отбор правок{{end}}
+{{define "filter user"}}Участник{{end}}
+{{define "filter prefix"}}Гифа и подгифы{{end}}
+{{define "filter category"}}Категория{{end}}
+{{define "filter action"}}Действие{{end}}
+{{define "filter any action"}}Любое{{end}}
+{{define "action name"}}
+{{- if eq . "create"}}Создание
+{{- else if eq . "edit"}}Правка
+{{- else if eq . "rename"}}Переименование
+{{- else if eq . "delete"}}Удаление
+{{- else if eq . "upload"}}Загрузка медиа
+{{- else if eq . "revert"}}Откат
+{{- else if eq . "undelete"}}Восстановление
+{{- end}}
+{{- end}}
+{{define "filter from"}}С{{end}}
+{{define "filter to"}}По{{end}}
+{{define "filter submit"}}Показать{{end}}
+{{define "filter reset"}}Сбросить{{end}}
+{{define "newest changes"}}Самые свежие правки{{end}}
+{{define "older changes"}}Более ранние правки{{end}}
 {{define "recent changes"}}Свежие правки{{end}}
 {{define "n recent changes"}}{{.}} свеж{{if eq . 1}}ая правка{{else if le . 4}}их правок{{else}}их правок{{end}}{{end}}
 {{define "recent empty"}}Правки не найдены.{{end}}
+{{define "recent not complete"}}Поиск правок занял слишком много времени, поэтому показаны не все из них.{{end}}
+
+{{define "blame of title"}}Авторство «{{beautifulName .}}»{{end}}
+{{define "blame of heading"}}Авторство <a class="wikilink" href="{{.Meta.Root}}hypha/{{.HyphaName}}">{{beautifulName .HyphaName}}</a>{{end}}
+{{define "blame tip"}}Для каждой строки текста показана правка, которая изменила её последней.{{end}}
+{{define "blame diff"}}разница{{end}}
+{{define "blame not committed"}}Ещё не сохранено{{end}}
+{{define "blame empty"}}Текст пуст.{{end}}
+
+{{define "contributions of title"}}Вклад {{.}}{{end}}
+{{define "contributions of heading"}}Вклад <a class="wikilink" href="{{.Meta.Root}}hypha/{{.UserHypha}}/{{.Username}}">{{.Username}}</a>{{end}}
+{{define "contributions empty"}}Правки не найдены.{{end}}
+{{define "newer contributions"}}Более новые правки{{end}}
+{{define "older contributions"}}Более ранние правки{{end}}
+{{define "contributions subscribe via"}}Подписаться на вклад через <a class="wikilink" href="{{.Meta.Root}}contributions-rss/{{.Username}}">RSS</a>, <a class="wikilink" href="{{.Meta.Root}}contributions-atom/{{.Username}}">Atom</a> или <a class="wikilink" href="{{.Meta.Root}}contributions-json/{{.Username}}">JSON-ленту</a>.{{end}}
+
+{{define "history search"}}Поиск по истории{{end}}
+{{define "history search for"}}Поиск по истории: {{.}}{{end}}
+{{define "history search query"}}Текст{{end}}
+{{define "history search hypha"}}Гифа{{end}}
+{{define "history search all hyphae"}}Все гифы{{end}}
+{{define "history search regex"}}Регулярное выражение{{end}}
+{{define "history search submit"}}Найти{{end}}
+{{define "history search no results"}}Правки не найдены.{{end}}
+{{define "history search not complete"}}Показаны не все правки.{{end}}
+{{define "search history of"}}Искать в истории{{end}}
 `
 	chainPrimitiveDiff, chainRecentChanges, chainHistory viewutil.Chain
+	chainHistorySearch, chainDiff, chainBlame            viewutil.Chain
+	chainContributions                                   viewutil.Chain
 )
 
+// diffContext is the number of unchanged lines shown around changes.
+const diffContext = 3
+
+// contributionsPerPage is the number of revisions on a page of contributions.
+const contributionsPerPage = 50
+
+// historySearchLimit is the maximum number of history search matches shown.
+const historySearchLimit = 100
+
 type recentChangesData struct {
 	*viewutil.BaseData
 	EditCount int
 	Changes   []history.Revision
 	UserHypha string
 	Stops     []int
+	Filter    history.ChangeFilter
+	Actions   []string
+	// After is the hash of the revision the page starts after, Next is the
+	// hash the next page starts after. They are empty for the first and the
+	// last page.
+	After string
+	Next  string
+	// Complete is false if looking for changes timed out.
+	Complete bool
 }
 
-func recentChanges(meta viewutil.Meta, editCount int, changes []history.Revision) {
+func recentChanges(
+	meta viewutil.Meta,
+	editCount int,
+	filter history.ChangeFilter,
+	after, next string,
+	complete bool,
+	changes []history.Revision,
+) {
 	viewutil.ExecutePage(meta, chainRecentChanges, recentChangesData{
 		BaseData:  &viewutil.BaseData{},
 		EditCount: editCount,
 		Changes:   changes,
 		UserHypha: cfg.UserHypha,
 		Stops:     []int{20, 50, 100},
+		Filter:    filter,
+		Actions:   history.Actions,
+		After:     after,
+		Next:      next,
+		Complete:  complete,
 	})
 }
 
+// PageAddr returns the address of the page of count changes starting after
+// the given revision, keeping the filter.
+func (data recentChangesData) PageAddr(count int, after string) string {
+	query := data.Filter.Query()
+	if after != "" {
+		query.Set("after", after)
+	}
+	addr := fmt.Sprintf("%srecent-changes/%d", cfg.Root, count)
+	if len(query) > 0 {
+		addr += "?" + query.Encode()
+	}
+	return addr
+}
+
+// FeedQuery is the query string passing the filter to the feeds.
+func (data recentChangesData) FeedQuery() string {
+	if data.Filter.IsZero() {
+		return ""
+	}
+	return "?" + data.Filter.Query().Encode()
+}
+
 type primitiveDiffData struct {
 	*viewutil.BaseData
 	HyphaName string
 	Hash      string
+	Parent    string
 	Text      template.HTML
 }
 
-func primitiveDiff(meta viewutil.Meta, h hyphae.Hypha, hash, text string) {
+func primitiveDiff(meta viewutil.Meta, h hyphae.Hypha, hash, parent, text string) {
 	hunks := history.SplitPrimitiveDiff(text)
 	if len(hunks) > 0 {
 		var buf strings.Builder
@@ -198,22 +461,148 @@ func primitiveDiff(meta viewutil.Meta, h hyphae.Hypha, hash, text string) {
 		BaseData:  &viewutil.BaseData{},
 		HyphaName: h.CanonicalName(),
 		Hash:      hash,
+		Parent:    parent,
 		Text:      template.HTML(text),
 	})
 }
 
-type historyData struct {
+// Modes of the diff page.
+const (
+	diffInline   = "inline"
+	diffSplit    = "split"
+	diffRendered = "rendered"
+)
+
+func diffMode(rq *http.Request) string {
+	switch mode := rq.FormValue("mode"); mode {
+	case diffSplit, diffRendered:
+		return mode
+	default:
+		return diffInline
+	}
+}
+
+// diffAddr is the address of the diff page in the given mode.
+func diffAddr(from, to, hyphaName, mode string) string {
+	addr := cfg.Root + "diff/" + from + ".." + to + "/" + hyphaName
+	if mode != diffInline {
+		addr += "?mode=" + mode
+	}
+	return addr
+}
+
+type diffData struct {
 	*viewutil.BaseData
 	HyphaName string
-	Contents  template.HTML
+	From      string
+	To        string
+	Mode      string
+	Hunks     []diff.Hunk
+	// Rendered is the visual diff. It is empty if the texts are the same.
+	Rendered template.HTML
+}
+
+// ModeAddr is the address of the same diff in another mode.
+func (d diffData) ModeAddr(mode string) string {
+	return diffAddr(d.From, d.To, d.HyphaName, mode)
+}
+
+// SwapAddr is the address of the reverse diff.
+func (d diffData) SwapAddr() string {
+	return diffAddr(d.To, d.From, d.HyphaName, d.Mode)
+}
+
+type historyData struct {
+	*viewutil.BaseData
+	HyphaName  string
+	Contents   template.HTML
+	Comparable bool
 }
 
-func historyView(meta viewutil.Meta, hyphaName, contents string) {
+func historyView(meta viewutil.Meta, hyphaName, contents string, canCompare bool) {
+	meta.HeadElements = FeedLinks("history", hyphaName, "History of " + util.BeautifulName(hyphaName), nil)
 	viewutil.ExecutePage(meta, chainHistory, historyData{
 		BaseData: &viewutil.BaseData{
 			Addr: cfg.Root + "history/" + util.CanonicalName(hyphaName),
 		},
+		HyphaName:  hyphaName,
+		Contents:   template.HTML(contents),
+		Comparable: canCompare,
+	})
+}
+
+type blameData struct {
+	*viewutil.BaseData
+	HyphaName string
+	Runs      []history.BlameRun
+	UserHypha string
+}
+
+func blameView(meta viewutil.Meta, hyphaName string, runs []history.BlameRun) {
+	viewutil.ExecutePage(meta, chainBlame, blameData{
+		BaseData:  &viewutil.BaseData{},
+		HyphaName: hyphaName,
+		Runs:      runs,
+		UserHypha: cfg.UserHypha,
+	})
+}
+
+type historySearchData struct {
+	*viewutil.BaseData
+	Query     string
+	HyphaName string
+	Regex     bool
+	Results   *history.HistorySearchResults
+	UserHypha string
+}
+
+func historySearch(
+	meta viewutil.Meta,
+	query, hyphaName string,
+	regex bool,
+	results *history.HistorySearchResults,
+) {
+	viewutil.ExecutePage(meta, chainHistorySearch, historySearchData{
+		BaseData:  &viewutil.BaseData{},
+		Query:     query,
 		HyphaName: hyphaName,
-		Contents:  template.HTML(contents),
+		Regex:     regex,
+		Results:   results,
+		UserHypha: cfg.UserHypha,
 	})
 }
+
+type contributionsData struct {
+	*viewutil.BaseData
+	Username  string
+	UserHypha string
+	Page      int
+	More      bool
+	Changes   []history.Revision
+}
+
+func contributions(meta viewutil.Meta, username string, page int, more bool, changes []history.Revision) {
+	meta.HeadElements = FeedLinks("contributions", username, "Contributions of " + username, nil)
+	viewutil.ExecutePage(meta, chainContributions, contributionsData{
+		BaseData:  &viewutil.BaseData{},
+		Username:  username,
+		UserHypha: cfg.UserHypha,
+		Page:      page,
+		More:      more,
+		Changes:   changes,
+	})
+}
+
+// PrevPage is the number of the page of newer revisions.
+func (data contributionsData) PrevPage() int {
+	return data.Page - 1
+}
+
+// PageAddr returns the address of the page with the given number.
+func (data contributionsData) PageAddr(page int) string {
+	addr := cfg.Root + "contributions/" + data.Username
+	if page > 1 {
+		addr += "?page=" + strconv.Itoa(page)
+	}
+	return addr
+}
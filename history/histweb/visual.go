@@ -0,0 +1,193 @@
+package histweb
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/bouncepaw/mycorrhiza/internal/diff"
+	"github.com/bouncepaw/mycorrhiza/mycoopts"
+
+	"git.sr.ht/~bouncepaw/mycomarkup/v5"
+	"git.sr.ht/~bouncepaw/mycomarkup/v5/genhtml"
+	"git.sr.ht/~bouncepaw/mycomarkup/v5/mycocontext"
+)
+
+// maxBlockPairings is the maximum number of block pairs compared to find
+// edited blocks among changed ones.
+const maxBlockPairings = 400
+
+// htmlTokenPattern matches HTML tags and character references, which are
+// never split.
+var htmlTokenPattern = regexp.MustCompile(`<[^>]*>|&#?[a-zA-Z0-9]+;`)
+
+// renderBlocks renders every top-level block of the Mycomarkup text.
+func renderBlocks(hyphaName, text string) []string {
+	ctx, _ := mycocontext.ContextFromStringInput(text, mycoopts.MarkupOptions(hyphaName))
+	var res []string
+	for _, block := range mycomarkup.BlockTree(ctx) {
+		res = append(res, genhtml.BlockToTag(ctx, block).String())
+	}
+	return res
+}
+
+// visualDiff renders both texts and marks the blocks that were deleted,
+// inserted or edited. Edited blocks are shown as they are in the new text,
+// with the changed words marked.
+func visualDiff(hyphaName, oldText, newText string) string {
+	var (
+		a, b = renderBlocks(hyphaName, oldText), renderBlocks(hyphaName, newText)
+		i, j int
+		buf  strings.Builder
+	)
+	buf.WriteString(`<article class="mycomarkup-doc visual-diff">`)
+	edits := diff.Diff(a, b)
+	for k := 0; k < len(edits); {
+		if edits[k].Op == diff.OpEqual {
+			for _, block := range b[j:j + edits[k].Len] {
+				buf.WriteString(block)
+			}
+			i, j = i + edits[k].Len, j + edits[k].Len
+			k++
+			continue
+		}
+		var deleted, inserted []string
+		for ; k < len(edits) && edits[k].Op != diff.OpEqual; k++ {
+			if edits[k].Op == diff.OpDelete {
+				deleted = append(deleted, a[i:i + edits[k].Len]...)
+				i += edits[k].Len
+			} else {
+				inserted = append(inserted, b[j:j + edits[k].Len]...)
+				j += edits[k].Len
+			}
+		}
+		writeChangedBlocks(&buf, deleted, inserted)
+	}
+	buf.WriteString(`</article>`)
+	return buf.String()
+}
+
+// writeChangedBlocks pairs deleted blocks with similar inserted blocks and
+// writes them in the order of the new text.
+func writeChangedBlocks(buf *strings.Builder, deleted, inserted []string) {
+	next := 0
+	for _, block := range deleted {
+		paired := false
+		for l := next; l < len(inserted) && len(deleted) * len(inserted) <= maxBlockPairings; l++ {
+			merged, similar := mergeBlocks(block, inserted[l])
+			if !similar {
+				continue
+			}
+			for _, ins := range inserted[next:l] {
+				writeBlock(buf, "insert", ins)
+			}
+			writeBlock(buf, "edit", merged)
+			next, paired = l + 1, true
+			break
+		}
+		if !paired {
+			writeBlock(buf, "delete", block)
+		}
+	}
+	for _, ins := range inserted[next:] {
+		writeBlock(buf, "insert", ins)
+	}
+}
+
+func writeBlock(buf *strings.Builder, kind, block string) {
+	buf.WriteString(`<div class="visual-diff__block visual-diff__block_`)
+	buf.WriteString(kind)
+	buf.WriteString(`">`)
+	buf.WriteString(block)
+	buf.WriteString(`</div>`)
+}
+
+// tokenizeHTML splits the HTML into tags, character references and words.
+func tokenizeHTML(html string) []string {
+	var (
+		tokens []string
+		last   = 0
+	)
+	for _, loc := range htmlTokenPattern.FindAllStringIndex(html, -1) {
+		tokens = append(tokens, diff.Tokenize(html[last:loc[0]])...)
+		tokens = append(tokens, html[loc[0]:loc[1]])
+		last = loc[1]
+	}
+	return append(tokens, diff.Tokenize(html[last:])...)
+}
+
+func isTag(token string) bool {
+	return strings.HasPrefix(token, "<")
+}
+
+// textLength is the length of the text of the tokens, without tags.
+func textLength(tokens []string) int {
+	n := 0
+	for _, token := range tokens {
+		switch {
+		case isTag(token):
+		case strings.HasPrefix(token, "&"):
+			n++
+		default:
+			n += utf8.RuneCountInString(token)
+		}
+	}
+	return n
+}
+
+// mergeBlocks marks the words of the old block that were deleted and the
+// words of the new block that were inserted. The tags of the new block are
+// kept, the deleted tags are dropped. The blocks are similar if at least a
+// third of the text of the longer one is kept.
+func mergeBlocks(oldBlock, newBlock string) (string, bool) {
+	var (
+		a, b   = tokenizeHTML(oldBlock), tokenizeHTML(newBlock)
+		common = 0
+		i, j   int
+		buf    strings.Builder
+	)
+	for _, e := range diff.Diff(a, b) {
+		switch e.Op {
+		case diff.OpEqual:
+			common += textLength(a[i:i + e.Len])
+			buf.WriteString(strings.Join(b[j:j + e.Len], ""))
+			i, j = i + e.Len, j + e.Len
+		case diff.OpDelete:
+			writeMarked(&buf, "del", a[i:i + e.Len], false)
+			i += e.Len
+		case diff.OpInsert:
+			writeMarked(&buf, "ins", b[j:j + e.Len], true)
+			j += e.Len
+		}
+	}
+	if common * 3 < max(textLength(a), textLength(b)) {
+		return "", false
+	}
+	return buf.String(), true
+}
+
+// writeMarked wraps runs of text in the element. Tags are written as they are
+// if keepTags is true, otherwise they are dropped.
+func writeMarked(buf *strings.Builder, element string, tokens []string, keepTags bool) {
+	open := false
+	for _, token := range tokens {
+		if isTag(token) {
+			if open {
+				buf.WriteString("</" + element + ">")
+				open = false
+			}
+			if keepTags {
+				buf.WriteString(token)
+			}
+			continue
+		}
+		if !open {
+			buf.WriteString("<" + element + ">")
+			open = true
+		}
+		buf.WriteString(token)
+	}
+	if open {
+		buf.WriteString("</" + element + ">")
+	}
+}
@@ -30,6 +30,7 @@ type ReadOp struct {
 // Op is an object representing a history operation.
 type Op struct {
 	userMsg      string
+	details      []string
 	name         string
 	email        string
 	filesChanged bool
@@ -175,12 +176,16 @@ func (hop *Op) Apply() *Op {
 		return hop
 	}
 	if hop.filesChanged {
-		hop.gitop(
+		args := []string{
 			"commit",
 			"--author", fmt.Sprintf("%s<%s>", hop.name, hop.email),
 			"-m", hop.userMsg,
 			"--no-gpg-sign",
-		)
+		}
+		if len(hop.details) > 0 {
+			args = append(args, "-m", strings.Join(hop.details, "\n"))
+		}
+		hop.gitop(args...)
 	}
 	if hop.HasError() {
 		return hop.Abort()
@@ -215,6 +220,13 @@ func (hop *Op) WithMsg(userMsg string) *Op {
 	return hop
 }
 
+// WithDetails adds lines to the commit message after the first line. They are
+// not shown in history, but can be read back by the wiki later.
+func (hop *Op) WithDetails(lines ...string) *Op {
+	hop.details = append(hop.details, lines...)
+	return hop
+}
+
 // WithUser sets a user for the commit.
 func (hop *Op) WithUser(u *user.User) *Op {
 	hop.name = u.Name()
@@ -0,0 +1,198 @@
+package history
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+
+	"github.com/bouncepaw/mycorrhiza/internal/cfg"
+	"github.com/bouncepaw/mycorrhiza/internal/mimetype"
+	"github.com/bouncepaw/mycorrhiza/internal/process"
+	"github.com/bouncepaw/mycorrhiza/internal/search"
+)
+
+// HistoryMatch is a change of a hypha text in a revision that added or
+// removed the searched string.
+type HistoryMatch struct {
+	Revision
+	Hypha string
+	// Added and Removed are the changed lines containing the string, split
+	// into parts like in search results.
+	Added   []search.SearchResultLine
+	Removed []search.SearchResultLine
+}
+
+// HistorySearchResults are history search matches, most recent first.
+type HistorySearchResults struct {
+	Matches  []*HistoryMatch
+	Complete bool
+}
+
+// historySearchParser parses git log output with patches into matches.
+type historySearchParser struct {
+	res     *HistorySearchResults
+	pattern *regexp.Regexp
+	limit   int
+	rev     *Revision
+	match   *HistoryMatch
+	inHunk  bool
+}
+
+func (p *historySearchParser) parse(line []byte) (bool, error) {
+	switch {
+	case len(line) > 0 && line[0] == 0:
+		p.finishMatch()
+		if p.limitReached() {
+			return false, nil
+		}
+		rev := parseRevisionLine(line[1:])
+		p.rev, p.inHunk = &rev, false
+	case bytes.HasPrefix(line, []byte("diff --git ")):
+		p.finishMatch()
+		p.inHunk = false
+	case !p.inHunk:
+		p.parseHeader(line)
+	case p.match != nil && len(line) > 0 && (line[0] == '+' || line[0] == '-'):
+		p.parseChange(line)
+	}
+	return true, nil
+}
+
+// finishMatch forgets the current match if none of its changed lines matches
+// the pattern. git finds changes with its own regular expression engine, but
+// the pattern decides what is shown, so that all results have matched lines.
+func (p *historySearchParser) finishMatch() {
+	if p.match != nil && len(p.match.Added) == 0 && len(p.match.Removed) == 0 {
+		p.res.Matches = p.res.Matches[:len(p.res.Matches) - 1]
+	}
+	p.match = nil
+}
+
+// limitReached tells if there is no room for matches of another revision.
+func (p *historySearchParser) limitReached() bool {
+	if p.limit >= 0 && len(p.res.Matches) >= p.limit {
+		p.res.Complete = false
+		return true
+	}
+	return false
+}
+
+func (p *historySearchParser) parseHeader(line []byte) {
+	switch {
+	case bytes.HasPrefix(line, []byte("@@")):
+		p.inHunk = true
+	case bytes.HasPrefix(line, []byte("--- ")), bytes.HasPrefix(line, []byte("+++ ")):
+		fname := string(line[4:])
+		if p.match != nil || p.rev == nil || fname == "/dev/null" {
+			return
+		}
+		hyphaName, isText, skip := mimetype.DataFromFilename(fname)
+		if skip || !isText {
+			return
+		}
+		p.match = &HistoryMatch{Revision: *p.rev, Hypha: hyphaName}
+		p.res.Matches = append(p.res.Matches, p.match)
+	}
+}
+
+func (p *historySearchParser) parseChange(line []byte) {
+	parts := search.MatchLine(string(line[1:]), p.pattern)
+	if parts == nil {
+		return
+	}
+	lines := &p.match.Added
+	if line[0] == '-' {
+		lines = &p.match.Removed
+	}
+	limit := cfg.GrepMatchLimitPerHypha
+	if limit == 0 || uint(len(*lines)) < limit {
+		*lines = append(*lines, search.NewSearchResultLine(parts, cfg.FullTextLineLength))
+	}
+}
+
+// SearchHistory finds revisions that added or removed the query in hypha
+// texts, ignoring case. If regex is true, the query is an extended regular
+// expression matched against changed lines, otherwise the number of
+// occurrences of the literal string must change. If hyphaName is not empty,
+// only that hypha is searched. At most limit matches are returned, all of
+// them if limit is negative.
+func SearchHistory(
+	query string,
+	regex bool,
+	hyphaName string,
+	limit int,
+) (*HistorySearchResults, error) {
+	res := &HistorySearchResults{Complete: true}
+	if limit == 0 || query == "" {
+		return res, nil
+	}
+	var (
+		pattern *regexp.Regexp
+		err     error
+		ctx     context.Context
+		cancel  context.CancelFunc
+	)
+	if regex {
+		if cfg.GrepRegex == cfg.RegexDisabled {
+			return nil, fmt.Errorf("%w: regular expressions are disabled", search.ErrQuerySyntax)
+		}
+		// git log -G always uses POSIX extended regular expressions
+		err = search.ValidateRegex(query, false, cfg.GrepRegexComplexity)
+		if err != nil {
+			return nil, err
+		}
+	}
+	pattern, err = search.Options{Regex: regex}.Pattern(query)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.GrepProcessLimit > 0 {
+		if !grepCountInc() {
+			return nil, ErrGrepLimit
+		}
+		defer grepCountDec()
+	}
+
+	path := "*.myco"
+	if hyphaName != "" {
+		path = ":(literal)" + hyphaName + ".myco"
+	}
+	args := []string{
+		"log", "--abbrev-commit", "--no-merges", "--no-color",
+		"--format=%x00%h\t%ae\t%at\t%s",
+		"--patch", "--unified=0", "--no-prefix", "--no-renames",
+		"--regexp-ignore-case",
+	}
+	if regex {
+		args = append(args, "-G", query)
+	} else {
+		args = append(args, "-S", query)
+	}
+	args = append(args, "HEAD", "--", ":!.*", path)
+	if cfg.GrepTimeout > 0 {
+		ctx, cancel = context.WithTimeout(process.Context(), cfg.GrepTimeout)
+	} else {
+		ctx, cancel = context.WithCancel(process.Context())
+	}
+	defer cancel()
+
+	gitMutex.RLock()
+	defer gitMutex.RUnlock()
+
+	parser := historySearchParser{res: res, pattern: pattern, limit: limit}
+	err = gitPipeContext(args, ctx, cancel, parser.parse)
+	parser.finishMatch()
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		slog.Info("History search timeout", "query", query)
+		res.Complete = false
+		err = nil
+	case err != nil:
+		slog.Error("History search failed", "query", query, "err", err)
+		res.Complete = false
+	}
+	return res, err
+}
@@ -3,6 +3,7 @@ package history
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"html"
 	"html/template"
@@ -19,6 +20,7 @@ import (
 
 	"github.com/bouncepaw/mycorrhiza/internal/cfg"
 	"github.com/bouncepaw/mycorrhiza/internal/mimetype"
+	"github.com/bouncepaw/mycorrhiza/internal/process"
 	"github.com/bouncepaw/mycorrhiza/util"
 )
 
@@ -41,8 +43,12 @@ func WithRevisions(hyphaName string, revs []Revision) string {
 		))
 
 		for _, rev := range grp {
+			buf.WriteString(`<li class="history__entry">`)
+			if len(revs) > 1 {
+				buf.WriteString(revisionPicker(rev.Hash, revs[1].Hash, revs[0].Hash))
+			}
 			buf.WriteString(fmt.Sprintf(
-				`<li class="history__entry">
+				`
 	<a class="wikilink history-entry" href="%srev/%s/%s">
 		<time class="history-entry__time">%s</time>
 	</a>
@@ -70,6 +76,25 @@ func WithRevisions(hyphaName string, revs []Revision) string {
 	return buf.String()
 }
 
+// revisionPicker returns radio buttons to choose the revision as the old or
+// the new one for a diff. The default choices are checked.
+func revisionPicker(hash, defaultFrom, defaultTo string) string {
+	checked := func(ok bool) string {
+		if ok {
+			return " checked"
+		}
+		return ""
+	}
+	return fmt.Sprintf(
+		`<span class="history-entry__compare">
+		<input type="radio" name="from" value="%s" aria-label="Old revision"%s>
+		<input type="radio" name="to" value="%s" aria-label="New revision"%s>
+	</span>`,
+		hash, checked(hash == defaultFrom),
+		hash, checked(hash == defaultTo),
+	)
+}
+
 // Revision represents a revision of a hypha.
 type Revision struct {
 	// Hash is usually short.
@@ -167,32 +192,29 @@ func gitLog(args ...string) ([]Revision, error) {
 
 type recentChangesStream struct {
 	currHash string
+	filter   ChangeFilter
+	done     bool
 }
 
-func newRecentChangesStream() recentChangesStream {
+func newRecentChangesStream(filter ChangeFilter) recentChangesStream {
 	// next returns the next n revisions from the stream, ordered most recent first.
 	// If there are less than n revisions remaining, it will return only those.
-	return recentChangesStream{currHash: ""}
+	return recentChangesStream{currHash: "", filter: filter}
 }
 
 func (stream *recentChangesStream) next(n int) []Revision {
-	args := []string{"--max-count=" + strconv.Itoa(n)}
-	if stream.currHash == "" {
-		args = append(args, "HEAD")
-	} else {
-		// currHash is the last revision from the last call, so skip it
-		args = append(args, "--skip=1", stream.currHash)
+	if stream.done {
+		return nil
 	}
-
-	res, err := gitLog(args...)
+	res, next, complete, err := Changes(stream.filter, stream.currHash, n)
 	if err != nil {
 		// TODO: return error
 		slog.Error("Failed to git log", "err", err)
 		return nil
 	}
-	if len(res) != 0 {
-		stream.currHash = res[len(res)-1].Hash
-	}
+	// Feeds show what was found before a timeout rather than wait for more
+	stream.currHash = next
+	stream.done = next == "" || !complete
 
 	return res
 }
@@ -216,14 +238,6 @@ func (stream recentChangesStream) iterator() func() (Revision, bool) {
 	}
 }
 
-// RecentChanges gathers an arbitrary number of latest changes in form of revisions slice, ordered most recent first.
-func RecentChanges(n int) []Revision {
-	stream := newRecentChangesStream()
-	revs := stream.next(n)
-	slog.Info("Found recent changes", "n", len(revs))
-	return revs
-}
-
 // Revisions returns slice of revisions for the given hypha name, ordered most recent first.
 func Revisions(hyphaName string) ([]Revision, error) {
 	revs, err := gitLog("--", hyphaName+".*")
@@ -231,6 +245,114 @@ func Revisions(hyphaName string) ([]Revision, error) {
 	return revs, err
 }
 
+// Contributions returns at most n revisions made by the user, most recent
+// first, skipping the first skip of them. more tells if there are more
+// revisions after them.
+func Contributions(username string, skip, n int) (revs []Revision, more bool, err error) {
+	revs, err = gitLog(
+		"--fixed-strings", "--author=<" + username + "@mycorrhiza>",
+		"--skip=" + strconv.Itoa(skip), "--max-count=" + strconv.Itoa(n + 1),
+		"HEAD",
+	)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(revs) > n {
+		return revs[:n], true, nil
+	}
+	return revs, false, nil
+}
+
+// HyphaeEditedBy returns names of hyphae the user has ever changed, including deleted ones.
+func HyphaeEditedBy(username string) ([]string, error) {
+	args := []string{
+		"log", "--no-merges", "--fixed-strings",
+		"--author=<" + username + "@mycorrhiza>",
+		"--format=", "--name-only", "HEAD", "--",
+	}
+	var (
+		res []string
+		set = make(map[string]struct{})
+	)
+	err := gitPipe(args, func(line []byte) (bool, error) {
+		if len(line) == 0 {
+			return true, nil
+		}
+		hyphaName, _, skip := mimetype.DataFromFilename(string(line))
+		if _, seen := set[hyphaName]; !skip && !seen {
+			set[hyphaName] = struct{}{}
+			res = append(res, hyphaName)
+		}
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// LastEdited finds when the hyphae were last changed, looking no further than
+// the given time. Hyphae not changed since then are not in the result. The
+// git process counts towards GrepProcessLimit and is limited by GrepTimeout.
+func LastEdited(hyphaNames []string, since time.Time) (map[string]time.Time, error) {
+	res := make(map[string]time.Time, len(hyphaNames))
+	if len(hyphaNames) == 0 {
+		return res, nil
+	}
+	if cfg.GrepProcessLimit > 0 {
+		if !grepCountInc() {
+			return res, ErrGrepLimit
+		}
+		defer grepCountDec()
+	}
+	wanted := make(map[string]struct{}, len(hyphaNames))
+	for _, name := range hyphaNames {
+		wanted[name] = struct{}{}
+	}
+	args := []string{
+		"log", "--no-merges", "--format=%x00%at", "--name-only",
+		"--since=" + strconv.FormatInt(since.Unix(), 10), "HEAD", "--",
+	}
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+		curr   time.Time
+	)
+	if cfg.GrepTimeout > 0 {
+		ctx, cancel = context.WithTimeout(process.Context(), cfg.GrepTimeout)
+	} else {
+		ctx, cancel = context.WithCancel(process.Context())
+	}
+	defer cancel()
+	err := gitPipeContext(args, ctx, cancel, func(line []byte) (bool, error) {
+		switch {
+		case len(line) == 0:
+			return true, nil
+		case line[0] == 0:
+			tm := unixTimestampAsTime(string(line[1:]))
+			if tm == nil {
+				return false, fmt.Errorf("failed to parse git log timestamp: %q", line)
+			}
+			curr = *tm
+			return true, nil
+		}
+		hyphaName, _, skip := mimetype.DataFromFilename(string(line))
+		if skip {
+			return true, nil
+		}
+		if _, ok := wanted[hyphaName]; ok {
+			delete(wanted, hyphaName)
+			res[hyphaName] = curr
+		}
+		return len(wanted) > 0, nil
+	})
+	if errors.Is(err, context.DeadlineExceeded) {
+		slog.Info("Timeout while looking for last edits", "n", len(hyphaNames))
+		err = nil
+	}
+	return res, err
+}
+
 // FileChanged tells you if the file has been changed since the last commit.
 func FileChanged(path string) bool {
 	_, err := gitsh("diff", "--exit-code", path)
@@ -459,6 +581,20 @@ func HyphaFilesAtRevision(hyphaName string, hash string) (string, string, error)
 	return text, media, err
 }
 
+// TextAtRevision returns the text of the hypha at the commit with the hash.
+// The text is empty if the hypha had no text then.
+func TextAtRevision(hyphaName string, hash string) (string, error) {
+	text, _, err := HyphaFilesAtRevision(hyphaName, hash)
+	if err != nil || text == "" {
+		return "", err
+	}
+	out, err := FileAtRevision(text, hash)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
 func OpenFileAtRevision(
 	filepath string,
 	hash string,
@@ -469,6 +605,17 @@ func OpenFileAtRevision(
 	)
 }
 
+// ParentRevision returns the short hash of the first parent of the commit with
+// the given hash. It is empty if the commit has no parents.
+func ParentRevision(hash string) (string, error) {
+	out, err := gitsh("log", "--max-count=1", "--format=%p", hash, "--")
+	if err != nil {
+		return "", err
+	}
+	parent, _, _ := strings.Cut(strings.TrimSpace(string(out)), " ")
+	return parent, nil
+}
+
 // PrimitiveDiffAtRevision generates a plain-text diff for the given filepath at the commit with the given hash. It may return an error if git fails.
 func PrimitiveDiffAtRevision(filepath, hash string) (string, error) {
 	out, err := gitsh("show", "--unified=1", "--no-color", hash, "--", filepath)
@@ -7,6 +7,7 @@ import (
 	"os/exec"
 	"regexp"
 	"strconv"
+	"strings"
 	"sync/atomic"
 
 	"github.com/bouncepaw/mycorrhiza/internal/cfg"
@@ -23,29 +24,44 @@ var (
 	color = regexp.MustCompile(`\033\[[0-9]*(;[0-9]+)?m`)
 )
 
-func gitgrep(query string, parse func([]byte) (bool, error)) error {
+func gitgrep(
+	query string,
+	opts search.Options,
+	matchLimit int,
+	parse func([]byte) (bool, error),
+) error {
 	var (
-		limit string
 		path string
 		ctx context.Context
 		cancel context.CancelFunc
 	)
-	if cfg.GrepMatchLimitPerHypha > 0 {
-		limit = strconv.FormatUint(uint64(cfg.GrepMatchLimitPerHypha), 10)
-	} else {
-		limit = "-1"
-	}
 	if cfg.GrepIgnoreMedia {
 		path = "*.myco"
 	} else {
 		path = "*"
 	}
-	args := []string{
-		"grep", "-i", "-I", "-F", "--color",
-		"-m", limit,
-		"-e", query,
-		"--", ":!.*", path,
+	args := []string{"grep", "-I"}
+	switch {
+	case matchLimit == 0:
+		args = append(args, "-l")
+	default:
+		args = append(args, "--color", "-n", "-m", strconv.Itoa(matchLimit))
+		if cfg.FullTextContextLines > 0 {
+			args = append(args, "-C", strconv.FormatUint(uint64(cfg.FullTextContextLines), 10))
+		}
+	}
+	if !opts.CaseSensitive {
+		args = append(args, "-i")
+	}
+	switch {
+	case !opts.Regex:
+		args = append(args, "-F")
+	case opts.Perl:
+		args = append(args, "-P")
+	default:
+		args = append(args, "-E")
 	}
+	args = append(args, "-e", query, "--", ":!.*", path)
 	if cfg.GrepTimeout > 0 {
 		ctx, cancel = context.WithTimeout(process.Context(), cfg.GrepTimeout)
 	} else {
@@ -82,25 +98,60 @@ func grepExitError(err error) bool {
 	return true
 }
 
-func grepParse(line []byte, res *search.SearchResults) error {
+// grepParseName parses a line of grep output with file names only.
+func grepParseName(line []byte, res *search.SearchResults) {
+	hyphaName, _, skip := mimetype.DataFromFilename(string(line))
+	if len(line) > 0 && !skip {
+		res.Append(hyphaName, nil, 0, 0, 0)
+	}
+}
+
+// grepParse parses a line of grep output. Matched lines look like
+// file:number:text and context lines look like file-number-text, with every
+// part colored. Groups of lines are separated with --.
+func grepParse(line []byte, res *search.SearchResults, matchLimit int) error {
 	if len(line) == 0 {
 		return nil
 	}
 	parts := color.Split(string(line), -1)
-	if len(parts) < 5 || parts[0] != "" || parts[2] != "" || parts[3] != ":" {
+	if len(parts) == 3 && parts[0] == "" && parts[1] == "--" {
+		return nil
+	}
+	if (len(parts) < 9 ||
+		parts[0] != "" || parts[2] != "" || parts[4] != "" || parts[6] != "" ||
+		parts[3] != parts[7] || (parts[3] != ":" && parts[3] != "-")) {
 		slog.Error("Failed to parse grep output", "line", line, "parts", parts)
 		return ErrGrepParse
 	}
 	fname := parts[1]
-	parts = parts[4:]
+	number, err := strconv.Atoi(parts[5])
+	if err != nil {
+		slog.Error("Failed to parse grep line number", "line", line, "err", err)
+		return ErrGrepParse
+	}
+	context := parts[3] == "-"
+	parts = parts[8:]
 	hyphaName, _, skip := mimetype.DataFromFilename(fname)
-	if !skip {
-		res.Append(hyphaName, parts, cfg.FullTextLineLength, cfg.GrepMatchLimitPerHypha)
+	switch {
+	case skip:
+	case context:
+		res.AppendContext(hyphaName, strings.Join(parts, ""), number, cfg.FullTextLineLength)
+	default:
+		res.Append(hyphaName, parts, number, cfg.FullTextLineLength, uint(max(matchLimit, 0)))
 	}
 	return nil
 }
 
-func Grep(query string, limit int) (*search.SearchResults, error) {
+// Grep finds hyphae whose files contain the query. The regular expression
+// must be validated before. At most matchLimit matched lines are read per
+// hypha, all of them if it is negative. If it is zero, only hypha names are
+// found.
+func Grep(
+	query string,
+	opts search.Options,
+	limit int,
+	matchLimit int,
+) (*search.SearchResults, error) {
 	if limit == 0 {
 		return search.NewSearchResults(), nil
 	}
@@ -114,9 +165,10 @@ func Grep(query string, limit int) (*search.SearchResults, error) {
 	defer gitMutex.RUnlock()
 
 	res := search.NewSearchResults()
-	err := gitgrep(query, func(line []byte) (bool, error) {
-		err := grepParse(line, res)
-		if err != nil {
+	err := gitgrep(query, opts, matchLimit, func(line []byte) (bool, error) {
+		if matchLimit == 0 {
+			grepParseName(line, res)
+		} else if err := grepParse(line, res, matchLimit); err != nil {
 			return false, err
 		}
 		parseNext := res.Limit(limit)
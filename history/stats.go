@@ -0,0 +1,126 @@
+package history
+
+import (
+	"bytes"
+	"maps"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bouncepaw/mycorrhiza/internal/mimetype"
+)
+
+// EditStats are the numbers of revisions made on the wiki.
+type EditStats struct {
+	Total int
+	// ByHypha counts revisions by the hyphae they changed, including
+	// deleted hyphae.
+	ByHypha map[string]int
+	// ByUser counts revisions by their authors.
+	ByUser map[string]int
+	// ByDay counts revisions by the days they were made on, in UTC.
+	ByDay map[time.Time]int
+}
+
+var (
+	editStatsMutex sync.Mutex
+	editStatsHead  string
+	editStats      *EditStats
+)
+
+// editStatsParser parses git log output with authors, times and names of
+// changed files.
+type editStatsParser struct {
+	stats  *EditStats
+	hyphae map[string]struct{}
+}
+
+func (p *editStatsParser) parse(line []byte) (bool, error) {
+	switch {
+	case len(line) == 0:
+	case line[0] == 0:
+		mail, timestamp, _ := bytes.Cut(line[1:], []byte{'\t'})
+		username, _, _ := strings.Cut(string(mail), "@")
+		p.stats.Total++
+		p.stats.ByUser[username]++
+		if tm := unixTimestampAsTime(string(timestamp)); tm != nil {
+			y, m, d := tm.UTC().Date()
+			p.stats.ByDay[time.Date(y, m, d, 0, 0, 0, 0, time.UTC)]++
+		}
+		clear(p.hyphae)
+	default:
+		// A text and a media file of the same hypha are one edit
+		hyphaName, _, skip := mimetype.DataFromFilename(string(line))
+		if _, seen := p.hyphae[hyphaName]; !skip && !seen {
+			p.hyphae[hyphaName] = struct{}{}
+			p.stats.ByHypha[hyphaName]++
+		}
+	}
+	return true, nil
+}
+
+func newEditStats() *EditStats {
+	return &EditStats{
+		ByHypha: make(map[string]int),
+		ByUser:  make(map[string]int),
+		ByDay:   make(map[time.Time]int),
+	}
+}
+
+func (stats *EditStats) clone() *EditStats {
+	return &EditStats{
+		Total:   stats.Total,
+		ByHypha: maps.Clone(stats.ByHypha),
+		ByUser:  maps.Clone(stats.ByUser),
+		ByDay:   maps.Clone(stats.ByDay),
+	}
+}
+
+// Stats returns the numbers of revisions made on the wiki. When there are
+// new revisions, only they are counted and added to the previous numbers.
+// The result must not be modified.
+func Stats() (*EditStats, error) {
+	editStatsMutex.Lock()
+	defer editStatsMutex.Unlock()
+
+	gitMutex.RLock()
+	out, err := gitsh("rev-parse", "--verify", "--quiet", "HEAD")
+	gitMutex.RUnlock()
+	head := strings.TrimSpace(string(out))
+	switch {
+	case err != nil && head == "":
+		// There are no commits yet
+		return newEditStats(), nil
+	case err != nil:
+		return nil, err
+	case head == editStatsHead && editStats != nil:
+		return editStats, nil
+	}
+
+	parser := editStatsParser{
+		stats:  newEditStats(),
+		hyphae: make(map[string]struct{}),
+	}
+	revs := head
+	if editStats != nil && isAncestor(editStatsHead, head) {
+		parser.stats = editStats.clone()
+		revs = editStatsHead + ".." + head
+	}
+	// Revisions never change, so they are read without holding gitMutex
+	args := []string{
+		"log", "--no-merges", "--no-renames",
+		"--format=%x00%ae\t%at", "--name-only", revs, "--",
+	}
+	if err := gitPipe(args, parser.parse); err != nil {
+		return nil, err
+	}
+	editStatsHead, editStats = head, parser.stats
+	return editStats, nil
+}
+
+// isAncestor tells if the revision is an ancestor of the other one, so that
+// the history was only added to since it.
+func isAncestor(ancestor, rev string) bool {
+	out, err := gitsh("merge-base", ancestor, rev)
+	return err == nil && strings.TrimSpace(string(out)) == ancestor
+}
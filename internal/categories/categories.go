@@ -56,6 +56,19 @@ func CategoriesWithHypha(hyphaName string) (categoryList []string) {
 	return res
 }
 
+// CategoryCounts tells how many of the given hyphae are in each category. The hypha names must be canonical.
+func CategoryCounts(hyphaNames []string) map[string]int {
+	counts := make(map[string]int)
+	mutex.RLock()
+	defer mutex.RUnlock()
+	for _, hyphaName := range hyphaNames {
+		for _, cat := range categoriesWithHypha(hyphaName) {
+			counts[cat]++
+		}
+	}
+	return counts
+}
+
 // HyphaeInCategory returns what hyphae are in the category. If the returned slice is empty, the category does not exist, and vice versa. The category name must be canonical.
 func HyphaeInCategory(catName string) (hyphaList []string) {
 	mutex.RLock()
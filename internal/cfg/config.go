@@ -7,6 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"net/netip"
 	"os"
 	"path/filepath"
 	"strings"
@@ -63,6 +64,10 @@ var (
 	SessionTimeout        time.Duration
 	SessionUpdateInterval time.Duration
 	SessionCookieDuration time.Duration
+	TOTPRequiredGroup     string
+	// PasskeysEnabled if UsePasskeys and UseAuth are true and ProxyAuthEnabled
+	// is false.
+	PasskeysEnabled       bool
 
 	CommonScripts []string
 	ViewScripts   []string
@@ -73,16 +78,53 @@ var (
 	TelegramBotToken string
 	TelegramBotName  string
 
+	// OIDCEnabled if both OIDCIssuer and OIDCClientID are not empty strings.
+	OIDCEnabled       bool
+	OIDCProviderName  string
+	OIDCIssuer        string
+	OIDCClientID      string
+	OIDCClientSecret  string
+	OIDCScopes        []string
+	OIDCUsernameClaim string
+	OIDCGroupsClaim   string
+	// OIDCGroups maps values of the groups claim to wiki groups.
+	OIDCGroups map[string]string
+
+	// LDAPEnabled if both LDAPURL and LDAPBaseDN are not empty strings.
+	LDAPEnabled        bool
+	LDAPURL            string
+	LDAPStartTLS       bool
+	LDAPBindDN         string
+	LDAPBindPassword   string
+	LDAPBaseDN         string
+	LDAPUserFilter     string
+	LDAPGroupAttribute string
+	// LDAPGroups maps group DNs to wiki groups.
+	LDAPGroups map[string]string
+
+	// ProxyAuthEnabled if UseAuth is true and ProxyAuthUserHeader is not an
+	// empty string.
+	ProxyAuthEnabled        bool
+	ProxyAuthUserHeader     string
+	ProxyAuthGroupHeader    string
+	ProxyAuthTrustedProxies []netip.Prefix
+	// ProxyAuthGroups maps values of the group header to wiki groups.
+	ProxyAuthGroups map[string]string
+
 	FullTextSearch       FullTextSearchType
 	FullTextSearchPage   bool
 	FullTextLineLength   int
+	FullTextContextLines uint
 	FullTextLowerLimit   int
 	FullTextUpperLimit   int
+	FullTextRankLimit    int
 
 	GrepIgnoreMedia        bool
 	GrepMatchLimitPerHypha uint
 	GrepProcessLimit       uint
 	GrepTimeout            time.Duration
+	GrepRegex              RegexSyntax
+	GrepRegexComplexity    uint
 
 	CustomGroups      map[string]int
 	CustomPermissions map[string]string
@@ -104,6 +146,9 @@ type Config struct {
 	Grep          `comment:"Full text search with git grep."`
 	CustomScripts `comment:"You can specify additional scripts to load on different kinds of pages, delimited by a comma ',' sign."`
 	Telegram      `comment:"You can enable Telegram authorization. Follow these instructions: https://core.telegram.org/widgets/login#setting-up-a-bot"`
+	OIDC          `comment:"You can enable authorization with an OpenID Connect provider, like a company single sign-on service."`
+	LDAP          `comment:"You can check passwords of users against an LDAP directory."`
+	ProxyAuth     `comment:"You can let a reverse proxy log users in by telling their names in a header."`
 }
 
 // Hyphae is a section of Config which has fields related to special hyphae.
@@ -165,6 +210,8 @@ type Authorization struct {
 	SessionTimeout        string   `comment:"Maximum period of inactivity before a session is terminated."`
 	SessionUpdateInterval string   `comment:"How often session activity time is saved."`
 	SessionCookieDuration string   `comment:"How long session cookies last."`
+	TOTPRequiredGroup     string   `comment:"Local users in this group or in more powerful groups have to set up two-factor authentication. Leave it empty to not require it."`
+	UsePasskeys           bool     `comment:"Whether local users can add passkeys and log in with them. The wiki has to be opened at URL, which has to use HTTPS unless it is localhost."`
 	// TODO: let admins enable auth-less editing
 }
 
@@ -174,18 +221,55 @@ type Telegram struct {
 	TelegramBotName  string `comment:"Username of your bot, sans @."`
 }
 
+// OIDC is the section of Config that sets OpenID Connect authorization.
+type OIDC struct {
+	OIDCProviderName  string   `comment:"Name of the provider shown on the login button."`
+	OIDCIssuer        string   `comment:"Issuer URL of the provider. The provider configuration is discovered at <issuer>/.well-known/openid-configuration."`
+	OIDCClientID      string   `comment:"Client ID of the wiki registered with the provider."`
+	OIDCClientSecret  string   `comment:"Client secret of the wiki. Leave it empty if the wiki is registered as a public client."`
+	OIDCScopes        []string `delim:"," comment:"Scopes to request besides openid, separated by comma."`
+	OIDCUsernameClaim string   `comment:"Claim whose value is used as the username of new users. Users are recognized by the sub claim afterwards."`
+	OIDCGroupsClaim   string   `comment:"Claim with the list of groups the user is in at the provider."`
+	OIDCGroupMapping  []string `delim:"," comment:"Wiki groups for the provider groups, as provider-group:wiki-group pairs separated by comma. If the user is in several groups, the most powerful wiki group is chosen. If none matches, RegistrationGroup is used. The group is updated on every login if the provider tells the groups."`
+}
+
+// LDAP is the section of Config that sets LDAP authorization.
+type LDAP struct {
+	LDAPURL            string   `comment:"Address of the directory, like ldap://localhost:389 or ldaps://ldap.example.org."`
+	LDAPStartTLS       bool     `comment:"Whether to switch an ldap:// connection to TLS."`
+	LDAPBindDN         string   `comment:"DN to bind as when searching for users. Leave it empty to search anonymously."`
+	LDAPBindPassword   string   `comment:"Password of LDAPBindDN."`
+	LDAPBaseDN         string   `comment:"DN under which users are searched for."`
+	LDAPUserFilter     string   `comment:"Filter that finds the user entry. %s is replaced with the username."`
+	LDAPGroupAttribute string   `comment:"Attribute of the user entry that lists DNs of the user's groups."`
+	LDAPGroupMapping   []string `delim:"|" comment:"Wiki groups for the directory groups, as group-dn:wiki-group pairs separated by vertical bar. If the user is in several groups, the most powerful wiki group is chosen. If none matches, RegistrationGroup is used. If set, the group is updated on every login."`
+}
+
+// ProxyAuth is the section of Config that sets authorization by a reverse
+// proxy.
+type ProxyAuth struct {
+	ProxyAuthUserHeader     string   `comment:"Header with the username, like X-Remote-User. If set, users are not logged in by the wiki, only by the proxy."`
+	ProxyAuthGroupHeader    string   `comment:"Header with the groups of the user, separated by comma. If set, the group of the user follows it on every request, unless the header is missing."`
+	ProxyAuthTrustedProxies []string `delim:"," comment:"Addresses of the proxies whose headers are trusted, in CIDR notation, separated by comma. Requests to a Unix socket ListenAddr are always trusted."`
+	ProxyAuthGroupMapping   []string `delim:"," comment:"Wiki groups for the proxy groups, as proxy-group:wiki-group pairs separated by comma. Proxy groups named like wiki groups need no mapping. If the user is in several groups, the most powerful wiki group is chosen. If none matches, RegistrationGroup is used."`
+}
+
 type Search struct {
-	FullText             string `comment:"Full text search type. Options: none, grep"`
+	FullText             string `comment:"Full text search type. Options: none, grep, index"`
 	FullTextLineLength   int   `comment:"Maximum length of a single line of a full text search result. If the number is zero, only hypha links are shown. If the number is negative, there is no limit."`
+	FullTextContextLines uint   `comment:"Number of lines shown before and after every matched line of a full text search result."`
 	FullTextLowerLimit   int    `comment:"Maximum number of full text search results shown in the /title-search/ page. If the number is zero, full text search is disabled for the page. If the number is negative, there is no limit."`
 	FullTextUpperLimit   int    `comment:"Maximum number of search results shown in the /text-search/ page. If the number is zero, the page does not exist. If the number is negative, there is no limit."`
+	FullTextRankLimit    int    `comment:"Maximum number of full text search results ranked by relevance. The best ones are shown. If the number is zero, results are not ranked. If the number is negative, there is no limit."`
 }
 
 type Grep struct {
 	GrepIgnoreMedia        bool   `comment:"Whether to exclude non-binary media files from full text search"`
-	GrepMatchLimitPerHypha uint   `comment:"Maximum number of matched lines per hypha. If the number is zero, there is no limit."`
-	GrepProcessLimit       uint   `comment:"Maximum number of parallel grep processes. If exceeded, full text search returns an error. If the number is zero, there is no limit."`
+	GrepMatchLimitPerHypha uint   `comment:"Maximum number of matched lines per hypha. Also applies to the index search. Only these lines are counted when results are ranked. If the number is zero, there is no limit."`
+	GrepProcessLimit       uint   `comment:"Maximum number of parallel grep processes, including the history search and the git log used to rank results by recency. If exceeded, full text search returns an error. If the number is zero, there is no limit."`
 	GrepTimeout            string `comment:"Maximum execution time of grep processes. If the duration is zero, there is no limit."`
+	GrepRegex              string `comment:"Syntax of regular expressions in full text and history search. Options: none, extended, perl. If none, regular expressions are not allowed."`
+	GrepRegexComplexity    uint   `comment:"Maximum complexity of a regular expression, which is the size of its compiled program. If the number is zero, there is no limit."`
 }
 
 type FullTextSearchType int
@@ -193,7 +277,7 @@ type FullTextSearchType int
 const (
 	FullTextDisabled FullTextSearchType = iota
 	FullTextGrep
-	// TODO: FullTextIndex ?
+	FullTextIndex
 )
 
 func FullTextSearchTypeFromString(value string) (FullTextSearchType, error) {
@@ -203,6 +287,8 @@ func FullTextSearchTypeFromString(value string) (FullTextSearchType, error) {
 		return FullTextDisabled, nil
 	case "grep":
 		return FullTextGrep, nil
+	case "index":
+		return FullTextIndex, nil
 	default:
 		return FullTextDisabled, fmt.Errorf("invalid full text search type: %s", value)
 	}
@@ -214,6 +300,43 @@ func (t FullTextSearchType) String() string {
 		return "none"
 	case FullTextGrep:
 		return "grep"
+	case FullTextIndex:
+		return "index"
+	default:
+		return "none"
+	}
+}
+
+type RegexSyntax int
+
+const (
+	RegexDisabled RegexSyntax = iota
+	RegexExtended
+	RegexPerl
+)
+
+func RegexSyntaxFromString(value string) (RegexSyntax, error) {
+	value = strings.ToLower(value)
+	switch value {
+	case "none", "off", "false", "disabled":
+		return RegexDisabled, nil
+	case "extended", "posix", "ere":
+		return RegexExtended, nil
+	case "perl", "pcre":
+		return RegexPerl, nil
+	default:
+		return RegexDisabled, fmt.Errorf("invalid regular expression syntax: %s", value)
+	}
+}
+
+func (s RegexSyntax) String() string {
+	switch s {
+	case RegexDisabled:
+		return "none"
+	case RegexExtended:
+		return "extended"
+	case RegexPerl:
+		return "perl"
 	default:
 		return "none"
 	}
@@ -301,18 +424,24 @@ func ReadConfigFile(path string) error {
 			SessionTimeout:        "1y",
 			SessionUpdateInterval: "1d",
 			SessionCookieDuration: "1y",
+			TOTPRequiredGroup:     "",
+			UsePasskeys:           false,
 		},
 		Search: Search{
 			FullText:             "grep",
 			FullTextLineLength:   256,
+			FullTextContextLines: 1,
 			FullTextLowerLimit:   0,
 			FullTextUpperLimit:   256,
+			FullTextRankLimit:    1024,
 		},
 		Grep: Grep{
 			GrepIgnoreMedia:        true,
 			GrepMatchLimitPerHypha: 1,
 			GrepProcessLimit:       16,
 			GrepTimeout:            "10s",
+			GrepRegex:              "extended",
+			GrepRegexComplexity:    1000,
 		},
 		CustomScripts: CustomScripts{
 			CommonScripts: []string{},
@@ -323,6 +452,32 @@ func ReadConfigFile(path string) error {
 			TelegramBotToken: "",
 			TelegramBotName:  "",
 		},
+		OIDC: OIDC{
+			OIDCProviderName:  "OpenID Connect",
+			OIDCIssuer:        "",
+			OIDCClientID:      "",
+			OIDCClientSecret:  "",
+			OIDCScopes:        []string{"profile"},
+			OIDCUsernameClaim: "preferred_username",
+			OIDCGroupsClaim:   "groups",
+			OIDCGroupMapping:  []string{},
+		},
+		LDAP: LDAP{
+			LDAPURL:            "",
+			LDAPStartTLS:       false,
+			LDAPBindDN:         "",
+			LDAPBindPassword:   "",
+			LDAPBaseDN:         "",
+			LDAPUserFilter:     "(uid=%s)",
+			LDAPGroupAttribute: "memberOf",
+			LDAPGroupMapping:   []string{},
+		},
+		ProxyAuth: ProxyAuth{
+			ProxyAuthUserHeader:     "",
+			ProxyAuthGroupHeader:    "",
+			ProxyAuthTrustedProxies: []string{"127.0.0.1/32", "::1/128"},
+			ProxyAuthGroupMapping:   []string{},
+		},
 	}
 
 	f, err := ini.Load(path)
@@ -431,6 +586,7 @@ func ReadConfigFile(path string) error {
 	UseWhiteList = cfg.UseWhiteList
 	WhiteList = cfg.WhiteList
 	SessionLimit = cfg.SessionLimit
+	TOTPRequiredGroup = cfg.TOTPRequiredGroup
 	if SessionTimeout, err = pd(cfg.SessionTimeout, "SessionTimeout"); err != nil {
 		return err
 	}
@@ -447,8 +603,10 @@ func ReadConfigFile(path string) error {
 	if FullTextLineLength == 0 {
 		cfg.GrepMatchLimitPerHypha = 1
 	}
+	FullTextContextLines = cfg.FullTextContextLines
 	FullTextLowerLimit = cfg.FullTextLowerLimit
 	FullTextUpperLimit = cfg.FullTextUpperLimit
+	FullTextRankLimit = cfg.FullTextRankLimit
 	FullTextSearchPage = FullTextSearch != FullTextDisabled && FullTextUpperLimit != 0
 	GrepIgnoreMedia = cfg.GrepIgnoreMedia
 	GrepMatchLimitPerHypha = cfg.GrepMatchLimitPerHypha
@@ -456,12 +614,69 @@ func ReadConfigFile(path string) error {
 	if GrepTimeout, err = pd(cfg.GrepTimeout, "GrepTimeout"); err != nil {
 		return err
 	}
+	if GrepRegex, err = RegexSyntaxFromString(cfg.GrepRegex); err != nil {
+		return err
+	}
+	GrepRegexComplexity = cfg.GrepRegexComplexity
 	CommonScripts = cfg.CommonScripts
 	ViewScripts = cfg.ViewScripts
 	EditScripts = cfg.EditScripts
 	TelegramBotToken = cfg.TelegramBotToken
 	TelegramBotName = cfg.TelegramBotName
 	TelegramEnabled = (TelegramBotToken != "") && (TelegramBotName != "")
+	OIDCProviderName = cfg.OIDCProviderName
+	OIDCIssuer = cfg.OIDCIssuer
+	OIDCClientID = cfg.OIDCClientID
+	OIDCClientSecret = cfg.OIDCClientSecret
+	OIDCScopes = cfg.OIDCScopes
+	OIDCUsernameClaim = cfg.OIDCUsernameClaim
+	OIDCGroupsClaim = cfg.OIDCGroupsClaim
+	OIDCEnabled = (OIDCIssuer != "") && (OIDCClientID != "")
+	OIDCGroups = make(map[string]string)
+	for _, pair := range cfg.OIDCGroupMapping {
+		// Provider groups may contain colons, wiki groups may not
+		i := strings.LastIndex(pair, ":")
+		if i < 0 {
+			return fmt.Errorf("failed to parse OIDCGroupMapping: %s: not a provider-group:wiki-group pair", pair)
+		}
+		OIDCGroups[strings.TrimSpace(pair[:i])] = strings.TrimSpace(pair[i+1:])
+	}
+	LDAPURL = cfg.LDAPURL
+	LDAPStartTLS = cfg.LDAPStartTLS
+	LDAPBindDN = cfg.LDAPBindDN
+	LDAPBindPassword = cfg.LDAPBindPassword
+	LDAPBaseDN = cfg.LDAPBaseDN
+	LDAPUserFilter = cfg.LDAPUserFilter
+	LDAPGroupAttribute = cfg.LDAPGroupAttribute
+	LDAPEnabled = (LDAPURL != "") && (LDAPBaseDN != "")
+	LDAPGroups = make(map[string]string)
+	for _, pair := range cfg.LDAPGroupMapping {
+		i := strings.LastIndex(pair, ":")
+		if i < 0 {
+			return fmt.Errorf("failed to parse LDAPGroupMapping: %s: not a group-dn:wiki-group pair", pair)
+		}
+		LDAPGroups[strings.TrimSpace(pair[:i])] = strings.TrimSpace(pair[i+1:])
+	}
+	ProxyAuthUserHeader = cfg.ProxyAuthUserHeader
+	ProxyAuthGroupHeader = cfg.ProxyAuthGroupHeader
+	ProxyAuthEnabled = UseAuth && (ProxyAuthUserHeader != "")
+	ProxyAuthTrustedProxies = nil
+	for _, cidr := range cfg.ProxyAuthTrustedProxies {
+		prefix, err := netip.ParsePrefix(strings.TrimSpace(cidr))
+		if err != nil {
+			return fmt.Errorf("failed to parse ProxyAuthTrustedProxies: %w", err)
+		}
+		ProxyAuthTrustedProxies = append(ProxyAuthTrustedProxies, prefix)
+	}
+	ProxyAuthGroups = make(map[string]string)
+	for _, pair := range cfg.ProxyAuthGroupMapping {
+		i := strings.LastIndex(pair, ":")
+		if i < 0 {
+			return fmt.Errorf("failed to parse ProxyAuthGroupMapping: %s: not a proxy-group:wiki-group pair", pair)
+		}
+		ProxyAuthGroups[strings.TrimSpace(pair[:i])] = strings.TrimSpace(pair[i+1:])
+	}
+	PasskeysEnabled = UseAuth && cfg.UsePasskeys && !ProxyAuthEnabled
 
 	s, err := f.GetSection("Groups")
 	if err == nil {
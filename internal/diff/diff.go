@@ -0,0 +1,152 @@
+// Package diff compares texts line by line and word by word.
+package diff
+
+import (
+	"slices"
+)
+
+// Op is a kind of edit.
+type Op int
+
+const (
+	OpEqual Op = iota
+	OpDelete
+	OpInsert
+)
+
+func (op Op) String() string {
+	switch op {
+	case OpDelete:
+		return "delete"
+	case OpInsert:
+		return "insert"
+	default:
+		return "equal"
+	}
+}
+
+// Edit is a run of elements that are kept, deleted from the old sequence or
+// inserted from the new one.
+type Edit struct {
+	Op  Op
+	Len int
+}
+
+// maxEdits is the maximum number of edits the diff looks for. Sequences that
+// differ more are treated as replaced entirely, apart from their common
+// beginning and end.
+const maxEdits = 1000
+
+// Diff finds a shortest list of edits turning a into b.
+func Diff[T comparable](a, b []T) []Edit {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for (suffix < len(a) - prefix &&
+		suffix < len(b) - prefix &&
+		a[len(a) - 1 - suffix] == b[len(b) - 1 - suffix]) {
+		suffix++
+	}
+	var edits []Edit
+	edits = appendEdit(edits, OpEqual, prefix)
+	for _, e := range myers(a[prefix:len(a) - suffix], b[prefix:len(b) - suffix]) {
+		edits = appendEdit(edits, e.Op, e.Len)
+	}
+	return appendEdit(edits, OpEqual, suffix)
+}
+
+// appendEdit appends an edit, merging it with the last one if possible.
+func appendEdit(edits []Edit, op Op, n int) []Edit {
+	switch {
+	case n == 0:
+		return edits
+	case len(edits) > 0 && edits[len(edits) - 1].Op == op:
+		edits[len(edits) - 1].Len += n
+		return edits
+	default:
+		return append(edits, Edit{Op: op, Len: n})
+	}
+}
+
+// replaced is the list of edits that deletes a and inserts b.
+func replaced(n, m int) []Edit {
+	return appendEdit(appendEdit(nil, OpDelete, n), OpInsert, m)
+}
+
+// myers is the Myers' O(ND) difference algorithm. It keeps the furthest
+// reaching point of every diagonal for every number of edits to find the
+// path back.
+func myers[T comparable](a, b []T) []Edit {
+	n, m := len(a), len(b)
+	if n == 0 || m == 0 {
+		return replaced(n, m)
+	}
+	var (
+		limit  = min(n + m, maxEdits)
+		offset = limit + 1
+		v      = make([]int, 2 * limit + 3)
+		trace  [][]int
+	)
+	for d := 0; d <= limit; d++ {
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset + k - 1] < v[offset + k + 1]) {
+				x = v[offset + k + 1]
+			} else {
+				x = v[offset + k - 1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset + k] = x
+			if x >= n && y >= m {
+				trace = append(trace, slices.Clone(v[offset - d:offset + d + 1]))
+				return backtrack(trace, n, m)
+			}
+		}
+		trace = append(trace, slices.Clone(v[offset - d:offset + d + 1]))
+	}
+	return replaced(n, m)
+}
+
+// backtrack walks from the end to the beginning of the path found by myers.
+func backtrack(trace [][]int, n, m int) []Edit {
+	var (
+		ops  []Op
+		x, y = n, m
+	)
+	for d := len(trace) - 1; d > 0; d-- {
+		prev := trace[d - 1]
+		k := x - y
+		prevK := k - 1
+		if k == -d || (k != d && prev[k - 1 + d - 1] < prev[k + 1 + d - 1]) {
+			prevK = k + 1
+		}
+		prevX := prev[prevK + d - 1]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			ops = append(ops, OpEqual)
+			x--
+			y--
+		}
+		if x == prevX {
+			ops = append(ops, OpInsert)
+			y--
+		} else {
+			ops = append(ops, OpDelete)
+			x--
+		}
+	}
+	for ; x > 0; x-- {
+		ops = append(ops, OpEqual)
+	}
+	var edits []Edit
+	for i := len(ops) - 1; i >= 0; i-- {
+		edits = appendEdit(edits, ops[i], 1)
+	}
+	return edits
+}
@@ -0,0 +1,188 @@
+package diff
+
+import (
+	"math/rand"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// apply runs the edit script on a and returns the result. It fails the test
+// if the script does not fit a or keeps elements that differ in b.
+func apply(t *testing.T, a, b []string, edits []Edit) []string {
+	t.Helper()
+	var res []string
+	i, j := 0, 0
+	for _, e := range edits {
+		if e.Len <= 0 {
+			t.Fatalf("edit %v has no elements", e)
+		}
+		switch e.Op {
+		case OpEqual:
+			if i + e.Len > len(a) || j + e.Len > len(b) {
+				t.Fatalf("edit %v goes past the end", e)
+			}
+			if !slices.Equal(a[i:i + e.Len], b[j:j + e.Len]) {
+				t.Fatalf("kept %q, but the new text has %q", a[i:i + e.Len], b[j:j + e.Len])
+			}
+			res = append(res, a[i:i + e.Len]...)
+			i, j = i + e.Len, j + e.Len
+		case OpDelete:
+			if i + e.Len > len(a) {
+				t.Fatalf("edit %v goes past the end", e)
+			}
+			i += e.Len
+		case OpInsert:
+			if j + e.Len > len(b) {
+				t.Fatalf("edit %v goes past the end", e)
+			}
+			res = append(res, b[j:j + e.Len]...)
+			j += e.Len
+		}
+	}
+	if i != len(a) {
+		t.Fatalf("the script covers %d of %d old elements", i, len(a))
+	}
+	return res
+}
+
+// changed counts the deleted and inserted elements.
+func changed(edits []Edit) int {
+	n := 0
+	for _, e := range edits {
+		if e.Op != OpEqual {
+			n += e.Len
+		}
+	}
+	return n
+}
+
+// lcs is the length of the longest common subsequence, found the slow way.
+func lcs(a, b []string) int {
+	prev, curr := make([]int, len(b) + 1), make([]int, len(b) + 1)
+	for i := range a {
+		for j := range b {
+			if a[i] == b[j] {
+				curr[j + 1] = prev[j] + 1
+			} else {
+				curr[j + 1] = max(prev[j + 1], curr[j])
+			}
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name  string
+		a, b  string
+		edits []Edit
+	}{
+		{"both empty", "", "", nil},
+		{"old empty", "", "a b c", []Edit{{OpInsert, 3}}},
+		{"new empty", "a b c", "", []Edit{{OpDelete, 3}}},
+		{"identical", "a b c", "a b c", []Edit{{OpEqual, 3}}},
+		{"insert at the beginning", "b c", "a b c", []Edit{{OpInsert, 1}, {OpEqual, 2}}},
+		{"insert in the middle", "a d", "a b c d", []Edit{{OpEqual, 1}, {OpInsert, 2}, {OpEqual, 1}}},
+		{"insert at the end", "a b", "a b c", []Edit{{OpEqual, 2}, {OpInsert, 1}}},
+		{"delete at the beginning", "a b c", "b c", []Edit{{OpDelete, 1}, {OpEqual, 2}}},
+		{"delete in the middle", "a b c d", "a d", []Edit{{OpEqual, 1}, {OpDelete, 2}, {OpEqual, 1}}},
+		{"delete at the end", "a b c", "a b", []Edit{{OpEqual, 2}, {OpDelete, 1}}},
+		{"replace", "a b c", "a x c", []Edit{{OpEqual, 1}, {OpDelete, 1}, {OpInsert, 1}, {OpEqual, 1}}},
+		{"nothing in common", "a b", "c d", []Edit{{OpDelete, 2}, {OpInsert, 2}}},
+		{"swap", "a b", "b a", nil},
+		{"move to the end", "a b c d", "b c d a", nil},
+		{"reverse", "a b c d e", "e d c b a", nil},
+		{"repeated elements", "a a b a a", "a b a b a", nil},
+		{"interleaved", "a b c d e f", "a x c y e z", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := strings.Fields(tt.a), strings.Fields(tt.b)
+			edits := Diff(a, b)
+			if tt.edits != nil && !slices.Equal(edits, tt.edits) {
+				t.Errorf("Diff(%q, %q) = %v, want %v", a, b, edits, tt.edits)
+			}
+			if got := apply(t, a, b, edits); !slices.Equal(got, b) {
+				t.Errorf("applying %v to %q gives %q, want %q", edits, a, got, b)
+			}
+			if got, want := changed(edits), len(a) + len(b) - 2 * lcs(a, b); got != want {
+				t.Errorf("%v changes %d elements, the shortest script changes %d", edits, got, want)
+			}
+		})
+	}
+}
+
+// TestDiffRandom checks scripts for random sequences against the slow
+// longest common subsequence.
+func TestDiffRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	random := func() []string {
+		s := make([]string, r.Intn(30))
+		for i := range s {
+			s[i] = string(rune('a' + r.Intn(4)))
+		}
+		return s
+	}
+	for range 500 {
+		a, b := random(), random()
+		edits := Diff(a, b)
+		if got := apply(t, a, b, edits); !slices.Equal(got, b) {
+			t.Fatalf("applying %v to %q gives %q, want %q", edits, a, got, b)
+		}
+		if got, want := changed(edits), len(a) + len(b) - 2 * lcs(a, b); got != want {
+			t.Fatalf("Diff(%q, %q) changes %d elements, the shortest script changes %d", a, b, got, want)
+		}
+	}
+}
+
+// TestDiffTooDifferent checks that sequences differing in more than maxEdits
+// elements are still diffed correctly, though not in the shortest way.
+func TestDiffTooDifferent(t *testing.T) {
+	var a, b []string
+	for i := range maxEdits {
+		a = append(a, "old", strings.Repeat("x", i % 7))
+		b = append(b, "new", strings.Repeat("x", i % 7))
+	}
+	a = append([]string{"start"}, append(a, "end")...)
+	b = append([]string{"start"}, append(b, "end")...)
+	edits := Diff(a, b)
+	if got := apply(t, a, b, edits); !slices.Equal(got, b) {
+		t.Fatal("applying the script does not give the new sequence")
+	}
+	if edits[0].Op != OpEqual || edits[len(edits) - 1].Op != OpEqual {
+		t.Errorf("the common beginning and end are not kept: %v ... %v", edits[0], edits[len(edits) - 1])
+	}
+}
+
+func TestLines(t *testing.T) {
+	oldText := "one\ntwo\nthree\nfour\nfive\nsix\nseven\n"
+	newText := "one\n2\nthree\nfour\nfive\nsix\nseven\neight\n"
+
+	hunks := Lines(oldText, newText, 1)
+	if len(hunks) != 2 {
+		t.Fatalf("got %d hunks, want 2", len(hunks))
+	}
+	var got []string
+	for _, line := range hunks[0].Lines {
+		got = append(got, line.Op.String())
+	}
+	if want := []string{"equal", "delete", "insert", "equal"}; !slices.Equal(got, want) {
+		t.Errorf("first hunk = %q, want %q", got, want)
+	}
+	last := hunks[1].Lines[len(hunks[1].Lines) - 1]
+	if last.Op != OpInsert || last.New != 8 || last.Old != 0 {
+		t.Errorf("last line = %+v, want the inserted line 8", last)
+	}
+
+	if hunks := Lines(oldText, oldText, 3); len(hunks) != 0 {
+		t.Errorf("identical texts give %d hunks", len(hunks))
+	}
+	if hunks := Lines("a\r\nb\r\n", "a\nb", 3); len(hunks) != 0 {
+		t.Errorf("line endings make %d hunks", len(hunks))
+	}
+	if hunks := Lines(oldText, newText, -1); len(hunks) != 1 || len(hunks[0].Lines) != 9 {
+		t.Errorf("negative context does not keep all lines in one hunk")
+	}
+}
@@ -0,0 +1,297 @@
+package diff
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Span is a part of a line that is kept, deleted or inserted.
+type Span struct {
+	Op   Op
+	Text string
+}
+
+// Line is a line of a diff. Changed words of deleted and inserted lines are
+// marked in their spans.
+type Line struct {
+	Op Op
+	// Old and New are the numbers of the line in the old and the new text,
+	// starting from 1. They are zero if the line is not in the text.
+	Old, New int
+	Spans    []Span
+	// edited tells if the line is paired with a line on the other side.
+	edited bool
+}
+
+// Hunk is a group of changed lines with unchanged lines around them.
+type Hunk struct {
+	Lines []Line
+}
+
+// Row is a row of a side-by-side diff. Kept lines are on both sides, deleted
+// lines are paired with inserted ones. Either side can be nil.
+type Row struct {
+	Old, New *Line
+}
+
+// Rows arranges the lines of the hunk side by side.
+func (h Hunk) Rows() []Row {
+	var rows []Row
+	for i := 0; i < len(h.Lines); {
+		if h.Lines[i].Op == OpEqual {
+			rows = append(rows, Row{Old: &h.Lines[i], New: &h.Lines[i]})
+			i++
+			continue
+		}
+		deleted, inserted := changeBlock(h.Lines[i:])
+		rows = appendBlockRows(rows, deleted, inserted)
+		i += len(deleted) + len(inserted)
+	}
+	return rows
+}
+
+// appendBlockRows puts every edited line next to its other version. Other
+// lines between them are put next to each other as they go.
+func appendBlockRows(rows []Row, deleted, inserted []Line) []Row {
+	var i, j int
+	for {
+		i0, j0 := i, j
+		for i < len(deleted) && !deleted[i].edited {
+			i++
+		}
+		for j < len(inserted) && !inserted[j].edited {
+			j++
+		}
+		rows = appendZipped(rows, deleted[i0:i], inserted[j0:j])
+		if i == len(deleted) || j == len(inserted) {
+			return appendZipped(rows, deleted[i:], inserted[j:])
+		}
+		rows = append(rows, Row{Old: &deleted[i], New: &inserted[j]})
+		i, j = i + 1, j + 1
+	}
+}
+
+func appendZipped(rows []Row, deleted, inserted []Line) []Row {
+	for k := 0; k < max(len(deleted), len(inserted)); k++ {
+		var row Row
+		if k < len(deleted) {
+			row.Old = &deleted[k]
+		}
+		if k < len(inserted) {
+			row.New = &inserted[k]
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// changeBlock splits the deleted lines and the inserted lines following them
+// at the beginning of the lines.
+func changeBlock(lines []Line) (deleted, inserted []Line) {
+	i := 0
+	for i < len(lines) && lines[i].Op == OpDelete {
+		i++
+	}
+	j := i
+	for j < len(lines) && lines[j].Op == OpInsert {
+		j++
+	}
+	return lines[:i], lines[i:j]
+}
+
+// splitLines splits the text into lines without line endings.
+func splitLines(text string) []string {
+	text = strings.TrimSuffix(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
+
+// Lines compares the texts line by line and marks changed words in lines
+// that were edited rather than replaced. Only lines that are no further than
+// context lines from a change are kept, grouped into hunks. If context is
+// negative, all lines are kept in a single hunk.
+func Lines(oldText, newText string, context int) []Hunk {
+	var (
+		a, b  = splitLines(oldText), splitLines(newText)
+		lines []Line
+		i, j  int
+	)
+	for _, e := range Diff(a, b) {
+		for range e.Len {
+			line := Line{Op: e.Op}
+			switch e.Op {
+			case OpEqual:
+				i, j = i + 1, j + 1
+				line.Old, line.New = i, j
+				line.Spans = []Span{{Op: OpEqual, Text: a[i - 1]}}
+			case OpDelete:
+				i++
+				line.Old = i
+				line.Spans = []Span{{Op: OpEqual, Text: a[i - 1]}}
+			case OpInsert:
+				j++
+				line.New = j
+				line.Spans = []Span{{Op: OpEqual, Text: b[j - 1]}}
+			}
+			lines = append(lines, line)
+		}
+	}
+	markWords(lines)
+	if context < 0 {
+		if len(lines) == 0 {
+			return nil
+		}
+		return []Hunk{{Lines: lines}}
+	}
+
+	var (
+		hunks      []Hunk
+		start, end = -1, -1
+	)
+	for i, line := range lines {
+		if line.Op == OpEqual {
+			continue
+		}
+		lo, hi := max(0, i - context), min(len(lines), i + context + 1)
+		if start >= 0 && lo <= end {
+			end = max(end, hi)
+			continue
+		}
+		if start >= 0 {
+			hunks = append(hunks, Hunk{Lines: lines[start:end]})
+		}
+		start, end = lo, hi
+	}
+	if start >= 0 {
+		hunks = append(hunks, Hunk{Lines: lines[start:end]})
+	}
+	return hunks
+}
+
+// maxPairings is the maximum number of line pairs compared to find edited
+// lines in a block of changes. Larger blocks are paired in order.
+const maxPairings = 400
+
+// markWords finds deleted lines that were edited into inserted lines rather
+// than replaced and marks the words that differ.
+func markWords(lines []Line) {
+	for i := 0; i < len(lines); {
+		if lines[i].Op == OpEqual {
+			i++
+			continue
+		}
+		deleted, inserted := changeBlock(lines[i:])
+		if len(deleted) * len(inserted) > maxPairings {
+			for k := range min(len(deleted), len(inserted)) {
+				pairLines(&deleted[k], &inserted[k])
+			}
+		} else {
+			next := 0
+			for k := range deleted {
+				for l := next; l < len(inserted); l++ {
+					if pairLines(&deleted[k], &inserted[l]) {
+						next = l + 1
+						break
+					}
+				}
+			}
+		}
+		i += max(1, len(deleted) + len(inserted))
+	}
+}
+
+// pairLines marks the changed words of the lines if they are similar.
+func pairLines(deleted, inserted *Line) bool {
+	oldSpans, newSpans, similar := Words(deleted.Spans[0].Text, inserted.Spans[0].Text)
+	if similar {
+		deleted.Spans, inserted.Spans = oldSpans, newSpans
+		deleted.edited, inserted.edited = true, true
+	}
+	return similar
+}
+
+// Words compares two versions of a line word by word. The lines are similar
+// if at least a third of the longer one is kept. Otherwise, every span is
+// kept as is, because highlighting nearly everything does not help.
+func Words(oldLine, newLine string) (oldSpans, newSpans []Span, similar bool) {
+	var (
+		a, b   = Tokenize(oldLine), Tokenize(newLine)
+		common = 0
+		i, j   int
+	)
+	for _, e := range Diff(a, b) {
+		switch e.Op {
+		case OpEqual:
+			for _, tok := range a[i:i + e.Len] {
+				common += utf8.RuneCountInString(tok)
+			}
+			oldSpans = appendSpan(oldSpans, OpEqual, a[i:i + e.Len])
+			newSpans = appendSpan(newSpans, OpEqual, b[j:j + e.Len])
+			i, j = i + e.Len, j + e.Len
+		case OpDelete:
+			oldSpans = appendSpan(oldSpans, OpDelete, a[i:i + e.Len])
+			i += e.Len
+		case OpInsert:
+			newSpans = appendSpan(newSpans, OpInsert, b[j:j + e.Len])
+			j += e.Len
+		}
+	}
+	longest := max(utf8.RuneCountInString(oldLine), utf8.RuneCountInString(newLine))
+	if common * 3 < longest {
+		return []Span{{Op: OpEqual, Text: oldLine}}, []Span{{Op: OpEqual, Text: newLine}}, false
+	}
+	return oldSpans, newSpans, true
+}
+
+// appendSpan appends the tokens as a span, merging it with the last one if
+// it has the same kind.
+func appendSpan(spans []Span, op Op, tokens []string) []Span {
+	text := strings.Join(tokens, "")
+	switch {
+	case text == "":
+		return spans
+	case len(spans) > 0 && spans[len(spans) - 1].Op == op:
+		spans[len(spans) - 1].Text += text
+		return spans
+	default:
+		return append(spans, Span{Op: op, Text: text})
+	}
+}
+
+// Tokenize splits the line into words, runs of spaces and single other
+// characters.
+func Tokenize(line string) []string {
+	var (
+		tokens []string
+		start  = 0
+		class  = -1
+	)
+	for i, r := range line {
+		c := runeClass(r)
+		if c != class || c == 0 {
+			if i > start {
+				tokens = append(tokens, line[start:i])
+			}
+			start, class = i, c
+		}
+	}
+	if start < len(line) {
+		tokens = append(tokens, line[start:])
+	}
+	return tokens
+}
+
+// runeClass is 1 for word characters, 2 for spaces and 0 for the rest.
+func runeClass(r rune) int {
+	switch {
+	case unicode.IsLetter(r), unicode.IsDigit(r), r == '_':
+		return 1
+	case unicode.IsSpace(r):
+		return 2
+	default:
+		return 0
+	}
+}
@@ -1,6 +1,8 @@
 package hyphae
 
 import (
+	"strings"
+
 	"github.com/bouncepaw/mycorrhiza/internal/cfg"
 	"github.com/bouncepaw/mycorrhiza/interwiki"
 	"github.com/bouncepaw/mycorrhiza/util"
@@ -12,6 +14,7 @@ import (
 	"git.sr.ht/~bouncepaw/mycomarkup/v5/mycocontext"
 	"git.sr.ht/~bouncepaw/mycomarkup/v5/options"
 	"git.sr.ht/~bouncepaw/mycomarkup/v5/tools"
+	mycoutil "git.sr.ht/~bouncepaw/mycomarkup/v5/util"
 )
 
 func ExtractionOptions(hyphaName string) options.Options {
@@ -94,3 +97,44 @@ func ExtractHeaderLinksFromString(
 	})
 	return headerLinks
 }
+
+// Heading is a top-level heading of a hypha text. Only such headings have
+// anchors in the rendered hypha.
+type Heading struct {
+	// Line is the number of the heading line starting from 1.
+	Line  int
+	ID    string
+	Title string
+}
+
+// ExtractHeadingsFromString finds top-level headings of the text and the
+// lines they are on.
+func ExtractHeadingsFromString(hyphaName string, text string) []Heading {
+	var (
+		headings []Heading
+		lines    = strings.Split(text, "\n")
+		next     = 0
+	)
+	ctx, _ := mycocontext.ContextFromStringInput(text, ExtractionOptions(hyphaName))
+	_ = mycomarkup.BlockTree(ctx, func(block blocks.Block) {
+		heading, ok := block.(blocks.Heading)
+		if !ok {
+			return
+		}
+		// Blocks do not know their lines, so find the heading source line
+		// after the previous heading
+		for i := next; i < len(lines); i++ {
+			line := strings.TrimSpace(lines[i])
+			if strings.HasPrefix(line, "=") && mycoutil.StringID(line) == heading.ID() {
+				headings = append(headings, Heading{
+					Line:  i + 1,
+					ID:    heading.ID(),
+					Title: strings.TrimSpace(strings.TrimLeft(line, "=")),
+				})
+				next = i + 1
+				return
+			}
+		}
+	})
+	return headings
+}
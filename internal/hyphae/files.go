@@ -11,6 +11,7 @@ import (
 	"github.com/bouncepaw/mycorrhiza/history"
 	"github.com/bouncepaw/mycorrhiza/internal/mimetype"
 	"github.com/bouncepaw/mycorrhiza/internal/process"
+	"github.com/bouncepaw/mycorrhiza/internal/search"
 	"github.com/bouncepaw/mycorrhiza/util"
 )
 
@@ -25,6 +26,10 @@ type foundFile struct {
 func Index(path string) error {
 	newByNames := make(map[string]ExistingHypha)
 	newBacklinks := make(map[string][]string)
+	newTextIndex := (*search.IndexBuilder)(nil)
+	if textIndexEnabled() {
+		newTextIndex = search.NewIndexBuilder()
+	}
 	newCount := 0
 	ch := make(chan foundFile, 8)
 	err := error(nil)
@@ -62,6 +67,9 @@ func Index(path string) error {
 		if file.isText {
 			updatedHypha = storedHypha.WithTextPath(file.path)
 			indexBacklinks(updatedHypha, file.text, newBacklinks)
+			if newTextIndex != nil {
+				newTextIndex.Add(file.hypha, string(file.text))
+			}
 		} else {
 			updatedHypha = storedHypha.WithMediaPath(file.path)
 		}
@@ -80,11 +88,16 @@ func Index(path string) error {
 		i++
 	}
 	slices.SortFunc(newHyphae, Compare)
+	builtTextIndex := (*search.Index)(nil)
+	if newTextIndex != nil {
+		builtTextIndex = newTextIndex.Index()
+	}
 
 	indexMutex.Lock()
 	hyphae = newHyphae
 	byNames = newByNames
 	backlinksByName = newBacklinks
+	textIndex = builtTextIndex
 	indexMutex.Unlock()
 
 	slog.Info("Indexed hyphae", "n", newCount)
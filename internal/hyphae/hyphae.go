@@ -2,6 +2,7 @@ package hyphae
 
 import (
 	"math/rand"
+	"slices"
 	"strings"
 	"sync"
 
@@ -94,6 +95,20 @@ func BacklinksCount(hyphaName string) int {
 	return res
 }
 
+// BacklinkCounts returns the amount of backlinks to every hypha that is linked
+// from somewhere, whether it exists or not.
+func BacklinkCounts() map[string]int {
+	indexMutex.RLock()
+	defer indexMutex.RUnlock()
+	res := make(map[string]int, len(backlinksByName))
+	for hyphaName, backlinks := range backlinksByName {
+		if len(backlinks) > 0 {
+			res[hyphaName] = len(backlinks)
+		}
+	}
+	return res
+}
+
 func BacklinksFor(hyphaName string) []string {
 	res := []string(nil)
 	hyphaName = util.CanonicalName(hyphaName)
@@ -120,6 +135,32 @@ func Orphans() []string {
 	return res
 }
 
+// WantedHypha is a hypha that does not exist but is linked to.
+type WantedHypha struct {
+	Name          string
+	BacklinkCount int
+}
+
+// Wanted returns the hyphae that do not exist but are linked to, the most
+// linked first.
+func Wanted() []WantedHypha {
+	var res []WantedHypha
+	indexMutex.RLock()
+	for name, backlinks := range backlinksByName {
+		if _, exists := byNames[name]; !exists && len(backlinks) > 0 {
+			res = append(res, WantedHypha{name, len(backlinks)})
+		}
+	}
+	indexMutex.RUnlock()
+	slices.SortFunc(res, func(a, b WantedHypha) int {
+		if a.BacklinkCount != b.BacklinkCount {
+			return b.BacklinkCount - a.BacklinkCount
+		}
+		return util.PathographicCompare(a.Name, b.Name)
+	})
+	return res
+}
+
 // Subhyphae returns slice of subhyphae.
 func Subhyphae(h Hypha) []ExistingHypha {
 	var hyphae []ExistingHypha
@@ -7,6 +7,8 @@ import (
 	"path"
 	"slices"
 	"strings"
+
+	"github.com/bouncepaw/mycorrhiza/internal/search"
 )
 
 // YieldExistingHyphae iterates over all hyphae and yields all existing ones.
@@ -22,14 +24,17 @@ func YieldExistingHyphae() iter.Seq[ExistingHypha] {
 	}
 }
 
-// YieldHyphaNamesContainingString picks hyphae with have a string in their title, sorts and iterates over them in alphabetical order.
-func YieldHyphaNamesContainingString(query string) iter.Seq[string] {
-	return func(yield func(string) bool) {
+// YieldHyphaNamesMatching iterates over hyphae whose names match the query
+// fuzzily, in alphabetical order, together with their match scores.
+func YieldHyphaNamesMatching(query string) iter.Seq2[string, float64] {
+	fq := search.NewFuzzyQuery(query)
+	return func(yield func(string, float64) bool) {
 		indexMutex.RLock()
 		defer indexMutex.RUnlock()
 		for _, h := range hyphae {
 			hyphaName := h.CanonicalName()
-			if strings.Contains(hyphaName, query) && !yield(hyphaName) {
+			score, ok := fq.Match(hyphaName)
+			if ok && !yield(hyphaName, score) {
 				return
 			}
 		}
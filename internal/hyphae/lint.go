@@ -0,0 +1,154 @@
+package hyphae
+
+// File `lint.go` contains the check of links in hypha texts.
+
+import (
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/bouncepaw/mycorrhiza/interwiki"
+	"github.com/bouncepaw/mycorrhiza/util"
+
+	"git.sr.ht/~bouncepaw/mycomarkup/v5"
+	"git.sr.ht/~bouncepaw/mycomarkup/v5/blocks"
+	"git.sr.ht/~bouncepaw/mycomarkup/v5/links"
+	"git.sr.ht/~bouncepaw/mycomarkup/v5/mycocontext"
+	"git.sr.ht/~bouncepaw/mycomarkup/v5/options"
+	"git.sr.ht/~bouncepaw/mycomarkup/v5/tools"
+)
+
+// Kinds of link problems.
+const (
+	// LinkMissingHypha is a link to a hypha that does not exist.
+	LinkMissingHypha = "missing-hypha"
+	// LinkMissingTransclusion is a transclusion of a hypha that does not exist.
+	LinkMissingTransclusion = "missing-transclusion"
+	// LinkUnknownInterwiki is an interwiki link with a prefix that is not
+	// in the interwiki map.
+	LinkUnknownInterwiki = "unknown-interwiki"
+)
+
+// LinkProblem is a broken link in a hypha text.
+type LinkProblem struct {
+	HyphaName string
+	Kind      string
+	// Target is the name of the missing hypha or the unknown interwiki prefix.
+	Target string
+}
+
+func (p LinkProblem) String() string {
+	return p.HyphaName + ": " + strings.ReplaceAll(p.Kind, "-", " ") + " " + p.Target
+}
+
+// LintLinks checks the links, interwiki links and transclusions of all
+// hyphae. The problems are sorted by hypha names.
+func LintLinks(reader util.FileReader) []LinkProblem {
+	var withText []ExistingHypha
+	for h := range YieldExistingHyphae() {
+		if h.HasTextFile() {
+			withText = append(withText, h)
+		}
+	}
+
+	var res []LinkProblem
+	for _, h := range withText {
+		text, err := h.Text(reader)
+		if err != nil {
+			slog.Warn("Failed to read hypha text", "hypha", h.CanonicalName(), "err", err)
+			continue
+		}
+		res = append(res, lintHyphaLinks(h.CanonicalName(), text)...)
+	}
+	slices.SortStableFunc(res, func(a, b LinkProblem) int {
+		return util.PathographicCompare(a.HyphaName, b.HyphaName)
+	})
+	return res
+}
+
+func lintHyphaLinks(hyphaName string, text string) []LinkProblem {
+	var (
+		res             []LinkProblem
+		seen            = make(map[LinkProblem]struct{})
+		unknownPrefixes []string
+		opts            = ExtractionOptions(hyphaName)
+	)
+	add := func(kind, target string) {
+		p := LinkProblem{hyphaName, kind, target}
+		if _, ok := seen[p]; !ok {
+			seen[p] = struct{}{}
+			res = append(res, p)
+		}
+	}
+	opts.HyphaExists = hyphaExists
+	opts.LinkHrefFormatForInterwikiPrefix = func(prefix string) (string, options.InterwikiError) {
+		format, err := interwiki.HrefLinkFormatFor(prefix)
+		if err == options.UnknownPrefix {
+			unknownPrefixes = append(unknownPrefixes, prefix)
+		}
+		return format, err
+	}
+	ctx, _ := mycocontext.ContextFromStringInput(text, opts)
+
+	linkVisitor, getLinks := tools.LinkVisitor(ctx)
+	var transclusions []string
+	var visitTransclusions func(block blocks.Block)
+	visitTransclusions = func(block blocks.Block) {
+		switch block := block.(type) {
+		case blocks.Transclusion:
+			if block.Reason == blocks.TransclusionErrorNotExists {
+				transclusions = append(transclusions, block.Target)
+			}
+		case blocks.List:
+			for _, item := range block.Items {
+				for _, sub := range item.Contents {
+					visitTransclusions(sub)
+				}
+			}
+		case blocks.Quote:
+			for _, sub := range block.Contents() {
+				visitTransclusions(sub)
+			}
+		case blocks.Table:
+			for _, row := range block.Rows() {
+				for _, cell := range row.Cells() {
+					visitTransclusions(cell)
+				}
+			}
+		case blocks.TableCell:
+			for _, sub := range block.Contents() {
+				visitTransclusions(sub)
+			}
+		}
+	}
+	_ = mycomarkup.BlockTree(ctx, func(block blocks.Block) {
+		linkVisitor(block)
+		visitTransclusions(block)
+	})
+
+	for _, target := range transclusions {
+		add(LinkMissingTransclusion, target)
+	}
+	for _, link := range getLinks() {
+		switch link := link.(type) {
+		case *links.LocalLink:
+			// Transclusions are links too, they are reported above
+			target := link.Target(ctx)
+			if !hyphaExists(target) && !slices.Contains(transclusions, target) {
+				add(LinkMissingHypha, target)
+			}
+		case *links.InterwikiLink:
+			// Records the prefix if it is unknown
+			link.TryToGetError(ctx)
+		}
+	}
+	for _, prefix := range unknownPrefixes {
+		add(LinkUnknownInterwiki, prefix)
+	}
+	return res
+}
+
+func hyphaExists(hyphaName string) bool {
+	_, empty := ByName(util.CanonicalName(hyphaName)).(*EmptyHypha)
+	return !empty
+}
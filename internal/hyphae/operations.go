@@ -11,6 +11,7 @@ import (
 type opPart struct {
 	hyphae    []ExistingHypha
 	backlinks []backlinkIndexOperation
+	texts     []textIndexOperation
 }
 
 type Op struct {
@@ -44,6 +45,12 @@ func (op *Op) WithHyphaCreated(h ExistingHypha, text string) *Op {
 			op.insert.backlinks,
 			updateBacklinksAfterEdit(h, "", text),
 		)
+		if textIndex != nil {
+			op.insert.texts = append(
+				op.insert.texts,
+				textIndexEdit{h.CanonicalName(), text},
+			)
+		}
 	}
 	if h.CanonicalName() == cfg.HeaderLinksHypha {
 		op.headerLinks = ExtractHeaderLinksFromString(h.CanonicalName(), text)
@@ -62,6 +69,12 @@ func (op *Op) WithHyphaDeleted(h ExistingHypha, text string) *Op {
 			updateBacklinksAfterDelete(h, text),
 		)
 	}
+	if textIndex != nil {
+		op.remove.texts = append(
+			op.remove.texts,
+			textIndexDeletion{h.CanonicalName()},
+		)
+	}
 	if h.CanonicalName() == cfg.HeaderLinksHypha && op.headerLinks == nil {
 		op.headerLinks = viewutil.DefaultHeaderLinks()
 	}
@@ -83,6 +96,12 @@ func (op *Op) WithHyphaRenamedPair(
 		op.insert.backlinks,
 		updateBacklinksAfterRename(pair.To(), oldName, text),
 	)
+	if textIndex != nil {
+		op.insert.texts = append(
+			op.insert.texts,
+			textIndexRenaming{oldName, newName},
+		)
+	}
 	switch {
 	case newName == cfg.HeaderLinksHypha:
 		op.headerLinks = ExtractHeaderLinksFromString(newName, text)
@@ -112,6 +131,12 @@ func (op *Op) WithHyphaTextChanged(
 			op.insert.backlinks,
 			updateBacklinksAfterEdit(old, oldText, newText),
 		)
+		if textIndex != nil {
+			op.insert.texts = append(
+				op.insert.texts,
+				textIndexEdit{old.CanonicalName(), newText},
+			)
+		}
 	}
 	if old.CanonicalName() != new.CanonicalName() {
 		return op.WithHyphaRenamed(old, new, newText)
@@ -144,6 +169,12 @@ func (op *Op) Apply() *Op {
 	for _, b := range op.insert.backlinks {
 		b.apply()
 	}
+	for _, t := range op.remove.texts {
+		t.apply()
+	}
+	for _, t := range op.insert.texts {
+		t.apply()
+	}
 	if op.headerLinks != nil {
 		viewutil.SetHeaderLinks(op.headerLinks)
 	}
@@ -0,0 +1,186 @@
+package hyphae
+
+import (
+	"errors"
+	"log/slog"
+	"regexp"
+	"strings"
+
+	"github.com/bouncepaw/mycorrhiza/history"
+	"github.com/bouncepaw/mycorrhiza/internal/cfg"
+	"github.com/bouncepaw/mycorrhiza/internal/search"
+)
+
+var ErrNoTextIndex = errors.New("full text index is disabled")
+
+// textIndex is the full text index. It is nil unless the index search type is configured.
+var textIndex *search.Index
+
+// textIndexOperation is an operation for the full text index. This operation is executed async-safe.
+type textIndexOperation interface {
+	apply()
+}
+
+// textIndexEdit contains data for full text index update after a hypha edit
+type textIndexEdit struct {
+	name string
+	text string
+}
+
+// apply changes full text index respective to the operation data
+func (op textIndexEdit) apply() {
+	textIndex.Add(op.name, op.text)
+}
+
+// textIndexDeletion contains data for full text index update after a hypha deletion
+type textIndexDeletion struct {
+	name string
+}
+
+// apply changes full text index respective to the operation data
+func (op textIndexDeletion) apply() {
+	textIndex.Remove(op.name)
+}
+
+// textIndexRenaming contains data for full text index update after a hypha renaming
+type textIndexRenaming struct {
+	oldName string
+	newName string
+}
+
+// apply changes full text index respective to the operation data
+func (op textIndexRenaming) apply() {
+	textIndex.Rename(op.oldName, op.newName)
+}
+
+func textIndexEnabled() bool {
+	return cfg.FullTextSearch == cfg.FullTextIndex
+}
+
+// SearchText finds hyphae whose text contains the query. It returns results
+// in the same form as history.Grep and reads the same number of matched lines
+// per hypha. Regular expressions cannot use the index, so all hyphae are
+// searched for them.
+func SearchText(
+	query string,
+	opts search.Options,
+	limit int,
+	matchLimit int,
+) (*search.SearchResults, error) {
+	res := search.NewSearchResults()
+	if limit == 0 {
+		return res, nil
+	}
+	pattern, err := opts.Pattern(query)
+	if err != nil {
+		return nil, err
+	}
+
+	indexMutex.RLock()
+	if textIndex == nil {
+		indexMutex.RUnlock()
+		return nil, ErrNoTextIndex
+	}
+	var names []string
+	if opts.Regex {
+		names = textIndex.Candidates("")
+	} else {
+		names = textIndex.Candidates(query)
+	}
+	candidates := make([]ExistingHypha, 0, len(names))
+	for _, name := range names {
+		if h, exists := byNames[name]; exists {
+			candidates = append(candidates, h)
+		}
+	}
+	indexMutex.RUnlock()
+
+	hop := history.ReadOperation()
+	defer hop.Close()
+	for _, h := range candidates {
+		text, err := h.Text(hop)
+		if err != nil {
+			slog.Error("Failed to read hypha text", "hypha", h.CanonicalName(), "err", err)
+			res.Complete = false
+			continue
+		}
+		if matchLimit == 0 {
+			appendName(res, h.CanonicalName(), text, pattern)
+		} else {
+			appendMatches(res, h.CanonicalName(), text, pattern, matchLimit)
+		}
+		if !res.Limit(limit) {
+			break
+		}
+	}
+	return res, nil
+}
+
+// appendName appends the hypha to the results without lines if a line of the
+// text matches the pattern.
+func appendName(
+	res *search.SearchResults,
+	hyphaName string,
+	text string,
+	pattern *regexp.Regexp,
+) {
+	for _, line := range strings.Split(text, "\n") {
+		if pattern.MatchString(line) {
+			res.Append(hyphaName, nil, 0, 0, 0)
+			return
+		}
+	}
+}
+
+// appendMatches appends lines of the text matching the pattern to the results,
+// with context lines around them. Like grep, it stops after matchLimit
+// matched lines unless it is negative, so that hits are counted the same way
+// with both search types.
+func appendMatches(
+	res *search.SearchResults,
+	hyphaName string,
+	text string,
+	pattern *regexp.Regexp,
+	matchLimit int,
+) {
+	var (
+		lines   = strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+		context = int(cfg.FullTextContextLines)
+		// next is the index of the first line not appended yet
+		next = 0
+		// after is the index of the last line in the context of a match
+		after = -1
+		matched = 0
+		limit   = uint(max(matchLimit, 0))
+	)
+	for i, line := range lines {
+		if matchLimit > 0 && matched >= matchLimit {
+			// Only the context of the last match is left
+			if i > after {
+				break
+			}
+			res.AppendContext(hyphaName, line, i + 1, cfg.FullTextLineLength)
+			continue
+		}
+		parts := search.MatchLine(line, pattern)
+		if parts == nil {
+			if i <= after {
+				res.AppendContext(hyphaName, line, i + 1, cfg.FullTextLineLength)
+				next = i + 1
+			}
+			continue
+		}
+		for j := max(next, i - context); j < i; j++ {
+			res.AppendContext(hyphaName, lines[j], j + 1, cfg.FullTextLineLength)
+		}
+		res.Append(
+			hyphaName,
+			parts,
+			i + 1,
+			cfg.FullTextLineLength,
+			limit,
+		)
+		matched++
+		next, after = i + 1, i + context
+	}
+}
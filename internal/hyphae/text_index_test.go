@@ -0,0 +1,235 @@
+package hyphae
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/bouncepaw/mycorrhiza/history"
+	"github.com/bouncepaw/mycorrhiza/internal/cfg"
+	"github.com/bouncepaw/mycorrhiza/internal/files"
+	"github.com/bouncepaw/mycorrhiza/internal/search"
+	"github.com/bouncepaw/mycorrhiza/util"
+)
+
+// textIndexFixture is a small wiki. Files are named after hyphae.
+var textIndexFixture = map[string]string{
+	"apple": "= Apples\nApples are red.\nAn apple a day.\n\nGreen apples too.\nA pineapple is not an apple.\nThe end.\n",
+	"recipes/apple_pie": "= Apple pie\nTake six APPLES.\nBake them.\n",
+	"banana": "Bananas are yellow.\nThere are no apples here\n",
+	"cherry": "Nothing to see.\n",
+	"free": "free software is free\nsoftware\n\nfree\nsoftware freedom\n",
+}
+
+// useTestWiki writes the fixture to a temporary wiki, commits it, because
+// grep only searches committed files, and indexes it.
+func useTestWiki(t *testing.T) {
+	t.Helper()
+	var (
+		wikiDir     = cfg.WikiDir
+		fullText    = cfg.FullTextSearch
+		context     = cfg.FullTextContextLines
+		lineLength  = cfg.FullTextLineLength
+		ignoreMedia = cfg.GrepIgnoreMedia
+	)
+	t.Cleanup(func() {
+		cfg.WikiDir, cfg.FullTextSearch = wikiDir, fullText
+		cfg.FullTextContextLines, cfg.FullTextLineLength = context, lineLength
+		cfg.GrepIgnoreMedia = ignoreMedia
+		indexMutex.Lock()
+		hyphae, byNames, backlinksByName, textIndex = nil, nil, nil, nil
+		indexMutex.Unlock()
+	})
+	cfg.WikiDir = t.TempDir()
+	cfg.FullTextSearch = cfg.FullTextIndex
+	cfg.FullTextContextLines = 1
+	cfg.FullTextLineLength = -1
+	cfg.GrepIgnoreMedia = true
+	if err := files.PrepareWikiRoot(); err != nil {
+		t.Fatal(err)
+	}
+	if err := history.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if err := history.InitGitRepo(); err != nil {
+		t.Fatal(err)
+	}
+
+	hop := history.Operation()
+	var paths []string
+	for name, text := range textIndexFixture {
+		path := filepath.Join(files.HyphaeDir(), name + ".myco")
+		if err := os.MkdirAll(filepath.Dir(path), 0770); err != nil {
+			t.Fatal(err)
+		}
+		if err := hop.WriteFile(path, []byte(text)); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	if hop.WithFiles(paths...).WithMsg("Add the fixture").Apply(); hop.HasError() {
+		t.Fatal(hop.Err())
+	}
+	if err := Index(files.HyphaeDir()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// checkSearchText compares results of the index with those of grep.
+func checkSearchText(t *testing.T, query string, opts search.Options, matchLimit int) {
+	t.Helper()
+	got, err := SearchText(query, opts, -1, matchLimit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := history.Grep(query, opts, -1, matchLimit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Grep finds files in the order of paths, the index in the order of names
+	byHypha := func(a, b *search.SearchResult) int {
+		return util.PathographicCompare(a.Hypha, b.Hypha)
+	}
+	slices.SortFunc(got.Hyphae, byHypha)
+	slices.SortFunc(want.Hyphae, byHypha)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf(
+			"SearchText(%q, %+v, %d) differs from grep:\n%s\nwant:\n%s",
+			query, opts, matchLimit, dumpResults(got), dumpResults(want),
+		)
+	}
+}
+
+func dumpResults(res *search.SearchResults) string {
+	var b strings.Builder
+	for _, r := range res.Hyphae {
+		b.WriteString(r.Hypha + ":\n")
+		for _, s := range r.Lines {
+			b.WriteString("\t" + strings.Join(s.Before, " / ") + " | ")
+			b.WriteString(strings.Join(s.Line, "*") + " | ")
+			b.WriteString(strings.Join(s.After, " / ") + "\n")
+		}
+	}
+	return b.String()
+}
+
+func TestSearchTextLikeGrep(t *testing.T) {
+	useTestWiki(t)
+	tests := []struct {
+		query string
+		opts  search.Options
+	}{
+		{"apple", search.Options{}},
+		{"APPLE", search.Options{}},
+		{"Apple", search.Options{CaseSensitive: true}},
+		{"app", search.Options{}},
+		{"free software", search.Options{}},
+		{"software free", search.Options{}},
+		{"e", search.Options{}},
+		{"no such text", search.Options{}},
+		{"appl(e|es)$", search.Options{Regex: true}},
+		{"^[a-z]+$", search.Options{Regex: true, CaseSensitive: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			for _, matchLimit := range []int{-1, 0, 1, 2} {
+				checkSearchText(t, tt.query, tt.opts, matchLimit)
+			}
+		})
+	}
+}
+
+func TestSearchTextLimits(t *testing.T) {
+	useTestWiki(t)
+	res, err := SearchText("apple", search.Options{}, -1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range res.Hyphae {
+		if r.Hits > 2 || len(r.Lines) > 2 {
+			t.Errorf("%s has %d hits and %d lines, want at most 2", r.Hypha, r.Hits, len(r.Lines))
+		}
+	}
+	res, err = SearchText("apple", search.Options{}, 2, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Hyphae) != 2 || res.Complete {
+		t.Errorf("%d hyphae, complete: %v, want 2 and false", len(res.Hyphae), res.Complete)
+	}
+}
+
+// TestSearchTextRenameDelete checks that the index follows hyphae renamed
+// and deleted the way the wiki does it.
+func TestSearchTextRenameDelete(t *testing.T) {
+	useTestWiki(t)
+	rename := func(oldName, newName string) {
+		t.Helper()
+		h := ByName(oldName).(ExistingHypha)
+		renamed := h.WithName(newName)
+		hop := history.Operation()
+		text, err := h.Text(hop)
+		if err != nil {
+			hop.Abort()
+			t.Fatal(err)
+		}
+		hop.
+			WithFilesRenamed(util.NewRenamingPair(h.TextFilePath(), renamed.TextFilePath())).
+			WithMsg("Rename").
+			Apply()
+		if hop.HasError() {
+			t.Fatal(hop.Err())
+		}
+		IndexOperation().WithHyphaRenamed(h, renamed, text).Apply()
+	}
+	remove := func(name string) {
+		t.Helper()
+		h := ByName(name).(ExistingHypha)
+		hop := history.Operation()
+		text, err := h.Text(hop)
+		if err != nil {
+			hop.Abort()
+			t.Fatal(err)
+		}
+		hop.
+			WithFilesRemoved(h.FilePaths()...).
+			WithMsg("Delete").
+			Apply()
+		if hop.HasError() {
+			t.Fatal(hop.Err())
+		}
+		IndexOperation().WithHyphaDeleted(h, text).Apply()
+	}
+	check := func(wantHyphae ...string) {
+		t.Helper()
+		for _, query := range []string{"apple", "pie", "bake"} {
+			for _, matchLimit := range []int{-1, 0, 1} {
+				checkSearchText(t, query, search.Options{}, matchLimit)
+			}
+		}
+		res, err := SearchText("apple", search.Options{}, -1, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, r := range res.Hyphae {
+			got = append(got, r.Hypha)
+		}
+		if !slices.Equal(got, wantHyphae) {
+			t.Errorf("found %q, want %q", got, wantHyphae)
+		}
+	}
+
+	check("apple", "banana", "recipes/apple_pie")
+	rename("recipes/apple_pie", "pie")
+	check("apple", "banana", "pie")
+	remove("pie")
+	check("apple", "banana")
+	// The old name does not come back
+	if names := textIndex.Candidates("bake"); len(names) != 0 {
+		t.Errorf("the index still has %q", names)
+	}
+}
@@ -0,0 +1,329 @@
+// Package oidc implements logging in with an OpenID Connect provider.
+//
+// The authorization code flow with PKCE is used. The provider configuration is
+// discovered from the issuer URL and cached, so is the provider key set.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bouncepaw/mycorrhiza/internal/cfg"
+	"github.com/bouncepaw/mycorrhiza/internal/user"
+	"github.com/bouncepaw/mycorrhiza/util"
+)
+
+var (
+	ErrState    = errors.New("the login attempt is unknown or expired")
+	ErrToken    = errors.New("invalid ID token")
+	ErrUsername = errors.New("the provider did not tell the username")
+)
+
+// pendingLoginDuration is how long the user has to log in at the provider.
+const pendingLoginDuration = 10 * time.Minute
+
+// Identity is the user as told by the provider.
+type Identity struct {
+	// Issuer and Subject identify the user at the provider. Unlike the
+	// username, they never change.
+	Issuer  string
+	Subject string
+	// Username is the canonical name the user wants to have on the wiki. It
+	// is used only to name new users, and it may be empty.
+	Username string
+	// Group is the most powerful wiki group mapped from the provider groups
+	// of the user, or an empty string if none is mapped.
+	Group string
+	// GroupsKnown is true if the provider told the groups of the user and
+	// OIDCGroupMapping is set. Then Group is authoritative.
+	GroupsKnown bool
+}
+
+// discovery is the provider configuration.
+type discovery struct {
+	Issuer                   string   `json:"issuer"`
+	AuthorizationEndpoint    string   `json:"authorization_endpoint"`
+	TokenEndpoint            string   `json:"token_endpoint"`
+	UserinfoEndpoint         string   `json:"userinfo_endpoint"`
+	JWKSURI                  string   `json:"jwks_uri"`
+	TokenEndpointAuthMethods []string `json:"token_endpoint_auth_methods_supported"`
+}
+
+type pendingLogin struct {
+	nonce    string
+	verifier string
+	expires  time.Time
+}
+
+var (
+	client = &http.Client{Timeout: 10 * time.Second}
+
+	providerMutex sync.Mutex
+	provider      *discovery
+
+	pendingMutex sync.Mutex
+	pending      = make(map[string]pendingLogin)
+)
+
+// RedirectURI is where the provider sends the user back to.
+func RedirectURI() string {
+	return strings.TrimSuffix(cfg.URL, "/") + "/oidc-callback"
+}
+
+// Start begins a login. The user should be redirected to the returned
+// address, and the state should be remembered till the callback.
+func Start(ctx context.Context) (addr string, state string, err error) {
+	p, err := discover(ctx)
+	if err != nil {
+		return "", "", err
+	}
+	var (
+		nonce     = randomString()
+		verifier  = randomString()
+		challenge = sha256.Sum256([]byte(verifier))
+	)
+	state = randomString()
+
+	pendingMutex.Lock()
+	now := time.Now()
+	for s, login := range pending {
+		if now.After(login.expires) {
+			delete(pending, s)
+		}
+	}
+	pending[state] = pendingLogin{nonce, verifier, now.Add(pendingLoginDuration)}
+	pendingMutex.Unlock()
+
+	u, err := url.Parse(p.AuthorizationEndpoint)
+	if err != nil {
+		return "", "", err
+	}
+	q := u.Query()
+	q.Set("response_type", "code")
+	q.Set("client_id", cfg.OIDCClientID)
+	q.Set("redirect_uri", RedirectURI())
+	q.Set("scope", strings.Join(append([]string{"openid"}, cfg.OIDCScopes...), " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	q.Set("code_challenge_method", "S256")
+	u.RawQuery = q.Encode()
+	return u.String(), state, nil
+}
+
+// Finish ends the login started with the state. The code is the one the
+// provider passed to the callback.
+func Finish(ctx context.Context, state, code string) (Identity, error) {
+	pendingMutex.Lock()
+	login, ok := pending[state]
+	delete(pending, state)
+	pendingMutex.Unlock()
+	if !ok || time.Now().After(login.expires) {
+		return Identity{}, ErrState
+	}
+
+	p, err := discover(ctx)
+	if err != nil {
+		return Identity{}, err
+	}
+	tokens, err := exchangeCode(ctx, p, code, login.verifier)
+	if err != nil {
+		return Identity{}, err
+	}
+	claims, err := verifyIDToken(ctx, p, tokens.IDToken)
+	if err != nil {
+		return Identity{}, err
+	}
+	if nonce, _ := claims["nonce"].(string); nonce != login.nonce {
+		return Identity{}, fmt.Errorf("%w: wrong nonce", ErrToken)
+	}
+
+	// Providers may leave some claims out of the ID token
+	_, hasUsername := claims[cfg.OIDCUsernameClaim]
+	_, hasGroups := claims[cfg.OIDCGroupsClaim]
+	if (!hasUsername || !hasGroups) && p.UserinfoEndpoint != "" && tokens.AccessToken != "" {
+		info, err := userinfo(ctx, p, tokens.AccessToken)
+		if err != nil {
+			return Identity{}, err
+		}
+		if info["sub"] != claims["sub"] {
+			return Identity{}, errors.New("userinfo is about another user")
+		}
+		for k, v := range info {
+			if _, ok := claims[k]; !ok {
+				claims[k] = v
+			}
+		}
+	}
+	return identityFromClaims(claims)
+}
+
+func identityFromClaims(claims map[string]any) (Identity, error) {
+	iss, _ := claims["iss"].(string)
+	sub, _ := claims["sub"].(string)
+	username, _ := claims[cfg.OIDCUsernameClaim].(string)
+	username = util.CanonicalName(username)
+
+	var providerGroups []string
+	groupsClaim, hasGroups := claims[cfg.OIDCGroupsClaim]
+	switch groups := groupsClaim.(type) {
+	case string:
+		providerGroups = []string{groups}
+	case []any:
+		for _, g := range groups {
+			if g, ok := g.(string); ok {
+				providerGroups = append(providerGroups, g)
+			}
+		}
+	}
+	var best *user.Group
+	for _, pg := range providerGroups {
+		name, ok := cfg.OIDCGroups[pg]
+		if !ok {
+			continue
+		}
+		g, err := user.GroupByName(name)
+		if err != nil {
+			return Identity{}, err
+		}
+		if best == nil || user.CompareGroups(g, *best) > 0 {
+			best = &g
+		}
+	}
+	res := Identity{
+		Issuer:      iss,
+		Subject:     sub,
+		Username:    username,
+		GroupsKnown: hasGroups && len(cfg.OIDCGroups) > 0,
+	}
+	if best != nil {
+		res.Group = best.Name()
+	}
+	return res, nil
+}
+
+// discover returns the provider configuration, fetching it the first time.
+func discover(ctx context.Context) (*discovery, error) {
+	providerMutex.Lock()
+	defer providerMutex.Unlock()
+	if provider != nil {
+		return provider, nil
+	}
+
+	var p discovery
+	addr := strings.TrimSuffix(cfg.OIDCIssuer, "/") + "/.well-known/openid-configuration"
+	if err := getJSON(ctx, addr, "", &p); err != nil {
+		return nil, fmt.Errorf("failed to discover the provider: %w", err)
+	}
+	switch {
+	case p.Issuer != cfg.OIDCIssuer:
+		return nil, fmt.Errorf("the provider calls itself %s, not %s", p.Issuer, cfg.OIDCIssuer)
+	case p.AuthorizationEndpoint == "" || p.TokenEndpoint == "" || p.JWKSURI == "":
+		return nil, errors.New("the provider configuration lacks endpoints")
+	}
+	provider = &p
+	return provider, nil
+}
+
+type tokenResponse struct {
+	IDToken          string `json:"id_token"`
+	AccessToken      string `json:"access_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+func exchangeCode(ctx context.Context, p *discovery, code, verifier string) (tokenResponse, error) {
+	var res tokenResponse
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {RedirectURI()},
+		"code_verifier": {verifier},
+	}
+	// client_secret_basic is the default method
+	basic := cfg.OIDCClientSecret != "" &&
+		(len(p.TokenEndpointAuthMethods) == 0 || slices.Contains(p.TokenEndpointAuthMethods, "client_secret_basic"))
+	switch {
+	case basic:
+	case cfg.OIDCClientSecret != "":
+		form.Set("client_id", cfg.OIDCClientID)
+		form.Set("client_secret", cfg.OIDCClientSecret)
+	default:
+		form.Set("client_id", cfg.OIDCClientID)
+	}
+
+	rq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return res, err
+	}
+	rq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rq.Header.Set("Accept", "application/json")
+	if basic {
+		rq.SetBasicAuth(url.QueryEscape(cfg.OIDCClientID), url.QueryEscape(cfg.OIDCClientSecret))
+	}
+	resp, err := client.Do(rq)
+	if err != nil {
+		return res, err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&res); err != nil {
+		return res, fmt.Errorf("failed to read the token response: %w", err)
+	}
+	switch {
+	case res.Error != "":
+		return res, fmt.Errorf("the provider refused to give tokens: %s %s", res.Error, res.ErrorDescription)
+	case resp.StatusCode != http.StatusOK:
+		return res, fmt.Errorf("the token endpoint returned %s", resp.Status)
+	case res.IDToken == "":
+		return res, errors.New("the provider did not give an ID token")
+	}
+	return res, nil
+}
+
+func userinfo(ctx context.Context, p *discovery, accessToken string) (map[string]any, error) {
+	var res map[string]any
+	if err := getJSON(ctx, p.UserinfoEndpoint, accessToken, &res); err != nil {
+		return nil, fmt.Errorf("failed to get userinfo: %w", err)
+	}
+	return res, nil
+}
+
+// getJSON decodes the JSON at the address. The bearer token is sent if it is
+// not empty.
+func getJSON(ctx context.Context, addr, bearer string, v any) error {
+	rq, err := http.NewRequestWithContext(ctx, http.MethodGet, addr, nil)
+	if err != nil {
+		return err
+	}
+	rq.Header.Set("Accept", "application/json")
+	if bearer != "" {
+		rq.Header.Set("Authorization", "Bearer "+bearer)
+	}
+	resp, err := client.Do(rq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", addr, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
+
+func randomString() string {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
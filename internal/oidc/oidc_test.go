@@ -0,0 +1,371 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bouncepaw/mycorrhiza/internal/cfg"
+)
+
+const (
+	testClientID     = "wiki"
+	testClientSecret = "secret"
+	testKeyID        = "key-1"
+)
+
+// testIssuer is a local OpenID Connect provider. Codes are handed out with
+// authorize instead of a login page.
+type testIssuer struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	mutex sync.Mutex
+	codes map[string]testCode
+	// claims returns the claims of the ID token given for the code.
+	claims func(code testCode) map[string]any
+}
+
+type testCode struct {
+	nonce     string
+	challenge string
+	method    string
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iss := &testIssuer{key: key, codes: make(map[string]testCode)}
+	iss.claims = func(code testCode) map[string]any {
+		return iss.validClaims(code.nonce)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, rq *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"issuer":                 iss.URL,
+			"authorization_endpoint": iss.URL + "/authorize",
+			"token_endpoint":         iss.URL + "/token",
+			"jwks_uri":               iss.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, rq *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": []any{map[string]string{
+			"kty": "RSA",
+			"kid": testKeyID,
+			"use": "sig",
+			"n":   b64(key.N.Bytes()),
+			"e":   b64(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", iss.handleToken)
+	iss.Server = httptest.NewServer(mux)
+
+	cfg.URL = "http://wiki.example.org"
+	cfg.OIDCIssuer = iss.URL
+	cfg.OIDCClientID = testClientID
+	cfg.OIDCClientSecret = testClientSecret
+	cfg.OIDCUsernameClaim = "preferred_username"
+	cfg.OIDCGroupsClaim = "groups"
+	cfg.OIDCGroups = map[string]string{}
+	resetCaches()
+	t.Cleanup(func() {
+		iss.Close()
+		resetCaches()
+	})
+	return iss
+}
+
+func resetCaches() {
+	providerMutex.Lock()
+	provider = nil
+	providerMutex.Unlock()
+	keysMutex.Lock()
+	keys = nil
+	keysMutex.Unlock()
+	pendingMutex.Lock()
+	pending = make(map[string]pendingLogin)
+	pendingMutex.Unlock()
+}
+
+// authorize plays the login at the provider: it reads the authorization
+// request made by Start and returns the state and a code for it.
+func (iss *testIssuer) authorize(t *testing.T, addr string) (state, code string) {
+	t.Helper()
+	u, err := url.Parse(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if got := q.Get("client_id"); got != testClientID {
+		t.Errorf("client_id = %q, want %q", got, testClientID)
+	}
+	if got := q.Get("redirect_uri"); got != "http://wiki.example.org/oidc-callback" {
+		t.Errorf("redirect_uri = %q", got)
+	}
+	code = randomString()
+	iss.mutex.Lock()
+	iss.codes[code] = testCode{
+		nonce:     q.Get("nonce"),
+		challenge: q.Get("code_challenge"),
+		method:    q.Get("code_challenge_method"),
+	}
+	iss.mutex.Unlock()
+	return q.Get("state"), code
+}
+
+func (iss *testIssuer) handleToken(w http.ResponseWriter, rq *http.Request) {
+	refuse := func(reason string) {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"error":             "invalid_grant",
+			"error_description": reason,
+		})
+	}
+	if err := rq.ParseForm(); err != nil {
+		refuse(err.Error())
+		return
+	}
+	id, secret, _ := rq.BasicAuth()
+	if id != testClientID || secret != testClientSecret {
+		refuse("bad client")
+		return
+	}
+	iss.mutex.Lock()
+	code, ok := iss.codes[rq.PostForm.Get("code")]
+	delete(iss.codes, rq.PostForm.Get("code"))
+	iss.mutex.Unlock()
+	if !ok {
+		refuse("unknown code")
+		return
+	}
+	sum := sha256.Sum256([]byte(rq.PostForm.Get("code_verifier")))
+	if code.method != "S256" || b64(sum[:]) != code.challenge {
+		refuse("PKCE verification failed")
+		return
+	}
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"id_token":   iss.sign(iss.claims(code)),
+		"token_type": "Bearer",
+	})
+}
+
+func (iss *testIssuer) validClaims(nonce string) map[string]any {
+	return map[string]any{
+		"iss":                iss.URL,
+		"aud":                testClientID,
+		"sub":                "subject-1",
+		"exp":                time.Now().Add(time.Hour).Unix(),
+		"nonce":              nonce,
+		"preferred_username": "Alice Liddell",
+	}
+}
+
+func (iss *testIssuer) sign(claims map[string]any) string {
+	return signRS256(iss.key, testKeyID, claims)
+}
+
+func signRS256(key *rsa.PrivateKey, kid string, claims map[string]any) string {
+	signed := segment(map[string]string{"alg": "RS256", "kid": kid, "typ": "JWT"}) + "." + segment(claims)
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		panic(err)
+	}
+	return signed + "." + b64(sig)
+}
+
+func segment(v any) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return b64(b)
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	iss := newTestIssuer(t)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	with := func(changes map[string]any) map[string]any {
+		claims := iss.validClaims("nonce")
+		for k, v := range changes {
+			if v == nil {
+				delete(claims, k)
+			} else {
+				claims[k] = v
+			}
+		}
+		return claims
+	}
+	unsigned := segment(map[string]string{"alg": "none", "kid": testKeyID}) + "." + segment(with(nil)) + "."
+	hsSigned := segment(map[string]string{"alg": "HS256", "kid": testKeyID}) + "." + segment(with(nil))
+	mac := hmac.New(sha256.New, []byte(testClientSecret))
+	mac.Write([]byte(hsSigned))
+	hsSigned += "." + b64(mac.Sum(nil))
+	// The claims of one token with the signature of another
+	valid := iss.sign(with(nil))
+	tampered := segment(map[string]string{"alg": "RS256", "kid": testKeyID, "typ": "JWT"}) + "." +
+		segment(with(map[string]any{"sub": "admin"})) + valid[strings.LastIndex(valid, "."):]
+
+	tests := []struct {
+		name  string
+		token string
+		ok    bool
+	}{
+		{"valid", iss.sign(with(nil)), true},
+		{"audience list with azp", iss.sign(with(map[string]any{"aud": []string{testClientID, "other"}, "azp": testClientID})), true},
+		{"bad signature", signRS256(otherKey, testKeyID, with(nil)), false},
+		{"unknown key", signRS256(iss.key, "key-2", with(nil)), false},
+		{"tampered claims", tampered, false},
+		{"wrong audience", iss.sign(with(map[string]any{"aud": "other"})), false},
+		{"no audience", iss.sign(with(map[string]any{"aud": nil})), false},
+		{"audience list without azp", iss.sign(with(map[string]any{"aud": []string{testClientID, "other"}})), false},
+		{"wrong azp", iss.sign(with(map[string]any{"azp": "other"})), false},
+		{"wrong issuer", iss.sign(with(map[string]any{"iss": "https://evil.example.org"})), false},
+		{"expired", iss.sign(with(map[string]any{"exp": time.Now().Add(-time.Hour).Unix()})), false},
+		{"no expiration", iss.sign(with(map[string]any{"exp": nil})), false},
+		{"no subject", iss.sign(with(map[string]any{"sub": nil})), false},
+		{"alg none", unsigned, false},
+		{"alg HS256", hsSigned, false},
+		{"malformed", "not.a-token", false},
+	}
+
+	p, err := discover(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := verifyIDToken(context.Background(), p, tt.token)
+			switch {
+			case tt.ok && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case tt.ok && claims["sub"] != "subject-1":
+				t.Errorf("sub = %v", claims["sub"])
+			case !tt.ok && err == nil:
+				t.Errorf("token accepted")
+			}
+		})
+	}
+}
+
+func TestStartFinish(t *testing.T) {
+	iss := newTestIssuer(t)
+	ctx := context.Background()
+
+	addr, state, err := Start(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotState, code := iss.authorize(t, addr)
+	if gotState != state {
+		t.Fatalf("state in the request = %q, want %q", gotState, state)
+	}
+	id, err := Finish(ctx, state, code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Identity{Issuer: iss.URL, Subject: "subject-1", Username: "alice_liddell"}
+	if id != want {
+		t.Errorf("identity = %+v, want %+v", id, want)
+	}
+
+	// A state works once
+	if _, err := Finish(ctx, state, code); !errors.Is(err, ErrState) {
+		t.Errorf("second Finish: err = %v, want %v", err, ErrState)
+	}
+}
+
+func TestFinishUnknownState(t *testing.T) {
+	iss := newTestIssuer(t)
+	ctx := context.Background()
+
+	addr, _, err := Start(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, code := iss.authorize(t, addr)
+	if _, err := Finish(ctx, "forged", code); !errors.Is(err, ErrState) {
+		t.Errorf("err = %v, want %v", err, ErrState)
+	}
+}
+
+func TestFinishExpiredState(t *testing.T) {
+	iss := newTestIssuer(t)
+	ctx := context.Background()
+
+	addr, state, err := Start(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, code := iss.authorize(t, addr)
+	pendingMutex.Lock()
+	login := pending[state]
+	login.expires = time.Now().Add(-time.Second)
+	pending[state] = login
+	pendingMutex.Unlock()
+	if _, err := Finish(ctx, state, code); !errors.Is(err, ErrState) {
+		t.Errorf("err = %v, want %v", err, ErrState)
+	}
+}
+
+// TestFinishPKCE checks that the code is useless without the verifier kept
+// by the wiki, as if it was intercepted and redeemed in another login.
+func TestFinishPKCE(t *testing.T) {
+	iss := newTestIssuer(t)
+	ctx := context.Background()
+
+	addr, _, err := Start(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, code := iss.authorize(t, addr)
+	_, otherState, err := Start(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Finish(ctx, otherState, code); err == nil {
+		t.Error("the code was redeemed with another verifier")
+	}
+}
+
+func TestFinishWrongNonce(t *testing.T) {
+	iss := newTestIssuer(t)
+	ctx := context.Background()
+	iss.claims = func(code testCode) map[string]any {
+		return iss.validClaims("replayed-nonce")
+	}
+
+	addr, state, err := Start(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, code := iss.authorize(t, addr)
+	if _, err := Finish(ctx, state, code); !errors.Is(err, ErrToken) {
+		t.Errorf("err = %v, want %v", err, ErrToken)
+	}
+}
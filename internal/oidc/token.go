@@ -0,0 +1,238 @@
+package oidc
+
+// File `token.go` contains the verification of ID tokens.
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bouncepaw/mycorrhiza/internal/cfg"
+)
+
+// clockSkew is how much the clocks of the wiki and the provider may differ.
+const clockSkew = time.Minute
+
+var (
+	keysMutex sync.Mutex
+	// keys are the provider public keys by their IDs.
+	keys map[string]crypto.PublicKey
+)
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// verifyIDToken checks the signature, issuer, audience and expiration of the
+// token and returns its claims.
+func verifyIDToken(ctx context.Context, p *discovery, token string) (map[string]any, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed", ErrToken)
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrToken, err.Error())
+	}
+	key, err := keyByID(ctx, p, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifySignature(header.Alg, key, parts[0]+"."+parts[1], sig); err != nil {
+		return nil, err
+	}
+
+	var claims map[string]any
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	if iss, _ := claims["iss"].(string); iss != p.Issuer {
+		return nil, fmt.Errorf("%w: issued by %s", ErrToken, iss)
+	}
+	var audience []string
+	switch aud := claims["aud"].(type) {
+	case string:
+		audience = []string{aud}
+	case []any:
+		for _, a := range aud {
+			if a, ok := a.(string); ok {
+				audience = append(audience, a)
+			}
+		}
+	}
+	azp, hasAzp := claims["azp"].(string)
+	switch {
+	case !slices.Contains(audience, cfg.OIDCClientID):
+		return nil, fmt.Errorf("%w: issued for someone else", ErrToken)
+	case (len(audience) > 1 || hasAzp) && azp != cfg.OIDCClientID:
+		return nil, fmt.Errorf("%w: authorized for someone else", ErrToken)
+	}
+	exp, ok := claims["exp"].(float64)
+	if !ok || time.Now().Add(-clockSkew).After(time.Unix(int64(exp), 0)) {
+		return nil, fmt.Errorf("%w: expired", ErrToken)
+	}
+	if _, ok := claims["sub"].(string); !ok {
+		return nil, fmt.Errorf("%w: no subject", ErrToken)
+	}
+	return claims, nil
+}
+
+func verifySignature(alg string, key crypto.PublicKey, signed string, sig []byte) error {
+	var hash crypto.Hash
+	switch alg {
+	case "RS256", "ES256":
+		hash = crypto.SHA256
+	case "RS384", "ES384":
+		hash = crypto.SHA384
+	case "RS512", "ES512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("%w: unsupported algorithm %s", ErrToken, alg)
+	}
+	h := hash.New()
+	h.Write([]byte(signed))
+	digest := h.Sum(nil)
+
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		if alg[0] != 'R' || rsa.VerifyPKCS1v15(key, hash, digest, sig) != nil {
+			return fmt.Errorf("%w: bad signature", ErrToken)
+		}
+	case *ecdsa.PublicKey:
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if alg[0] != 'E' || len(sig) != 2*size {
+			return fmt.Errorf("%w: bad signature", ErrToken)
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(key, digest, r, s) {
+			return fmt.Errorf("%w: bad signature", ErrToken)
+		}
+	default:
+		return fmt.Errorf("%w: unsupported key", ErrToken)
+	}
+	return nil
+}
+
+// keyByID returns the provider key with the ID. The key set is fetched again
+// if there is no such key, because the provider may have rotated its keys.
+// An empty ID is fine if the provider has just one key.
+func keyByID(ctx context.Context, p *discovery, kid string) (crypto.PublicKey, error) {
+	keysMutex.Lock()
+	defer keysMutex.Unlock()
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := getJSON(ctx, p.JWKSURI, "", &set); err != nil {
+		return nil, fmt.Errorf("failed to get the provider keys: %w", err)
+	}
+	keys = make(map[string]crypto.PublicKey)
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		if key, err := jwk.publicKey(); err == nil {
+			keys[jwk.Kid] = key
+		}
+	}
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+	if len(keys) == 1 && kid == "" {
+		for _, key := range keys {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: unknown key %s", ErrToken, kid)
+}
+
+func (jwk jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decodeBigInt(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("bad RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", jwk.Crv)
+		}
+		x, err := decodeBigInt(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("the point is not on the curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %s", jwk.Kty)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+func decodeSegment(segment string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrToken, err.Error())
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("%w: %s", ErrToken, err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,211 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+
+	"github.com/bouncepaw/mycorrhiza/util"
+)
+
+// cyrillicToLatin is a simple transliteration table, good enough for
+// matching hypha names typed with a different keyboard layout in mind.
+var cyrillicToLatin = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e",
+	'ж': "zh", 'з': "z", 'и': "i", 'й': "i", 'к': "k", 'л': "l", 'м': "m",
+	'н': "n", 'о': "o", 'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u",
+	'ф': "f", 'х': "kh", 'ц': "ts", 'ч': "ch", 'ш': "sh", 'щ': "shch",
+	'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "iu", 'я': "ia",
+	'є': "ie", 'і': "i", 'ї': "i", 'ґ': "g", 'ў': "u",
+}
+
+// otherToLatin covers letters that do not decompose into a Latin letter and
+// a diacritic.
+var otherToLatin = map[rune]string{
+	'ß': "ss", 'æ': "ae", 'ø': "o", 'œ': "oe", 'ł': "l", 'đ': "d",
+	'ð': "d", 'þ': "th", 'ı': "i",
+}
+
+var stripDiacritics = transform.Chain(
+	norm.NFD,
+	runes.Remove(runes.In(unicode.Mn)),
+	norm.NFC,
+)
+
+// Transliterate lowercases the string, strips diacritics and transliterates
+// Cyrillic to Latin.
+func Transliterate(s string) string {
+	s = strings.ToLower(s)
+	if stripped, _, err := transform.String(stripDiacritics, s); err == nil {
+		s = stripped
+	}
+	var buf strings.Builder
+	for _, r := range s {
+		if repl, ok := cyrillicToLatin[r]; ok {
+			buf.WriteString(repl)
+		} else if repl, ok := otherToLatin[r]; ok {
+			buf.WriteString(repl)
+		} else {
+			buf.WriteRune(r)
+		}
+	}
+	return buf.String()
+}
+
+// editDistance is the optimal string alignment distance between the strings,
+// which is the Levenshtein distance that also counts adjacent transpositions.
+func editDistance(a, b []rune) int {
+	prev2 := make([]int, len(b) + 1)
+	prev := make([]int, len(b) + 1)
+	curr := make([]int, len(b) + 1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i - 1] == b[j - 1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j] + 1, curr[j - 1] + 1, prev[j - 1] + cost)
+			if i > 1 && j > 1 && a[i - 1] == b[j - 2] && a[i - 2] == b[j - 1] {
+				curr[j] = min(curr[j], prev2[j - 2] + 1)
+			}
+		}
+		prev2, prev, curr = prev, curr, prev2
+	}
+	return prev[len(b)]
+}
+
+// typoBudget is how many typos are tolerated in a word of the given length.
+func typoBudget(length int) int {
+	switch {
+	case length < 4:
+		return 0
+	case length < 8:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// wordScore tells how well a query word matches a name word, from 0 to 1.
+// The name word may be longer, because the query may be typed partially.
+func wordScore(query, word []rune) float64 {
+	if len(word) >= len(query) && string(word[:len(query)]) == string(query) {
+		if len(word) == len(query) {
+			return 1
+		}
+		return 0.9
+	}
+	budget := typoBudget(len(query))
+	if budget == 0 {
+		return 0
+	}
+	d := editDistance(query, word)
+	if len(word) > len(query) {
+		d = min(d, editDistance(query, word[:len(query)]))
+	}
+	if d > budget {
+		return 0
+	}
+	return 0.8 * (1 - float64(d) / float64(len(query) + 1))
+}
+
+func nameWords(name string) [][]rune {
+	var res [][]rune
+	for _, w := range strings.FieldsFunc(name, func(r rune) bool {
+		return r == '_' || r == '/'
+	}) {
+		res = append(res, []rune(w))
+	}
+	return res
+}
+
+// subsequenceScore checks if all query runes occur in the name in order. The
+// score is higher when they are closer to each other, too sparse matches do
+// not count.
+func subsequenceScore(query, name string) float64 {
+	n := utf8.RuneCountInString(query)
+	if n < 3 {
+		return 0
+	}
+	start, pos := -1, 0
+	rest := query
+	for i, r := range name {
+		q, size := utf8.DecodeRuneInString(rest)
+		if q != r {
+			continue
+		}
+		if start < 0 {
+			start = i
+		}
+		rest = rest[size:]
+		if rest == "" {
+			pos = i + size
+			break
+		}
+	}
+	if rest != "" {
+		return 0
+	}
+	density := float64(n) / float64(utf8.RuneCountInString(name[start:pos]))
+	if density < 0.5 {
+		return 0
+	}
+	return density
+}
+
+// FuzzyQuery is a prepared query for fuzzy hypha name matching.
+type FuzzyQuery struct {
+	text  string
+	bare  string
+	words [][]rune
+}
+
+func NewFuzzyQuery(query string) *FuzzyQuery {
+	text := Transliterate(util.CanonicalName(query))
+	return &FuzzyQuery{
+		text:  text,
+		bare:  strings.NewReplacer("_", "", "/", "").Replace(text),
+		words: nameWords(text),
+	}
+}
+
+// Match tells how well the hypha name matches the query, from 0 to 1. Names
+// containing the query score the best, then names whose words match the
+// query words with few typos, then names containing the query letters in the
+// same order.
+func (fq *FuzzyQuery) Match(hyphaName string) (float64, bool) {
+	if fq.text == "" {
+		return 0, false
+	}
+	name := Transliterate(hyphaName)
+	if strings.Contains(name, fq.text) {
+		return TitleMatch(name, fq.text), true
+	}
+	best := 0.0
+	if len(fq.words) > 0 {
+		words := nameWords(name)
+		total := 0.0
+		for _, qw := range fq.words {
+			wordBest := 0.0
+			for _, w := range words {
+				wordBest = max(wordBest, wordScore(qw, w))
+			}
+			if wordBest == 0 {
+				total = 0
+				break
+			}
+			total += wordBest
+		}
+		best = 0.6 * total / float64(len(fq.words))
+	}
+	best = max(best, 0.25 * subsequenceScore(fq.bare, name))
+	return best, best > 0
+}
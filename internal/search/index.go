@@ -0,0 +1,207 @@
+package search
+
+import (
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/bouncepaw/mycorrhiza/util"
+)
+
+// Index is an inverted index of words found in hypha texts. It is not safe
+// for concurrent use, locking is up to the caller.
+type Index struct {
+	// postings maps words to sorted lists of hyphae containing them
+	postings map[string][]string
+	// docs maps hypha names to their sorted lists of words
+	docs map[string][]string
+	// words is the sorted vocabulary, used for substring lookups
+	words []string
+}
+
+func NewIndex() *Index {
+	return &Index{
+		postings: make(map[string][]string),
+		docs:     make(map[string][]string),
+		words:    nil,
+	}
+}
+
+func isWordSeparator(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+}
+
+// Words returns the lowercase words of the text.
+func Words(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), isWordSeparator)
+}
+
+// Add indexes the text of the hypha, replacing the previous one.
+func (idx *Index) Add(hyphaName string, text string) {
+	idx.Remove(hyphaName)
+	words := Words(text)
+	if len(words) == 0 {
+		return
+	}
+	slices.Sort(words)
+	words = slices.Compact(words)
+	idx.docs[hyphaName] = words
+	for _, word := range words {
+		list, exists := idx.postings[word]
+		if !exists {
+			idx.words = util.InsertSorted(idx.words, strings.Compare, word)
+		}
+		idx.postings[word] = util.InsertSorted(
+			list,
+			util.PathographicCompare,
+			hyphaName,
+		)
+	}
+}
+
+// IndexBuilder builds an index of many hyphae at once. It is faster than
+// adding them to an Index one by one, because lists are sorted only once.
+type IndexBuilder struct {
+	idx *Index
+}
+
+func NewIndexBuilder() *IndexBuilder {
+	return &IndexBuilder{idx: NewIndex()}
+}
+
+// Add indexes the text of the hypha. Every hypha can be added only once.
+func (b *IndexBuilder) Add(hyphaName string, text string) {
+	words := Words(text)
+	if len(words) == 0 {
+		return
+	}
+	slices.Sort(words)
+	words = slices.Compact(words)
+	b.idx.docs[hyphaName] = words
+	for _, word := range words {
+		b.idx.postings[word] = append(b.idx.postings[word], hyphaName)
+	}
+}
+
+// Index sorts the lists and returns the built index. The builder must not be
+// used afterwards.
+func (b *IndexBuilder) Index() *Index {
+	idx := b.idx
+	idx.words = make([]string, 0, len(idx.postings))
+	for word, list := range idx.postings {
+		slices.SortFunc(list, util.PathographicCompare)
+		idx.words = append(idx.words, word)
+	}
+	slices.Sort(idx.words)
+	b.idx = nil
+	return idx
+}
+
+// Remove removes the hypha from the index.
+func (idx *Index) Remove(hyphaName string) {
+	words, exists := idx.docs[hyphaName]
+	if !exists {
+		return
+	}
+	delete(idx.docs, hyphaName)
+	for _, word := range words {
+		list := util.DeleteSorted(
+			idx.postings[word],
+			util.PathographicCompare,
+			hyphaName,
+		)
+		if len(list) == 0 {
+			delete(idx.postings, word)
+			idx.words = util.DeleteSorted(idx.words, strings.Compare, word)
+		} else {
+			idx.postings[word] = list
+		}
+	}
+}
+
+// Rename moves the indexed text of the hypha to a new name.
+func (idx *Index) Rename(oldName string, newName string) {
+	words, exists := idx.docs[oldName]
+	if !exists || oldName == newName {
+		return
+	}
+	idx.Remove(newName)
+	delete(idx.docs, oldName)
+	idx.docs[newName] = words
+	for _, word := range words {
+		idx.postings[word] = util.ReplaceSorted(
+			idx.postings[word],
+			util.PathographicCompare,
+			oldName,
+			newName,
+		)
+	}
+}
+
+// containing returns the set of hyphae having a word that contains the
+// given one. The whole vocabulary is scanned, which is still much faster
+// than reading the texts.
+func (idx *Index) containing(word string) map[string]struct{} {
+	res := make(map[string]struct{})
+	for _, w := range idx.words {
+		if !strings.Contains(w, word) {
+			continue
+		}
+		for _, name := range idx.postings[w] {
+			res[name] = struct{}{}
+		}
+	}
+	return res
+}
+
+// Candidates returns a sorted list of hyphae which may contain the query.
+// Every word of the query must be a part of a word in the hypha text, so
+// that the same hyphae are found as with grep, which searches for
+// substrings. If the query has no words, all indexed hyphae are returned.
+func (idx *Index) Candidates(query string) []string {
+	var set map[string]struct{}
+	words := Words(query)
+	if len(words) == 0 {
+		set = make(map[string]struct{}, len(idx.docs))
+		for name := range idx.docs {
+			set[name] = struct{}{}
+		}
+	}
+	for _, word := range words {
+		found := idx.containing(word)
+		if set == nil {
+			set = found
+			continue
+		}
+		for name := range set {
+			if _, ok := found[name]; !ok {
+				delete(set, name)
+			}
+		}
+	}
+	return slices.SortedFunc(maps.Keys(set), util.PathographicCompare)
+}
+
+// MatchLine splits the line into alternating unmatched and matched parts,
+// the same way grep results are split. It returns nil if nothing matches.
+func MatchLine(line string, pattern *regexp.Regexp) SearchResultLine {
+	matches := pattern.FindAllStringIndex(line, -1)
+	if len(matches) == 0 {
+		return nil
+	}
+	res := make(SearchResultLine, 0, 2 * len(matches) + 1)
+	prev := 0
+	for _, m := range matches {
+		if m[0] == m[1] {
+			continue
+		}
+		res = append(res, line[prev:m[0]], line[m[0]:m[1]])
+		prev = m[1]
+	}
+	if len(res) == 0 {
+		return nil
+	}
+	return append(res, line[prev:])
+}
@@ -0,0 +1,120 @@
+package search
+
+import (
+	"reflect"
+	"regexp"
+	"slices"
+	"testing"
+)
+
+var indexTexts = map[string]string{
+	"apple":        "Apples are red.",
+	"fruit/banana": "Bananas are yellow, not red!",
+	"fruit":        "Apple, banana; cherry...",
+	"notes/free":   "Free software",
+	"empty":        "",
+	"punctuation":  "... --- !!!",
+}
+
+func TestIndexBuilder(t *testing.T) {
+	b := NewIndexBuilder()
+	added := NewIndex()
+	for name, text := range indexTexts {
+		b.Add(name, text)
+		added.Add(name, text)
+	}
+	built := b.Index()
+	if !reflect.DeepEqual(built, added) {
+		t.Errorf("built index %+v differs from the one added to: %+v", built, added)
+	}
+	if _, ok := built.docs["empty"]; ok {
+		t.Error("a hypha without words is indexed")
+	}
+}
+
+func TestIndexCandidates(t *testing.T) {
+	b := NewIndexBuilder()
+	for name, text := range indexTexts {
+		b.Add(name, text)
+	}
+	idx := b.Index()
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"apple", []string{"apple", "fruit"}},
+		{"APPLE", []string{"apple", "fruit"}},
+		{"ppl", []string{"apple", "fruit"}},
+		{"red", []string{"apple", "fruit/banana"}},
+		{"banana", []string{"fruit", "fruit/banana"}},
+		{"red banana", []string{"fruit/banana"}},
+		{"apples are", []string{"apple"}},
+		{"free software", []string{"notes/free"}},
+		{"ware fre", []string{"notes/free"}},
+		{"kiwi", nil},
+		{"red kiwi", nil},
+		// Without words anything may match
+		{"!!!", []string{"apple", "fruit", "fruit/banana", "notes/free"}},
+		{"", []string{"apple", "fruit", "fruit/banana", "notes/free"}},
+	}
+	for _, tt := range tests {
+		if got := idx.Candidates(tt.query); !slices.Equal(got, tt.want) {
+			t.Errorf("Candidates(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestIndexChanges(t *testing.T) {
+	idx := NewIndex()
+	idx.Add("a", "one two")
+	idx.Add("b", "two three")
+
+	// Adding again replaces the text
+	idx.Add("a", "four")
+	if got := idx.Candidates("one"); got != nil {
+		t.Errorf("old text is still found: %q", got)
+	}
+	if got := idx.Candidates("two"); !slices.Equal(got, []string{"b"}) {
+		t.Errorf("Candidates(two) = %q", got)
+	}
+
+	idx.Rename("b", "c")
+	if got := idx.Candidates("three"); !slices.Equal(got, []string{"c"}) {
+		t.Errorf("after renaming, Candidates(three) = %q", got)
+	}
+	// Renaming over an existing hypha replaces it
+	idx.Rename("c", "a")
+	if got := idx.Candidates("four"); got != nil {
+		t.Errorf("text of the replaced hypha is still found: %q", got)
+	}
+	if got := idx.Candidates("two"); !slices.Equal(got, []string{"a"}) {
+		t.Errorf("after renaming over, Candidates(two) = %q", got)
+	}
+
+	idx.Remove("a")
+	idx.Remove("no such hypha")
+	if len(idx.docs) != 0 || len(idx.postings) != 0 || len(idx.words) != 0 {
+		t.Errorf("the index is not empty: %+v", idx)
+	}
+}
+
+func TestMatchLine(t *testing.T) {
+	tests := []struct {
+		line    string
+		pattern string
+		want    SearchResultLine
+	}{
+		{"an apple a day", "(?i)apple", []string{"an ", "apple", " a day"}},
+		{"Apple and apple", "(?i)apple", []string{"", "Apple", " and ", "apple", ""}},
+		{"no match", "apple", nil},
+		// Empty matches are skipped like grep does
+		{"abc", "x*", nil},
+		{"axb", "x*", []string{"a", "x", "b"}},
+	}
+	for _, tt := range tests {
+		got := MatchLine(tt.line, regexp.MustCompile(tt.pattern))
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("MatchLine(%q, %q) = %q, want %q", tt.line, tt.pattern, got, tt.want)
+		}
+	}
+}
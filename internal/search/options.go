@@ -0,0 +1,97 @@
+package search
+
+import (
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+)
+
+// Options are the modes of full text search.
+type Options struct {
+	// Regex makes the query a regular expression instead of a literal string.
+	Regex bool
+	// Perl tells if the regular expression has Perl syntax rather than POSIX
+	// extended one.
+	Perl bool
+	// CaseSensitive makes the search respect letter case.
+	CaseSensitive bool
+}
+
+// Pattern compiles a regular expression matching the query with the options.
+// It is used to find and highlight matches in hypha texts. POSIX expressions
+// are read and matched the way grep and git do: with POSIX syntax, choosing
+// the leftmost longest match.
+func (o Options) Pattern(query string) (*regexp.Regexp, error) {
+	if o.Regex && !o.Perl {
+		flags := syntax.POSIX
+		if !o.CaseSensitive {
+			flags |= syntax.FoldCase
+		}
+		re, err := syntax.Parse(query, flags)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrQuerySyntax, err.Error())
+		}
+		// The parsed expression is printed in Go syntax
+		pattern, err := regexp.Compile(re.String())
+		if err != nil {
+			return nil, err
+		}
+		pattern.Longest()
+		return pattern, nil
+	}
+	expr := query
+	if !o.Regex {
+		expr = regexp.QuoteMeta(query)
+	}
+	if !o.CaseSensitive {
+		expr = "(?i)" + expr
+	}
+	return regexp.Compile(expr)
+}
+
+// starHeight is the maximum number of nested repetitions in the expression.
+func starHeight(re *syntax.Regexp) int {
+	height := 0
+	for _, sub := range re.Sub {
+		height = max(height, starHeight(sub))
+	}
+	switch re.Op {
+	case syntax.OpStar, syntax.OpPlus, syntax.OpQuest, syntax.OpRepeat:
+		height++
+	}
+	return height
+}
+
+// ValidateRegex checks if the regular expression is safe to search with.
+// Perl-compatible engines backtrack, so nested repetitions are rejected for
+// them. If maxComplexity is not zero, the compiled program of the expression
+// must have no more instructions. Expressions matching the empty string are
+// rejected too, because they match every line.
+func ValidateRegex(expr string, perl bool, maxComplexity uint) error {
+	flags := syntax.POSIX
+	if perl {
+		flags = syntax.Perl
+	}
+	re, err := syntax.Parse(expr, flags)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrQuerySyntax, err.Error())
+	}
+	if perl && starHeight(re) > 1 {
+		return fmt.Errorf("%w: nested repetitions are not allowed", ErrQuerySyntax)
+	}
+	prog, err := syntax.Compile(re.Simplify())
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrQuerySyntax, err.Error())
+	}
+	if maxComplexity > 0 && uint(len(prog.Inst)) > maxComplexity {
+		return fmt.Errorf("%w: regular expression is too complex", ErrQuerySyntax)
+	}
+	compiled, err := regexp.Compile(expr)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrQuerySyntax, err.Error())
+	}
+	if compiled.MatchString("") {
+		return fmt.Errorf("%w: regular expression matches empty text", ErrQuerySyntax)
+	}
+	return nil
+}
@@ -0,0 +1,331 @@
+package search
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+var ErrQuerySyntax = errors.New("invalid search query")
+
+type QueryKind int
+
+const (
+	// QueryTerm is a literal string to look for in hypha texts.
+	QueryTerm QueryKind = iota
+	// QueryFilter is a key:value condition not related to the text.
+	QueryFilter
+	QueryAnd
+	QueryOr
+	QueryNot
+)
+
+// Filter keys supported in queries.
+const (
+	FilterCategory = "category"
+	FilterPrefix   = "prefix"
+	FilterMedia    = "media"
+	FilterAuthor   = "author"
+)
+
+var filterKeys = []string{FilterCategory, FilterPrefix, FilterMedia, FilterAuthor}
+
+// Query is a node of a parsed search query.
+type Query struct {
+	Kind QueryKind
+	// Key is the filter key for QueryFilter.
+	Key string
+	// Text is the term for QueryTerm and the filter value for QueryFilter.
+	Text string
+	// Args are the operands of QueryAnd, QueryOr and QueryNot.
+	Args []*Query
+}
+
+// IsTerm tells if the whole query is a single text term.
+func (q *Query) IsTerm() bool {
+	return q.Kind == QueryTerm
+}
+
+// Terms returns distinct text terms of the query. If positive is true, terms
+// under an odd number of negations are left out.
+func (q *Query) Terms(positive bool) []string {
+	var res []string
+	q.walk(false, func(node *Query, negated bool) {
+		if node.Kind == QueryTerm && !(positive && negated) {
+			if !slices.Contains(res, node.Text) {
+				res = append(res, node.Text)
+			}
+		}
+	})
+	return res
+}
+
+// Filters returns all filter nodes of the query.
+func (q *Query) Filters() []*Query {
+	var res []*Query
+	q.walk(false, func(node *Query, _ bool) {
+		if node.Kind == QueryFilter {
+			res = append(res, node)
+		}
+	})
+	return res
+}
+
+func (q *Query) walk(negated bool, fn func(*Query, bool)) {
+	fn(q, negated)
+	if q.Kind == QueryNot {
+		negated = !negated
+	}
+	for _, arg := range q.Args {
+		arg.walk(negated, fn)
+	}
+}
+
+// Eval evaluates the query, using match to evaluate terms and filters.
+func (q *Query) Eval(match func(*Query) bool) bool {
+	switch q.Kind {
+	case QueryAnd:
+		for _, arg := range q.Args {
+			if !arg.Eval(match) {
+				return false
+			}
+		}
+		return true
+	case QueryOr:
+		for _, arg := range q.Args {
+			if arg.Eval(match) {
+				return true
+			}
+		}
+		return false
+	case QueryNot:
+		return !q.Args[0].Eval(match)
+	default:
+		return match(q)
+	}
+}
+
+type queryTokenKind int
+
+const (
+	tokenTerm queryTokenKind = iota
+	tokenFilter
+	tokenAnd
+	tokenOr
+	tokenNot
+	tokenMinus
+	tokenOpen
+	tokenClose
+)
+
+type queryToken struct {
+	kind queryTokenKind
+	key  string
+	text string
+}
+
+// readWord reads an unquoted word or a quoted phrase from the start of s.
+func readWord(s string) (word string, rest string, quoted bool, err error) {
+	if s[0] == '"' {
+		end := strings.IndexByte(s[1:], '"')
+		if end < 0 {
+			return "", "", true, fmt.Errorf("%w: unclosed quote", ErrQuerySyntax)
+		}
+		return s[1:end + 1], s[end + 2:], true, nil
+	}
+	end := strings.IndexFunc(s, func(r rune) bool {
+		return unicode.IsSpace(r) || r == '(' || r == ')' || r == '"'
+	})
+	if end < 0 {
+		end = len(s)
+	}
+	return s[:end], s[end:], false, nil
+}
+
+func tokenizeQuery(s string) ([]queryToken, error) {
+	var tokens []queryToken
+	for {
+		s = strings.TrimLeftFunc(s, unicode.IsSpace)
+		if s == "" {
+			return tokens, nil
+		}
+		switch s[0] {
+		case '(':
+			tokens = append(tokens, queryToken{kind: tokenOpen})
+			s = s[1:]
+			continue
+		case ')':
+			tokens = append(tokens, queryToken{kind: tokenClose})
+			s = s[1:]
+			continue
+		case '-':
+			if len(s) > 1 && !unicode.IsSpace(rune(s[1])) {
+				tokens = append(tokens, queryToken{kind: tokenMinus})
+				s = s[1:]
+				continue
+			}
+		}
+		word, rest, quoted, err := readWord(s)
+		if err != nil {
+			return nil, err
+		}
+		s = rest
+		switch {
+		case quoted:
+			tokens = append(tokens, queryToken{kind: tokenTerm, text: word})
+			continue
+		case word == "AND":
+			tokens = append(tokens, queryToken{kind: tokenAnd})
+			continue
+		case word == "OR":
+			tokens = append(tokens, queryToken{kind: tokenOr})
+			continue
+		case word == "NOT":
+			tokens = append(tokens, queryToken{kind: tokenNot})
+			continue
+		}
+		key, value, found := strings.Cut(word, ":")
+		key = strings.ToLower(key)
+		if !found || !slices.Contains(filterKeys, key) {
+			tokens = append(tokens, queryToken{kind: tokenTerm, text: word})
+			continue
+		}
+		if value == "" && s != "" && s[0] == '"' {
+			value, s, _, err = readWord(s)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if value == "" {
+			return nil, fmt.Errorf("%w: empty %s filter", ErrQuerySyntax, key)
+		}
+		tokens = append(tokens, queryToken{kind: tokenFilter, key: key, text: value})
+	}
+}
+
+type queryParser struct {
+	tokens []queryToken
+	pos    int
+}
+
+func (p *queryParser) peek() (queryToken, bool) {
+	if p.pos >= len(p.tokens) {
+		return queryToken{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+func (p *queryParser) parseOr() (*Query, error) {
+	var args []*Query
+	for {
+		arg, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+		if tok, ok := p.peek(); !ok || tok.kind != tokenOr {
+			break
+		}
+		p.pos++
+	}
+	if len(args) == 1 {
+		return args[0], nil
+	}
+	return &Query{Kind: QueryOr, Args: args}, nil
+}
+
+func (p *queryParser) parseAnd() (*Query, error) {
+	var args []*Query
+	for {
+		arg, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+		tok, ok := p.peek()
+		if !ok || tok.kind == tokenOr || tok.kind == tokenClose {
+			break
+		}
+		if tok.kind == tokenAnd {
+			p.pos++
+		}
+	}
+	if len(args) == 1 {
+		return args[0], nil
+	}
+	return &Query{Kind: QueryAnd, Args: args}, nil
+}
+
+func (p *queryParser) parseUnary() (*Query, error) {
+	tok, ok := p.peek()
+	if !ok {
+		return nil, fmt.Errorf("%w: unexpected end of query", ErrQuerySyntax)
+	}
+	p.pos++
+	switch tok.kind {
+	case tokenNot, tokenMinus:
+		arg, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &Query{Kind: QueryNot, Args: []*Query{arg}}, nil
+	case tokenOpen:
+		q, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if tok, ok := p.peek(); !ok || tok.kind != tokenClose {
+			return nil, fmt.Errorf("%w: unclosed parenthesis", ErrQuerySyntax)
+		}
+		p.pos++
+		return q, nil
+	case tokenTerm:
+		if tok.text == "" {
+			return nil, fmt.Errorf("%w: empty phrase", ErrQuerySyntax)
+		}
+		return &Query{Kind: QueryTerm, Text: tok.text}, nil
+	case tokenFilter:
+		return &Query{Kind: QueryFilter, Key: tok.key, Text: tok.text}, nil
+	default:
+		return nil, fmt.Errorf("%w: misplaced operator", ErrQuerySyntax)
+	}
+}
+
+// ParseQuery parses a search query. Words and "quoted phrases" are looked up
+// literally. Adjacent terms must all match, OR and NOT (or a leading minus)
+// combine them otherwise, and parentheses group them. Filters have the form
+// key:value, see the Filter constants for supported keys. A query that does
+// not follow this syntax, like an unclosed quote or parenthesis, is looked up
+// literally as a whole. Only an empty query is an error.
+func ParseQuery(query string) (*Query, error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return nil, fmt.Errorf("%w: empty query", ErrQuerySyntax)
+	}
+	q, err := parseQuery(query)
+	if errors.Is(err, ErrQuerySyntax) {
+		return &Query{Kind: QueryTerm, Text: query}, nil
+	}
+	return q, err
+}
+
+func parseQuery(query string) (*Query, error) {
+	tokens, err := tokenizeQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("%w: empty query", ErrQuerySyntax)
+	}
+	p := queryParser{tokens: tokens}
+	q, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(tokens) {
+		return nil, fmt.Errorf("%w: unexpected closing parenthesis", ErrQuerySyntax)
+	}
+	return q, nil
+}
@@ -0,0 +1,161 @@
+package search
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// String writes the query in prefix notation, for comparing parse trees.
+func (q *Query) String() string {
+	switch q.Kind {
+	case QueryTerm:
+		return fmt.Sprintf("%q", q.Text)
+	case QueryFilter:
+		return fmt.Sprintf("%s:%q", q.Key, q.Text)
+	}
+	var args []string
+	for _, arg := range q.Args {
+		args = append(args, arg.String())
+	}
+	op := map[QueryKind]string{QueryAnd: "AND", QueryOr: "OR", QueryNot: "NOT"}[q.Kind]
+	return "(" + op + " " + strings.Join(args, " ") + ")"
+}
+
+func TestTokenizeQuery(t *testing.T) {
+	term := func(text string) queryToken { return queryToken{kind: tokenTerm, text: text} }
+	var (
+		minus = queryToken{kind: tokenMinus}
+		open  = queryToken{kind: tokenOpen}
+		close = queryToken{kind: tokenClose}
+		or    = queryToken{kind: tokenOr}
+		not   = queryToken{kind: tokenNot}
+	)
+	tests := []struct {
+		query   string
+		want    []queryToken
+		wantErr bool
+	}{
+		{"", nil, false},
+		{"foo bar", []queryToken{term("foo"), term("bar")}, false},
+		{"-foo", []queryToken{minus, term("foo")}, false},
+		{"-(foo OR bar)", []queryToken{minus, open, term("foo"), or, term("bar"), close}, false},
+		{`-"free software"`, []queryToken{minus, term("free software")}, false},
+		{"NOT(foo)", []queryToken{not, open, term("foo"), close}, false},
+		{"-", []queryToken{term("-")}, false},
+		{"foo - bar", []queryToken{term("foo"), term("-"), term("bar")}, false},
+		{"well-known", []queryToken{term("well-known")}, false},
+		{"category:recipes", []queryToken{{kind: tokenFilter, key: FilterCategory, text: "recipes"}}, false},
+		{`Category:"to do"`, []queryToken{{kind: tokenFilter, key: FilterCategory, text: "to do"}}, false},
+		{"http://example.org", []queryToken{term("http://example.org")}, false},
+		{`say "hi`, nil, true},
+		{"category:", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			tokens, err := tokenizeQuery(tt.query)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error: %v", err, tt.wantErr)
+			}
+			if !slices.Equal(tokens, tt.want) {
+				t.Errorf("tokens = %+v, want %+v", tokens, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"foo", `"foo"`},
+		{"foo bar", `(AND "foo" "bar")`},
+		{"foo AND bar", `(AND "foo" "bar")`},
+		{"foo OR bar baz", `(OR "foo" (AND "bar" "baz"))`},
+		{"NOT foo bar", `(AND (NOT "foo") "bar")`},
+		{"-foo", `(NOT "foo")`},
+		{"-(foo OR bar)", `(NOT (OR "foo" "bar"))`},
+		{"NOT (foo OR bar)", `(NOT (OR "foo" "bar"))`},
+		{`-"free software"`, `(NOT "free software")`},
+		{`baz -"free software"`, `(AND "baz" (NOT "free software"))`},
+		{"--foo", `(NOT (NOT "foo"))`},
+		{"(kubernetes OR k8s) -helm", `(AND (OR "kubernetes" "k8s") (NOT "helm"))`},
+		{"-category:recipes", `(NOT category:"recipes")`},
+		{"-", `"-"`},
+		{"a - b", `(AND "a" "-" "b")`},
+		{"and or not", `(AND "and" "or" "not")`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			q, err := ParseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := q.String(); got != tt.want {
+				t.Errorf("ParseQuery(%q) = %s, want %s", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+// malformedQueries do not follow the query syntax.
+var malformedQueries = []string{
+	`say "hi`,
+	"func(",
+	"a)",
+	"(foo OR bar",
+	"foo OR",
+	"AND",
+	"-(",
+	`""`,
+	"category:",
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	for _, query := range malformedQueries {
+		if q, err := parseQuery(query); !errors.Is(err, ErrQuerySyntax) {
+			t.Errorf("parseQuery(%q) = %v, %v, want %v", query, q, err, ErrQuerySyntax)
+		}
+	}
+}
+
+// TestParseQueryLiteral checks that queries the language cannot parse are
+// looked up as they are.
+func TestParseQueryLiteral(t *testing.T) {
+	for _, query := range malformedQueries {
+		t.Run(query, func(t *testing.T) {
+			q, err := ParseQuery(" " + query + " ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := fmt.Sprintf("%q", query); q.String() != want {
+				t.Errorf("ParseQuery(%q) = %s, want %s", query, q, want)
+			}
+		})
+	}
+}
+
+func TestParseQueryEmpty(t *testing.T) {
+	for _, query := range []string{"", "  "} {
+		if _, err := ParseQuery(query); !errors.Is(err, ErrQuerySyntax) {
+			t.Errorf("ParseQuery(%q): err = %v, want %v", query, err, ErrQuerySyntax)
+		}
+	}
+}
+
+func TestQueryTerms(t *testing.T) {
+	q, err := ParseQuery(`foo -bar NOT (baz OR -foo) "qux"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := q.Terms(false), []string{"foo", "bar", "baz", "qux"}; !slices.Equal(got, want) {
+		t.Errorf("Terms(false) = %q, want %q", got, want)
+	}
+	// foo is positive at the top and twice negated inside
+	if got, want := q.Terms(true), []string{"foo", "qux"}; !slices.Equal(got, want) {
+		t.Errorf("Terms(true) = %q, want %q", got, want)
+	}
+}
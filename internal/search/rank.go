@@ -0,0 +1,93 @@
+package search
+
+import (
+	"cmp"
+	"math"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bouncepaw/mycorrhiza/util"
+)
+
+// Weights of the relevance signals.
+const (
+	titleWeight    = 8.0
+	hitWeight      = 1.0
+	headingWeight  = 2.0
+	backlinkWeight = 1.0
+	recencyWeight  = 1.5
+)
+
+// RecencyWindow is for how long an edit makes a hypha rank higher.
+const RecencyWindow = 365 * 24 * time.Hour
+
+var headingPattern = regexp.MustCompile(`^={1,4} `)
+
+// IsHeadingLine tells if the Mycomarkup line is a heading.
+func IsHeadingLine(line string) bool {
+	return headingPattern.MatchString(line)
+}
+
+// RankSignals is what the relevance of a search result is computed from.
+type RankSignals struct {
+	// TitleMatch is how well the hypha name matches the query, from 0 to 1.
+	TitleMatch  float64
+	Hits        int
+	HeadingHits int
+	Backlinks   int
+	// LastEdited is zero if the hypha was not edited within RecencyWindow.
+	LastEdited time.Time
+}
+
+func logScore(n int) float64 {
+	return math.Log2(1 + float64(max(0, n)))
+}
+
+// Score combines the signals into a single relevance score. Counts are
+// scaled logarithmically so that no signal outweighs the others.
+func (s RankSignals) Score(now time.Time) float64 {
+	score := titleWeight * s.TitleMatch +
+		hitWeight * logScore(s.Hits) +
+		headingWeight * logScore(s.HeadingHits) +
+		backlinkWeight * logScore(s.Backlinks)
+	if !s.LastEdited.IsZero() {
+		age := now.Sub(s.LastEdited)
+		if age < RecencyWindow {
+			score += recencyWeight * (1 - float64(age) / float64(RecencyWindow))
+		}
+	}
+	return score
+}
+
+// TitleMatch tells how well the hypha name matches the query, from 0 to 1.
+// Exact matches are the best, then matches of the last name segment, then
+// other names containing the query, shorter names first.
+func TitleMatch(hyphaName string, query string) float64 {
+	query = util.CanonicalName(query)
+	if query == "" {
+		return 0
+	}
+	base := hyphaName[strings.LastIndexByte(hyphaName, '/') + 1:]
+	switch {
+	case hyphaName == query:
+		return 1
+	case base == query:
+		return 0.9
+	case strings.HasPrefix(base, query):
+		return 0.6 + 0.2 * float64(len(query)) / float64(len(base))
+	case strings.Contains(hyphaName, query):
+		return 0.3 + 0.2 * float64(len(query)) / float64(len(hyphaName))
+	default:
+		return 0
+	}
+}
+
+// Sort orders the results by their scores, the best first. Results with equal
+// scores keep their order.
+func (sr *SearchResults) Sort() {
+	slices.SortStableFunc(sr.Hyphae, func(a, b *SearchResult) int {
+		return cmp.Compare(b.Score, a.Score)
+	})
+}
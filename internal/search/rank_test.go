@@ -0,0 +1,120 @@
+package search
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+// TestRankOrder fixes how the signals weigh against each other: a title
+// match comes before a matched heading, which comes before matches in the
+// body. Recency decides between otherwise equal results.
+func TestRankOrder(t *testing.T) {
+	now := time.Date(2026, time.October, 1, 12, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	tests := []struct {
+		hypha       string
+		hits        int
+		headingHits int
+		lastEdited  time.Time
+	}{
+		// In the expected order, shuffled below
+		{"apple", 1, 0, time.Time{}},
+		{"recipes/apple_pie", 1, 0, time.Time{}},
+		{"notes/fruit", 1, 1, time.Time{}},
+		{"notes/yesterday", 1, 0, now.Add(-day)},
+		{"notes/last_month", 1, 0, now.Add(-30 * day)},
+		{"notes/last_year", 1, 0, now.Add(-300 * day)},
+		{"notes/long_ago", 1, 0, time.Time{}},
+	}
+	var want []string
+	res := NewSearchResults()
+	for _, tt := range tests {
+		want = append(want, tt.hypha)
+		r := NewSearchResult(tt.hypha)
+		r.Hits, r.HeadingHits = tt.hits, tt.headingHits
+		r.Score = RankSignals{
+			TitleMatch:  TitleMatch(tt.hypha, "apple"),
+			Hits:        r.Hits,
+			HeadingHits: r.HeadingHits,
+			LastEdited:  tt.lastEdited,
+		}.Score(now)
+		res.Hyphae = append(res.Hyphae, r)
+	}
+	slices.Reverse(res.Hyphae)
+	res.Sort()
+
+	var got []string
+	for _, r := range res.Hyphae {
+		got = append(got, r.Hypha)
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("order = %q, want %q", got, want)
+	}
+}
+
+func TestRankSignalsScore(t *testing.T) {
+	now := time.Date(2026, time.October, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name          string
+		better, worse RankSignals
+	}{
+		{
+			"more hits",
+			RankSignals{Hits: 5},
+			RankSignals{Hits: 4},
+		},
+		{
+			"a heading among the same hits",
+			RankSignals{Hits: 2, HeadingHits: 1},
+			RankSignals{Hits: 2, LastEdited: now},
+		},
+		{
+			"backlinks",
+			RankSignals{Hits: 1, Backlinks: 3},
+			RankSignals{Hits: 1},
+		},
+		{
+			"a title match over a few hits",
+			RankSignals{TitleMatch: 1, Hits: 1},
+			RankSignals{Hits: 5, HeadingHits: 1, LastEdited: now},
+		},
+		{
+			"edited within the window",
+			RankSignals{Hits: 1, LastEdited: now.Add(-RecencyWindow + time.Hour)},
+			RankSignals{Hits: 1, LastEdited: now.Add(-RecencyWindow - time.Hour)},
+		},
+	}
+	for _, tt := range tests {
+		if better, worse := tt.better.Score(now), tt.worse.Score(now); better <= worse {
+			t.Errorf("%s: %v scores %f, not more than %f of %v", tt.name, tt.better, better, worse, tt.worse)
+		}
+	}
+}
+
+func TestTitleMatch(t *testing.T) {
+	tests := []struct {
+		hypha string
+		query string
+		want  float64
+	}{
+		{"apple", "Apple", 1},
+		{"fruit/apple", "apple", 0.9},
+		{"green_apple", "green apple", 1},
+		{"pear", "apple", 0},
+		{"apple", "", 0},
+	}
+	for _, tt := range tests {
+		if got := TitleMatch(tt.hypha, tt.query); got != tt.want {
+			t.Errorf("TitleMatch(%q, %q) = %f, want %f", tt.hypha, tt.query, got, tt.want)
+		}
+	}
+	// Prefixes of the last segment come before other substrings, shorter
+	// names first
+	order := []string{"fruit/apple", "fruit/apples", "fruit/apple_pie", "apple_pie/recipe", "big_apple_pie/recipe"}
+	for i := 1; i < len(order); i++ {
+		if a, b := TitleMatch(order[i - 1], "apple"), TitleMatch(order[i], "apple"); a <= b {
+			t.Errorf("%s scores %f, not more than %f of %s", order[i - 1], a, b, order[i])
+		}
+	}
+}
@@ -1,21 +1,51 @@
 package search
 
 import (
+	"strings"
 	"unicode/utf8"
 
 	"github.com/bouncepaw/mycorrhiza/util"
 )
 
+// SearchResultLine is a line split into alternating unmatched and matched parts.
 type SearchResultLine = []string
 
+// Snippet is a matched line of a hypha text with the lines around it.
+type Snippet struct {
+	Line SearchResultLine `json:"line"`
+	// Number is the number of the line in the text starting from 1, or 0 if
+	// it is not known.
+	Number int `json:"number,omitempty"`
+	// Before and After are the context lines.
+	Before []string `json:"before,omitempty"`
+	After  []string `json:"after,omitempty"`
+	// Anchor is the id of the heading the line is under, Heading is its text.
+	Anchor  string `json:"anchor,omitempty"`
+	Heading string `json:"heading,omitempty"`
+}
+
 type SearchResult struct {
-	Hypha string
-	Lines []SearchResultLine
+	Hypha string `json:"hypha"`
+	Lines []*Snippet `json:"lines"`
+	// Hits is the number of matched lines, including those not in Lines.
+	Hits int `json:"hits"`
+	// HeadingHits is the number of matched heading lines.
+	HeadingHits int `json:"heading_hits"`
+	// Score is the relevance of the result, if ranked.
+	Score float64 `json:"score"`
 }
 
 type SearchResults struct {
-	Hyphae []*SearchResult
-	Complete bool
+	Hyphae []*SearchResult `json:"hyphae"`
+	Complete bool `json:"complete"`
+	// context is the before context of the next snippet.
+	context []contextLine
+}
+
+type contextLine struct {
+	hypha  string
+	number int
+	text   string
 }
 
 func NewSearchResults() *SearchResults {
@@ -25,14 +55,20 @@ func NewSearchResults() *SearchResults {
 	}
 }
 
-func NewSearchResult(hypha string, line []string, maxLength int) *SearchResult {
-	var lines []SearchResultLine = nil
-	if line != nil {
-		lines = []SearchResultLine{NewSearchResultLine(line, maxLength)}
-	}
+func NewSearchResult(hypha string) *SearchResult {
 	return &SearchResult{
 		Hypha: hypha,
-		Lines: lines,
+		Lines: nil,
+		Hits: 0,
+		HeadingHits: 0,
+		Score: 0,
+	}
+}
+
+func NewSnippet(line []string, number int, maxLength int) *Snippet {
+	return &Snippet{
+		Line: NewSearchResultLine(line, maxLength),
+		Number: number,
 	}
 }
 
@@ -89,24 +125,89 @@ func (sr *SearchResults) Last() *SearchResult {
 	return sr.Hyphae[len(sr.Hyphae) - 1]
 }
 
+// Append adds a matched line with the given number to the results. Lines
+// of the same hypha must be appended one after another. It returns false if
+// the line is only counted because of the line limit.
 func (sr *SearchResults) Append(
 	hypha string,
 	line []string,
+	number int,
 	lineLength int,
 	lineLimit uint,
 ) bool {
+	heading := line != nil && IsHeadingLine(strings.Join(line, ""))
 	last := sr.Last()
 	if last == nil || last.Hypha != hypha {
-		sr.Hyphae = append(sr.Hyphae, NewSearchResult(hypha, line, lineLength))
+		last = NewSearchResult(hypha)
+		sr.Hyphae = append(sr.Hyphae, last)
+	}
+	last.countHit(line, heading)
+	before := sr.takeContext(hypha, number)
+	if line == nil || lineLength == 0 {
 		return true
 	}
 	if lineLimit == 0 || uint(len(last.Lines)) < lineLimit {
-		last.Append(NewSearchResultLine(line, lineLength))
+		snippet := NewSnippet(line, number, lineLength)
+		snippet.Before = before
+		last.Append(snippet)
 		return true
 	}
 	return false
 }
 
+// AppendContext adds a line around matched ones. It becomes the after
+// context of the last snippet if it follows it, otherwise it is kept as the
+// before context of the next one.
+func (sr *SearchResults) AppendContext(
+	hypha string,
+	text string,
+	number int,
+	lineLength int,
+) {
+	if lineLength == 0 {
+		return
+	}
+	text = truncateContext(text, lineLength)
+	if last := sr.Last(); last != nil && last.Hypha == hypha && len(last.Lines) > 0 {
+		s := last.Lines[len(last.Lines) - 1]
+		if s.Number > 0 && number == s.Number + len(s.After) + 1 {
+			s.After = append(s.After, text)
+			return
+		}
+	}
+	if n := len(sr.context); n > 0 &&
+		(sr.context[n - 1].hypha != hypha || sr.context[n - 1].number + 1 != number) {
+		sr.context = nil
+	}
+	sr.context = append(sr.context, contextLine{hypha, number, text})
+}
+
+// takeContext returns the kept context lines if they precede the line.
+func (sr *SearchResults) takeContext(hypha string, number int) []string {
+	context := sr.context
+	sr.context = nil
+	n := len(context)
+	if n == 0 || context[n - 1].hypha != hypha || context[n - 1].number + 1 != number {
+		return nil
+	}
+	res := make([]string, n)
+	for i, line := range context {
+		res[i] = line.text
+	}
+	return res
+}
+
+func truncateContext(text string, maxLength int) string {
+	if maxLength < 0 {
+		return text
+	}
+	text, truncated := util.Truncate(text, maxLength)
+	if truncated {
+		text += "…"
+	}
+	return text
+}
+
 func (sr *SearchResults) Limit(limit int) bool {
 	if limit >= 0 && len(sr.Hyphae) > limit {
 		sr.Hyphae = sr.Hyphae[:limit]
@@ -116,6 +217,16 @@ func (sr *SearchResults) Limit(limit int) bool {
 	return true
 }
 
-func (sr *SearchResult) Append(line []string) {
-	sr.Lines = append(sr.Lines, line)
+func (sr *SearchResult) countHit(line []string, heading bool) {
+	if line == nil {
+		return
+	}
+	sr.Hits++
+	if heading {
+		sr.HeadingHits++
+	}
+}
+
+func (sr *SearchResult) Append(snippet *Snippet) {
+	sr.Lines = append(sr.Lines, snippet)
 }
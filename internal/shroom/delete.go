@@ -23,6 +23,7 @@ func Delete(u *user.User, h hyphae.Hypha, recursive bool) error {
 
 	names := []string(nil)
 	files := []string(nil)
+	cats := make(map[string][]string)
 	for hypha := range yieldHyphaeToDelete(h, recursive, iop) {
 		text, err := hypha.Text(hop)
 		if err != nil {
@@ -32,6 +33,7 @@ func Delete(u *user.User, h hyphae.Hypha, recursive bool) error {
 			return err
 		}
 		names = append(names, hypha.CanonicalName())
+		cats[hypha.CanonicalName()] = categories.CategoriesWithHypha(hypha.CanonicalName())
 		files = append(files, hypha.FilePaths()...)
 		iop.WithHyphaDeleted(hypha, text)
 	}
@@ -50,6 +52,9 @@ func Delete(u *user.User, h hyphae.Hypha, recursive bool) error {
 
 	hop.
 		WithMsg(fmt.Sprintf(msg, h.CanonicalName())).
+		// The categories are kept outside of history, so they are noted
+		// for Undelete
+		WithDetails(history.CategoriesNote(cats)...).
 		WithFilesRemoved(files...).
 		Apply()
 	if hop.HasError() {
@@ -0,0 +1,85 @@
+package shroom
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+
+	"github.com/bouncepaw/mycorrhiza/history"
+	"github.com/bouncepaw/mycorrhiza/internal/categories"
+	"github.com/bouncepaw/mycorrhiza/internal/hyphae"
+	"github.com/bouncepaw/mycorrhiza/internal/user"
+	"github.com/bouncepaw/mycorrhiza/util"
+)
+
+var (
+	ErrUndeleteExists  = errors.New("the hypha exists")
+	ErrUndeleteNothing = errors.New("nothing to undelete")
+)
+
+// Undelete restores the hypha deleted in the revision together with the
+// categories it was in, and makes a history record about that. If the
+// revision did not delete all files of the hypha, ErrUndeleteNothing is
+// returned.
+func Undelete(u *user.User, hyphaName string, revHash string) (hyphae.ExistingHypha, error) {
+	hop := history.
+		Operation().
+		WithMsg(fmt.Sprintf("Undelete ‘%s’", hyphaName)).
+		WithUser(u)
+
+	if _, empty := hyphae.ByName(hyphaName).(*hyphae.EmptyHypha); !empty {
+		hop.Abort()
+		return nil, ErrUndeleteExists
+	}
+
+	// The files are restored as they were right before the deletion
+	prevHash := revHash + "^"
+	rh, err := hyphae.AtRevision(hyphaName, prevHash)
+	if err != nil {
+		hop.Abort()
+		return nil, err
+	}
+	rhe, ok := rh.(hyphae.ExistingHypha)
+	if !ok {
+		hop.Abort()
+		return nil, ErrUndeleteNothing
+	}
+	// Otherwise any older revision would bring the hypha back
+	deleted, err := history.DeletedFiles(revHash)
+	if err != nil {
+		hop.Abort()
+		return nil, err
+	}
+	for _, path := range rhe.FilePaths() {
+		if !slices.Contains(deleted, filepath.ToSlash(util.ShorterPath(path))) {
+			hop.Abort()
+			return nil, ErrUndeleteNothing
+		}
+	}
+	cats, err := history.NotedCategories(revHash)
+	if err != nil {
+		hop.Abort()
+		return nil, err
+	}
+
+	hop.WithFilesReverted(prevHash, rhe.FilePaths()...)
+	text, err := rhe.Text(hop)
+	if err != nil {
+		hop.Abort()
+		return nil, err
+	}
+
+	iop := hyphae.IndexOperation()
+	iop.WithHyphaCreated(rhe, text)
+	if hop.Apply().HasError() {
+		iop.Abort()
+		return nil, hop.Err()
+	}
+
+	for _, cat := range cats[hyphaName] {
+		categories.AddHyphaeToCategory(cat, hyphaName)
+	}
+	iop.Apply()
+	return rhe, nil
+}
@@ -48,12 +48,39 @@ func initGroups() error {
 	}
 	setGroups(gs)
 	slog.Info("Indexed groups", "n", len(groups))
-	if cfg.AllowRegistration {
+	if cfg.AllowRegistration || cfg.OIDCEnabled || cfg.LDAPEnabled || cfg.ProxyAuthEnabled {
 		_, err := GroupByName(cfg.RegistrationGroup)
 		if err != nil {
 			return fmt.Errorf("invalid registration group: %s", err.Error())
 		}
 	}
+	if cfg.TOTPRequiredGroup != "" {
+		_, err := GroupByName(cfg.TOTPRequiredGroup)
+		if err != nil {
+			return fmt.Errorf("invalid TOTP required group: %s", err.Error())
+		}
+	}
+	if cfg.OIDCEnabled {
+		for _, name := range cfg.OIDCGroups {
+			if _, err := GroupByName(name); err != nil {
+				return fmt.Errorf("invalid OIDC group mapping: %s", err.Error())
+			}
+		}
+	}
+	if cfg.LDAPEnabled {
+		for _, name := range cfg.LDAPGroups {
+			if _, err := GroupByName(name); err != nil {
+				return fmt.Errorf("invalid LDAP group mapping: %s", err.Error())
+			}
+		}
+	}
+	if cfg.ProxyAuthEnabled {
+		for _, name := range cfg.ProxyAuthGroups {
+			if _, err := GroupByName(name); err != nil {
+				return fmt.Errorf("invalid proxy group mapping: %s", err.Error())
+			}
+		}
+	}
 	return nil
 }
 
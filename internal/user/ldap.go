@@ -0,0 +1,152 @@
+package user
+
+// File `ldap.go` contains the check of credentials against an LDAP directory.
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/bouncepaw/mycorrhiza/internal/cfg"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+const ldapTimeout = 10 * time.Second
+
+// ldapConn is the part of *ldap.Conn used here.
+type ldapConn interface {
+	StartTLS(config *tls.Config) error
+	Bind(username, password string) error
+	Search(searchRequest *ldap.SearchRequest) (*ldap.SearchResult, error)
+	Close() error
+}
+
+// ldapDial connects to the directory. Tests replace it with a fake directory.
+var ldapDial = func() (ldapConn, error) {
+	conn, err := ldap.DialURL(cfg.LDAPURL, ldap.DialWithDialer(&net.Dialer{Timeout: ldapTimeout}))
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(ldapTimeout)
+	return conn, nil
+}
+
+// ldapCredentialsOK binds to the directory as the user. The user is
+// registered if they are new. If LDAPGroupMapping is set, their group follows
+// the directory groups, so that a user removed from a group loses its rights.
+func ldapCredentialsOK(user *User, username, password string) bool {
+	groupDNs, err := ldapAuthenticate(username, password)
+	if err != nil {
+		slog.Info("LDAP authentication failed", "username", username, "err", err)
+		return false
+	}
+	group := ldapGroup(groupDNs)
+	if group == "" {
+		group = cfg.RegistrationGroup
+	}
+
+	if user.IsEmpty() {
+		// The directory decides who may log in, so the registration limit
+		// does not apply
+		if err := Register(username, "", group, "ldap", true); err != nil {
+			slog.Error("Failed to register LDAP user", "username", username, "err", err)
+			return false
+		}
+		slog.Info("Registered user", "username", username, "group", group, "method", "ldap")
+		return true
+	}
+	if len(cfg.LDAPGroups) == 0 || group == user.GroupName() {
+		return true
+	}
+	updated, err := user.WithGroupName(group)
+	if err == nil {
+		err = ReplaceUser(user, updated)
+	}
+	if err != nil {
+		slog.Error("Failed to update LDAP user group", "username", username, "err", err)
+		return true
+	}
+	slog.Info("Updated user group", "username", username, "group", group, "method", "ldap")
+	return true
+}
+
+// ldapAuthenticate finds the user entry, binds as it with the password and
+// returns the DNs of the user's groups.
+func ldapAuthenticate(username, password string) ([]string, error) {
+	// An empty password would make an unauthenticated bind, which succeeds
+	if password == "" {
+		return nil, errors.New("empty password")
+	}
+	conn, err := ldapDial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if cfg.LDAPStartTLS {
+		addr, err := url.Parse(cfg.LDAPURL)
+		if err != nil {
+			return nil, err
+		}
+		if err := conn.StartTLS(&tls.Config{ServerName: addr.Hostname()}); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.LDAPBindDN != "" {
+		if err := conn.Bind(cfg.LDAPBindDN, cfg.LDAPBindPassword); err != nil {
+			return nil, fmt.Errorf("failed to bind as %s: %w", cfg.LDAPBindDN, err)
+		}
+	}
+
+	filter := strings.ReplaceAll(cfg.LDAPUserFilter, "%s", ldap.EscapeFilter(username))
+	res, err := conn.Search(ldap.NewSearchRequest(
+		cfg.LDAPBaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		2, int(ldapTimeout.Seconds()), false,
+		filter, []string{cfg.LDAPGroupAttribute}, nil,
+	))
+	if err != nil {
+		return nil, err
+	}
+	if len(res.Entries) != 1 {
+		return nil, fmt.Errorf("%d entries match %s", len(res.Entries), filter)
+	}
+	entry := res.Entries[0]
+	if err := conn.Bind(entry.DN, password); err != nil {
+		return nil, err
+	}
+	return entry.GetAttributeValues(cfg.LDAPGroupAttribute), nil
+}
+
+// ldapGroup returns the most powerful wiki group mapped from the directory
+// groups, or an empty string if none is mapped.
+func ldapGroup(groupDNs []string) string {
+	var best Group
+	found := false
+	for mapped, name := range cfg.LDAPGroups {
+		mappedDN, err := ldap.ParseDN(mapped)
+		if err != nil {
+			slog.Warn("Invalid DN in LDAP group mapping", "dn", mapped, "err", err)
+			continue
+		}
+		for _, groupDN := range groupDNs {
+			dn, err := ldap.ParseDN(groupDN)
+			if err != nil || !dn.EqualFold(mappedDN) {
+				continue
+			}
+			group, err := GroupByName(name)
+			if err == nil && (!found || CompareGroups(group, best) > 0) {
+				best, found = group, true
+			}
+		}
+	}
+	if !found {
+		return ""
+	}
+	return best.Name()
+}
@@ -0,0 +1,183 @@
+package user
+
+import (
+	"crypto/tls"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/bouncepaw/mycorrhiza/internal/cfg"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// fakeDirectory answers every search with its entries and checks binds
+// against its passwords.
+type fakeDirectory struct {
+	entries   []*ldap.Entry
+	passwords map[string]string
+
+	dialed  bool
+	filters []string
+	binds   []string
+}
+
+func (d *fakeDirectory) StartTLS(*tls.Config) error { return nil }
+func (d *fakeDirectory) Close() error               { return nil }
+
+func (d *fakeDirectory) Bind(username, password string) error {
+	d.binds = append(d.binds, username)
+	if want, ok := d.passwords[username]; !ok || want != password {
+		return ldap.NewError(ldap.LDAPResultInvalidCredentials, errors.New("invalid credentials"))
+	}
+	return nil
+}
+
+func (d *fakeDirectory) Search(rq *ldap.SearchRequest) (*ldap.SearchResult, error) {
+	d.filters = append(d.filters, rq.Filter)
+	return &ldap.SearchResult{Entries: d.entries}, nil
+}
+
+func useFakeDirectory(t *testing.T, d *fakeDirectory) {
+	t.Helper()
+	dial := ldapDial
+	ldapDial = func() (ldapConn, error) {
+		d.dialed = true
+		return d, nil
+	}
+	bindDN, bindPassword := cfg.LDAPBindDN, cfg.LDAPBindPassword
+	t.Cleanup(func() {
+		ldapDial = dial
+		cfg.LDAPBindDN, cfg.LDAPBindPassword = bindDN, bindPassword
+	})
+	cfg.LDAPUserFilter = "(uid=%s)"
+	cfg.LDAPGroupAttribute = "memberOf"
+}
+
+const (
+	aliceDN = "uid=alice,ou=people,dc=example,dc=org"
+	bobDN   = "uid=bob,ou=people,dc=example,dc=org"
+	editors = "cn=editors,ou=groups,dc=example,dc=org"
+)
+
+func TestLDAPAuthenticate(t *testing.T) {
+	alice := ldap.NewEntry(aliceDN, map[string][]string{"memberOf": {editors}})
+	bob := ldap.NewEntry(bobDN, nil)
+	passwords := map[string]string{aliceDN: "wonderland", bobDN: "builder"}
+
+	tests := []struct {
+		name       string
+		username   string
+		password   string
+		entries    []*ldap.Entry
+		wantFilter string
+		wantGroups []string
+		wantErr    bool
+	}{
+		{"correct password", "alice", "wonderland", []*ldap.Entry{alice}, "(uid=alice)", []string{editors}, false},
+		{"wrong password", "alice", "looking-glass", []*ldap.Entry{alice}, "(uid=alice)", nil, true},
+		{"filter injection", "*)(uid=*", "wonderland", nil, `(uid=\2a\29\28uid=\2a)`, nil, true},
+		{"no entries", "carol", "wonderland", nil, "(uid=carol)", nil, true},
+		{"several entries", "alice", "wonderland", []*ldap.Entry{alice, bob}, "(uid=alice)", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &fakeDirectory{entries: tt.entries, passwords: passwords}
+			useFakeDirectory(t, d)
+
+			groups, err := ldapAuthenticate(tt.username, tt.password)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error: %v", err, tt.wantErr)
+			}
+			if !slices.Equal(d.filters, []string{tt.wantFilter}) {
+				t.Errorf("filters = %q, want %q", d.filters, tt.wantFilter)
+			}
+			if err == nil && !slices.Equal(groups, tt.wantGroups) {
+				t.Errorf("groups = %q, want %q", groups, tt.wantGroups)
+			}
+			if len(tt.entries) != 1 && len(d.binds) > 0 {
+				t.Errorf("bound as %q without a single matching entry", d.binds)
+			}
+		})
+	}
+}
+
+func TestLDAPAuthenticateEmptyPassword(t *testing.T) {
+	// Directories accept a bind with an empty password as unauthenticated
+	d := &fakeDirectory{
+		entries:   []*ldap.Entry{ldap.NewEntry(aliceDN, nil)},
+		passwords: map[string]string{aliceDN: ""},
+	}
+	useFakeDirectory(t, d)
+
+	if _, err := ldapAuthenticate("alice", ""); err == nil {
+		t.Error("empty password accepted")
+	}
+	if d.dialed {
+		t.Error("the directory was asked")
+	}
+}
+
+func TestLDAPAuthenticateServiceBind(t *testing.T) {
+	const serviceDN = "cn=wiki,dc=example,dc=org"
+	d := &fakeDirectory{
+		entries:   []*ldap.Entry{ldap.NewEntry(aliceDN, nil)},
+		passwords: map[string]string{serviceDN: "service", aliceDN: "wonderland"},
+	}
+	useFakeDirectory(t, d)
+	cfg.LDAPBindDN, cfg.LDAPBindPassword = serviceDN, "service"
+
+	if _, err := ldapAuthenticate("alice", "wonderland"); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{serviceDN, aliceDN}; !slices.Equal(d.binds, want) {
+		t.Errorf("binds = %q, want %q", d.binds, want)
+	}
+
+	cfg.LDAPBindPassword = "wrong"
+	d.binds, d.filters = nil, nil
+	if _, err := ldapAuthenticate("alice", "wonderland"); err == nil {
+		t.Error("logged in after a failed service bind")
+	}
+	if len(d.filters) > 0 {
+		t.Error("searched after a failed service bind")
+	}
+}
+
+func TestLDAPGroup(t *testing.T) {
+	setGroups([]Group{
+		EmptyGroup(),
+		NewGroup("reader", 0),
+		NewGroup("editor", 1),
+		NewGroup("moderator", 3),
+		AdminGroup(),
+	})
+	mapping := cfg.LDAPGroups
+	t.Cleanup(func() { cfg.LDAPGroups = mapping })
+	cfg.LDAPGroups = map[string]string{
+		"CN=Editors,OU=Groups,DC=example,DC=org": "editor",
+		"cn=mods, ou=groups, dc=example, dc=org": "moderator",
+		"cn=ghosts,ou=groups,dc=example,dc=org":  "nonexistent",
+	}
+
+	tests := []struct {
+		name     string
+		groupDNs []string
+		want     string
+	}{
+		{"no groups", nil, ""},
+		{"unmapped group", []string{"cn=staff,ou=groups,dc=example,dc=org"}, ""},
+		{"case and spaces differ", []string{"cn=editors, ou=groups,dc=Example,dc=Org"}, "editor"},
+		{"most powerful wins", []string{editors, "cn=mods,ou=groups,dc=example,dc=org"}, "moderator"},
+		{"order does not matter", []string{"cn=mods,ou=groups,dc=example,dc=org", editors}, "moderator"},
+		{"unknown wiki group", []string{"cn=ghosts,ou=groups,dc=example,dc=org"}, ""},
+		{"invalid DN", []string{"not a dn"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ldapGroup(tt.groupDNs); got != tt.want {
+				t.Errorf("ldapGroup(%q) = %q, want %q", tt.groupDNs, got, tt.want)
+			}
+		})
+	}
+}
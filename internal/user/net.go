@@ -18,7 +18,11 @@ import (
 var ErrLogin error = errors.New("wrong username or password")
 
 // FromRequest returns user from `rq`. If there is no user, an anon user is returned instead.
+// With proxy authorization, the user is taken from the proxy headers, and the session cookie is ignored.
 func FromRequest(rq *http.Request) *User {
+	if cfg.ProxyAuthEnabled {
+		return fromProxyHeaders(rq)
+	}
 	cookie, err := rq.Cookie("mycorrhiza_token")
 	if err != nil {
 		return emptyUser
@@ -59,6 +63,8 @@ func Register(username, password, group, source string, force bool) error {
 }
 
 // LoginDataHTTP logs such user in and returns string representation of an error if there is any.
+// If the user has set up two-factor authentication, ErrTOTPNeeded is returned instead,
+// and the login is to be finished with LoginTOTPHTTP.
 //
 // The HTTP parameters are used for setting header status (bad request, if it is bad) and saving a cookie.
 func LoginDataHTTP(w http.ResponseWriter, username, password string) error {
@@ -68,6 +74,19 @@ func LoginDataHTTP(w http.ResponseWriter, username, password string) error {
 		slog.Info("Wrong username or password entered", "username", username)
 		return ErrLogin
 	}
+	if ByName(username).HasTOTP() {
+		if err := startPendingLogin(w, username); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return err
+		}
+		return ErrTOTPNeeded
+	}
+	return LoginHTTP(w, username)
+}
+
+// LoginHTTP logs the user in without checking credentials. Use it for users
+// authenticated by someone else, like an OpenID Connect provider.
+func LoginHTTP(w http.ResponseWriter, username string) error {
 	session, err := AddSession(username)
 	if err != nil {
 		slog.Error("Failed to add session", "username", username, "err", err)
@@ -0,0 +1,35 @@
+package user
+
+// File `oidc.go` contains the binding of users to their OpenID Connect
+// identities.
+
+import "fmt"
+
+// ByOIDCSubject returns the user with the subject at the issuer, or an empty
+// user if there is none.
+func ByOIDCSubject(issuer, subject string) *User {
+	if subject == "" {
+		return emptyUser
+	}
+	for user := range YieldUsers() {
+		if user.source == UserSourceOIDC && user.oidcIssuer == issuer && user.oidcSubject == subject {
+			return user
+		}
+	}
+	return emptyUser
+}
+
+// RegisterOIDC registers the user with the subject at the issuer. The
+// registration limit does not apply.
+func RegisterOIDC(username, group, issuer, subject string) error {
+	user, err := NewUser(username, group, "", "oidc")
+	if err != nil {
+		return err
+	}
+	if !ByName(user.name).IsEmpty() {
+		return fmt.Errorf("username ‘%s’ is already taken", user.name)
+	}
+	user.oidcIssuer = issuer
+	user.oidcSubject = subject
+	return AddUser(user)
+}
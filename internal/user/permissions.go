@@ -13,11 +13,26 @@ import (
 // TODO: support shell patterns?
 var routePermission = map[string]int{
 	"about":                  0,
+	"api/complete":           0,
 	"backlinks":              0,
 	"binary":                 0,
+	"blame":                  0,
 	"category":               0,
+	"category-rss":           0,
+	"category-atom":          0,
+	"category-json":          0,
+	"contributions":          0,
+	"contributions-rss":      0,
+	"contributions-atom":     0,
+	"contributions-json":     0,
+	"deleted":                0,
+	"diff":                   0,
 	"help":                   0,
 	"history":                0,
+	"history-rss":            0,
+	"history-atom":           0,
+	"history-json":           0,
+	"history-search":         0,
 	"hypha":                  0,
 	"interwiki":              0,
 	"list":                   0,
@@ -32,12 +47,14 @@ var routePermission = map[string]int{
 	"rev-text":               0,
 	"rev-binary":             0,
 	"settings":               0,
+	"stats":                  0,
 	"subhyphae":              0,
 	"title-search":           0,
 	"text":                   0,
 	"text-search":            0,
 	"today":                  0,
 	"users":                  0,
+	"wanted":                 0,
 
 	"add-to-category":        1,
 	"edit":                   1,
@@ -52,6 +69,7 @@ var routePermission = map[string]int{
 
 	"delete":                 3,
 	"revert":                 3,
+	"undelete":               3,
 
 	"admin":                  4,
 	"interwiki/add-entry":    4,
@@ -0,0 +1,139 @@
+package user
+
+// File `proxy.go` contains the authorization by a reverse proxy.
+
+import (
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+
+	"github.com/bouncepaw/mycorrhiza/internal/cfg"
+	"github.com/bouncepaw/mycorrhiza/util"
+)
+
+// fromProxyHeaders returns the user named in the headers set by a trusted
+// proxy. The user is registered the first time they are seen, if the
+// whitelist allows. If ProxyAuthGroupHeader is set, their group follows the
+// header on every request. A missing header changes nothing, and a header
+// without known groups moves only the users registered by the proxy to
+// RegistrationGroup.
+func fromProxyHeaders(rq *http.Request) *User {
+	username := util.CanonicalName(strings.TrimSpace(rq.Header.Get(cfg.ProxyAuthUserHeader)))
+	if username == "" {
+		return emptyUser
+	}
+	if !fromTrustedProxy(rq) {
+		// Only the first time, so that a client cannot flood the log
+		log := slog.Debug
+		if !warnedUntrustedProxy.Swap(true) {
+			log = slog.Warn
+		}
+		log("Ignored proxy header from an untrusted address",
+			"addr", rq.RemoteAddr, "header", cfg.ProxyAuthUserHeader)
+		return emptyUser
+	}
+
+	var (
+		group       = cfg.RegistrationGroup
+		groupHeader = ""
+		mapped      = ""
+	)
+	if cfg.ProxyAuthGroupHeader != "" {
+		groupHeader = strings.TrimSpace(rq.Header.Get(cfg.ProxyAuthGroupHeader))
+		if mapped = proxyGroup(groupHeader); mapped != "" {
+			group = mapped
+		}
+	}
+	user := ByName(username)
+	if user.IsEmpty() {
+		if !usernameIsWhiteListed(username) {
+			slog.Info("Proxy user is not in the whitelist", "username", username)
+			return emptyUser
+		}
+		// The proxy decides who may log in, so the registration limit does
+		// not apply
+		err := Register(username, "", group, "proxy", true)
+		if user = ByName(username); user.IsEmpty() {
+			// The username is invalid
+			slog.Error("Failed to register proxy user", "username", username, "err", err)
+			return emptyUser
+		}
+		if err == nil {
+			slog.Info("Registered user", "username", username, "group", group, "method", "proxy")
+		}
+	}
+	switch {
+	case cfg.ProxyAuthGroupHeader == "" || group == user.GroupName():
+		// Without the group header, groups of existing users are managed on
+		// the wiki
+		return user
+	case groupHeader == "":
+		// A proxy that lost the header should not demote everyone
+		return user
+	case mapped == "" && user.Source() != UserSourceProxy:
+		// Users made elsewhere, like local admins, keep their groups unless
+		// the proxy tells a known one
+		return user
+	}
+	updated, err := user.WithGroupName(group)
+	if err == nil {
+		err = ReplaceUser(user, updated)
+	}
+	if err != nil {
+		slog.Error("Failed to update proxy user group", "username", username, "err", err)
+		return user
+	}
+	slog.Info("Updated user group", "username", username, "group", group, "method", "proxy")
+	return updated
+}
+
+var warnedUntrustedProxy atomic.Bool
+
+// fromTrustedProxy reports whether the request came from one of
+// ProxyAuthTrustedProxies. Connections to a Unix socket are trusted, they
+// have no address and can only come from the same machine.
+func fromTrustedProxy(rq *http.Request) bool {
+	if local, ok := rq.Context().Value(http.LocalAddrContextKey).(net.Addr); ok && local.Network() == "unix" {
+		return true
+	}
+	host, _, err := net.SplitHostPort(rq.RemoteAddr)
+	if err != nil {
+		host = rq.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range cfg.ProxyAuthTrustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// proxyGroup returns the most powerful wiki group among the comma-separated
+// proxy groups, or an empty string if there is none. The groups are mapped
+// with ProxyAuthGroupMapping, unmapped ones are taken as wiki group names.
+func proxyGroup(header string) string {
+	var best Group
+	found := false
+	for _, name := range strings.Split(header, ",") {
+		name = strings.TrimSpace(name)
+		if mapped, ok := cfg.ProxyAuthGroups[name]; ok {
+			name = mapped
+		}
+		group, err := GroupByName(name)
+		if err == nil && (!found || CompareGroups(group, best) > 0) {
+			best, found = group, true
+		}
+	}
+	if !found {
+		return ""
+	}
+	return best.Name()
+}
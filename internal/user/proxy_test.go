@@ -0,0 +1,156 @@
+package user
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/bouncepaw/mycorrhiza/internal/cfg"
+)
+
+func TestFromTrustedProxy(t *testing.T) {
+	proxies := cfg.ProxyAuthTrustedProxies
+	t.Cleanup(func() { cfg.ProxyAuthTrustedProxies = proxies })
+	cfg.ProxyAuthTrustedProxies = []netip.Prefix{
+		netip.MustParsePrefix("127.0.0.1/32"),
+		netip.MustParsePrefix("::1/128"),
+		netip.MustParsePrefix("10.0.0.0/8"),
+	}
+	socket := &net.UnixAddr{Name: "/run/mycorrhiza.sock", Net: "unix"}
+	tcp := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1737}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		localAddr  net.Addr
+		want       bool
+	}{
+		{"loopback", "127.0.0.1:4000", tcp, true},
+		{"IPv6 loopback", "[::1]:4000", tcp, true},
+		{"IPv4-mapped IPv6", "[::ffff:10.1.2.3]:4000", tcp, true},
+		{"trusted network", "10.20.30.40:4000", tcp, true},
+		{"untrusted", "192.0.2.1:4000", tcp, false},
+		{"untrusted IPv6", "[2001:db8::1]:4000", tcp, false},
+		{"not an address", "proxy", tcp, false},
+		{"Unix socket", "@", socket, true},
+		{"Unix socket without a remote address", "", socket, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rq := httptest.NewRequest(http.MethodGet, "/", nil)
+			rq = rq.WithContext(context.WithValue(rq.Context(), http.LocalAddrContextKey, tt.localAddr))
+			rq.RemoteAddr = tt.remoteAddr
+			if got := fromTrustedProxy(rq); got != tt.want {
+				t.Errorf("fromTrustedProxy(%q) = %v, want %v", tt.remoteAddr, got, tt.want)
+			}
+		})
+	}
+}
+
+// useTestProxy makes the loopback proxy log users in with a group header.
+func useTestProxy(t *testing.T) {
+	t.Helper()
+	var (
+		userHeader  = cfg.ProxyAuthUserHeader
+		groupHeader = cfg.ProxyAuthGroupHeader
+		groups      = cfg.ProxyAuthGroups
+		proxies     = cfg.ProxyAuthTrustedProxies
+		regGroup    = cfg.RegistrationGroup
+		whiteList   = cfg.UseWhiteList
+		names       = cfg.WhiteList
+	)
+	t.Cleanup(func() {
+		cfg.ProxyAuthUserHeader, cfg.ProxyAuthGroupHeader = userHeader, groupHeader
+		cfg.ProxyAuthGroups, cfg.ProxyAuthTrustedProxies = groups, proxies
+		cfg.RegistrationGroup = regGroup
+		cfg.UseWhiteList, cfg.WhiteList = whiteList, names
+	})
+	cfg.ProxyAuthUserHeader = "X-Remote-User"
+	cfg.ProxyAuthGroupHeader = "X-Remote-Groups"
+	cfg.ProxyAuthGroups = map[string]string{"wiki-admins": "admin"}
+	cfg.ProxyAuthTrustedProxies = []netip.Prefix{netip.MustParsePrefix("127.0.0.1/32")}
+	cfg.RegistrationGroup = "editor"
+	cfg.UseWhiteList, cfg.WhiteList = false, nil
+}
+
+func proxyRequest(username string, groups ...string) *http.Request {
+	rq := httptest.NewRequest(http.MethodGet, "/", nil)
+	rq.RemoteAddr = "127.0.0.1:4000"
+	rq.Header.Set("X-Remote-User", username)
+	for _, group := range groups {
+		rq.Header.Add("X-Remote-Groups", group)
+	}
+	return rq
+}
+
+func newTestAdmin(t *testing.T, name string, source UserSource) *User {
+	t.Helper()
+	user, err := newUser(name, AdminGroup(), nil, time.Now(), source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func TestFromProxyHeadersGroups(t *testing.T) {
+	tests := []struct {
+		name   string
+		source UserSource
+		groups []string
+		want   string
+	}{
+		{"proxy user, known group", UserSourceProxy, []string{"editor"}, "editor"},
+		{"proxy user, mapped group", UserSourceProxy, []string{"staff, wiki-admins"}, "admin"},
+		{"proxy user, unknown group", UserSourceProxy, []string{"staff"}, "editor"},
+		{"proxy user, empty header", UserSourceProxy, []string{" "}, "admin"},
+		{"proxy user, no header", UserSourceProxy, nil, "admin"},
+		{"local user, known group", UserSourceLocal, []string{"editor"}, "editor"},
+		{"local user, unknown group", UserSourceLocal, []string{"staff"}, "admin"},
+		{"local user, no header", UserSourceLocal, nil, "admin"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestProxy(t)
+			useTestUsers(t, newTestAdmin(t, "alice", tt.source))
+			user := fromProxyHeaders(proxyRequest("alice", tt.groups...))
+			if user.Name() != "alice" {
+				t.Fatalf("got user %q, want alice", user.Name())
+			}
+			if user.GroupName() != tt.want || ByName("alice").GroupName() != tt.want {
+				t.Errorf("group = %s, stored %s, want %s", user.GroupName(), ByName("alice").GroupName(), tt.want)
+			}
+		})
+	}
+}
+
+func TestFromProxyHeadersRegistration(t *testing.T) {
+	useTestProxy(t)
+	useTestUsers(t)
+
+	user := fromProxyHeaders(proxyRequest("bob"))
+	if user.Name() != "bob" || user.GroupName() != "editor" || user.Source() != UserSourceProxy {
+		t.Errorf("new user without groups = %s (%s, source %d)", user.Name(), user.GroupName(), user.Source())
+	}
+	user = fromProxyHeaders(proxyRequest("carol", "wiki-admins"))
+	if user.Name() != "carol" || user.GroupName() != "admin" {
+		t.Errorf("new user with groups = %s (%s)", user.Name(), user.GroupName())
+	}
+
+	cfg.UseWhiteList, cfg.WhiteList = true, []string{"bob", "dave"}
+	if user := fromProxyHeaders(proxyRequest("eve")); !user.IsEmpty() || !ByName("eve").IsEmpty() {
+		t.Errorf("user not in the whitelist is registered as %s", user.Name())
+	}
+	if user := fromProxyHeaders(proxyRequest("dave")); user.Name() != "dave" {
+		t.Errorf("user in the whitelist is not registered: %q", user.Name())
+	}
+
+	rq := proxyRequest("mallory")
+	rq.RemoteAddr = "192.0.2.1:4000"
+	if user := fromProxyHeaders(rq); !user.IsEmpty() {
+		t.Errorf("untrusted proxy logged in %s", user.Name())
+	}
+}
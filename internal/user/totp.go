@@ -0,0 +1,342 @@
+package user
+
+// File `totp.go` contains two-factor authentication with time-based one-time
+// passwords as described in RFC 6238.
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bouncepaw/mycorrhiza/internal/cfg"
+	"github.com/bouncepaw/mycorrhiza/util"
+)
+
+var (
+	ErrTOTPNeeded        = errors.New("one-time code needed")
+	ErrTOTP              = errors.New("wrong one-time code")
+	ErrTOTPLoginExpired  = errors.New("the login attempt expired, enter your password again")
+	ErrTOTPLocked        = errors.New("too many wrong codes")
+	ErrTOTPNotLocal      = errors.New("only local users can use two-factor authentication")
+	ErrTOTPRequired      = errors.New("two-factor authentication is required for your group")
+	ErrTOTPNotConfigured = errors.New("two-factor authentication is not set up")
+	ErrTOTPSecret        = errors.New("invalid two-factor authentication secret")
+)
+
+const (
+	totpPeriod = 30
+	totpDigits = 6
+	// totpSkew is how many periods before and after the current one are
+	// accepted, because clocks are never exact.
+	totpSkew = 1
+
+	recoveryCodeCount = 10
+
+	pendingLoginDuration = 5 * time.Minute
+	pendingLoginAttempts = 5
+
+	// After secondFactorFreeFailures wrong codes in a row, the user has to
+	// wait before the next try, twice as long after every next wrong code.
+	secondFactorFreeFailures = 5
+	secondFactorBackoff      = 30 * time.Second
+	secondFactorMaxBackoff   = time.Hour
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// pendingLogin is a login whose password was right, but the one-time code is
+// still to be entered.
+type pendingLogin struct {
+	username string
+	expires  time.Time
+	attempts int
+}
+
+var (
+	secondFactorMutex sync.Mutex
+	pendingLogins     = make(map[string]*pendingLogin)
+	// lastTOTPCounters are the last used TOTP counters by usernames. A code
+	// cannot be used twice.
+	lastTOTPCounters = make(map[string]uint64)
+	// secondFactorFailures are the wrong codes in a row by usernames. They
+	// are counted across login attempts, so that entering the password again
+	// does not give more tries.
+	secondFactorFailures = make(map[string]*secondFactorFailure)
+)
+
+type secondFactorFailure struct {
+	count int
+	// next is when the next code can be checked.
+	next time.Time
+}
+
+// NewTOTPSecret generates a new TOTP secret.
+func NewTOTPSecret() string {
+	b := make([]byte, 20)
+	_, _ = rand.Read(b)
+	return totpEncoding.EncodeToString(b)
+}
+
+// TOTPURI returns the otpauth URI for authenticator apps. It is usually shown
+// as a QR code.
+func TOTPURI(username, secret string) string {
+	q := url.Values{
+		"secret":    {secret},
+		"issuer":    {cfg.WikiName},
+		"algorithm": {"SHA1"},
+		"digits":    {fmt.Sprint(totpDigits)},
+		"period":    {fmt.Sprint(totpPeriod)},
+	}
+	label := url.PathEscape(cfg.WikiName + ":" + username)
+	// Some apps do not decode + as a space
+	return "otpauth://totp/" + label + "?" + strings.ReplaceAll(q.Encode(), "+", "%20")
+}
+
+// totpCode computes the code for the counter as described in RFC 4226.
+func totpCode(key []byte, counter uint64) string {
+	mac := hmac.New(sha1.New, key)
+	_ = binary.Write(mac, binary.BigEndian, counter)
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0xf
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1_000_000)
+}
+
+// checkTOTP checks the code against the secret at the time and returns the
+// counter of the matching period.
+func checkTOTP(secret, code string, t time.Time) (uint64, bool) {
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil || len(code) != totpDigits {
+		return 0, false
+	}
+	now := uint64(t.Unix()) / totpPeriod
+	for counter := now - totpSkew; counter <= now + totpSkew; counter++ {
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, counter)), []byte(code)) == 1 {
+			return counter, true
+		}
+	}
+	return 0, false
+}
+
+// CheckTOTPSecret checks the code against a secret that is not saved yet.
+func CheckTOTPSecret(secret, code string) bool {
+	_, ok := checkTOTP(secret, normalizeCode(code), time.Now())
+	return ok
+}
+
+func normalizeCode(code string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), " ", ""))
+}
+
+func hashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(strings.ReplaceAll(code, "-", "")))
+	return hex.EncodeToString(sum[:])
+}
+
+// newRecoveryCodes generates recovery codes and returns them with their hashes.
+func newRecoveryCodes() (codes []string, hashes []string) {
+	for range recoveryCodeCount {
+		b := make([]byte, 5)
+		_, _ = rand.Read(b)
+		code := strings.ToLower(totpEncoding.EncodeToString(b))
+		code = code[:4] + "-" + code[4:]
+		codes = append(codes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+	return codes, hashes
+}
+
+// HasTOTP returns true if the user has set up two-factor authentication.
+func (user *User) HasTOTP() bool {
+	return user.totpSecret != ""
+}
+
+// TOTPRequired returns true if the user has to use two-factor authentication
+// because of their group.
+func (user *User) TOTPRequired() bool {
+	if cfg.TOTPRequiredGroup == "" || user.source != UserSourceLocal || user.IsEmpty() {
+		return false
+	}
+	group, err := GroupByName(cfg.TOTPRequiredGroup)
+	return err == nil && user.Permission() >= group.Permission()
+}
+
+// NeedsTOTPSetup returns true if the user has to set up two-factor
+// authentication before using the wiki.
+func (user *User) NeedsTOTPSetup() bool {
+	return user.TOTPRequired() && !user.HasTOTP()
+}
+
+// RecoveryCodesLeft returns the number of unused recovery codes.
+func (user *User) RecoveryCodesLeft() int {
+	return len(user.recoveryCodes)
+}
+
+// WithTOTP returns the user with two-factor authentication set up with the
+// secret, and new recovery codes for them.
+func (user *User) WithTOTP(secret string) (*User, []string, error) {
+	if user.source != UserSourceLocal {
+		return nil, nil, ErrTOTPNotLocal
+	}
+	if key, err := totpEncoding.DecodeString(secret); err != nil || len(key) < 10 {
+		return nil, nil, ErrTOTPSecret
+	}
+	res := *user
+	codes, hashes := newRecoveryCodes()
+	res.totpSecret = secret
+	res.recoveryCodes = hashes
+	return &res, codes, nil
+}
+
+// WithNewRecoveryCodes returns the user with new recovery codes, the old ones
+// no longer work.
+func (user *User) WithNewRecoveryCodes() (*User, []string, error) {
+	if !user.HasTOTP() {
+		return nil, nil, ErrTOTPNotConfigured
+	}
+	return user.WithTOTP(user.totpSecret)
+}
+
+// WithoutTOTP returns the user with two-factor authentication turned off.
+func (user *User) WithoutTOTP() *User {
+	res := *user
+	res.totpSecret = ""
+	res.recoveryCodes = nil
+	return &res
+}
+
+// CheckSecondFactor checks the one-time code or the recovery code of the
+// user. A code cannot be used twice, used recovery codes are removed. After
+// several wrong codes, codes are not checked for a while.
+func CheckSecondFactor(user *User, code string) error {
+	code = normalizeCode(code)
+	secondFactorMutex.Lock()
+	defer secondFactorMutex.Unlock()
+
+	// The user could have changed since it was read, for example a recovery
+	// code could have been used by another request
+	user = ByName(user.name)
+	if !user.HasTOTP() {
+		return ErrTOTPNotConfigured
+	}
+
+	failure := secondFactorFailures[user.name]
+	if failure != nil && time.Now().Before(failure.next) {
+		return fmt.Errorf("%w, try again in %s", ErrTOTPLocked, time.Until(failure.next).Round(time.Second))
+	}
+	if checkSecondFactor(user, code) {
+		delete(secondFactorFailures, user.name)
+		return nil
+	}
+	if failure == nil {
+		failure = &secondFactorFailure{}
+		secondFactorFailures[user.name] = failure
+	}
+	failure.count++
+	if extra := failure.count - secondFactorFreeFailures; extra >= 0 {
+		backoff := secondFactorMaxBackoff
+		if extra < 10 {
+			backoff = min(secondFactorBackoff<<extra, secondFactorMaxBackoff)
+		}
+		failure.next = time.Now().Add(backoff)
+	}
+	return ErrTOTP
+}
+
+// checkSecondFactor is CheckSecondFactor without the failure counting. It
+// must be called with secondFactorMutex locked.
+func checkSecondFactor(user *User, code string) bool {
+	if counter, ok := checkTOTP(user.totpSecret, code, time.Now()); ok {
+		if last, used := lastTOTPCounters[user.name]; used && counter <= last {
+			return false
+		}
+		lastTOTPCounters[user.name] = counter
+		return true
+	}
+
+	hash := hashRecoveryCode(code)
+	i := slices.Index(user.recoveryCodes, hash)
+	if i < 0 {
+		return false
+	}
+	updated := *user
+	updated.recoveryCodes = slices.Delete(slices.Clone(user.recoveryCodes), i, i+1)
+	return ReplaceUser(user, &updated) == nil
+}
+
+// startPendingLogin remembers that the user entered the right password and
+// sets the cookie that identifies the login attempt.
+func startPendingLogin(w http.ResponseWriter, username string) error {
+	token, err := util.RandomString(16)
+	if err != nil {
+		return err
+	}
+	expires := time.Now().Add(pendingLoginDuration)
+	secondFactorMutex.Lock()
+	for t, login := range pendingLogins {
+		if time.Now().After(login.expires) {
+			delete(pendingLogins, t)
+		}
+	}
+	pendingLogins[token] = &pendingLogin{username: username, expires: expires}
+	secondFactorMutex.Unlock()
+	c := cookie("login", token, expires)
+	c.HttpOnly = true
+	c.SameSite = http.SameSiteStrictMode
+	http.SetCookie(w, c)
+	return nil
+}
+
+// LoginTOTPHTTP finishes the login started by LoginDataHTTP with the one-time
+// code or a recovery code, and returns the username.
+func LoginTOTPHTTP(w http.ResponseWriter, rq *http.Request, code string) (string, error) {
+	w.Header().Set("Content-Type", "text/html;charset=utf-8")
+	c, err := rq.Cookie("mycorrhiza_login")
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return "", ErrTOTPLoginExpired
+	}
+	secondFactorMutex.Lock()
+	login, ok := pendingLogins[c.Value]
+	if ok && time.Now().After(login.expires) {
+		delete(pendingLogins, c.Value)
+		ok = false
+	}
+	var username string
+	if ok {
+		username = login.username
+		login.attempts++
+		if login.attempts >= pendingLoginAttempts {
+			// Too many guesses, the password has to be entered again
+			delete(pendingLogins, c.Value)
+		}
+	}
+	secondFactorMutex.Unlock()
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return "", ErrTOTPLoginExpired
+	}
+
+	if err := CheckSecondFactor(ByName(username), code); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return username, err
+	}
+	secondFactorMutex.Lock()
+	delete(pendingLogins, c.Value)
+	secondFactorMutex.Unlock()
+	http.SetCookie(w, cookie("login", "", time.Unix(0, 0)))
+	return username, LoginHTTP(w, username)
+}
@@ -0,0 +1,200 @@
+package user
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 secret of the RFC 6238 test vectors.
+var rfcSecret = totpEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestTOTPCode(t *testing.T) {
+	// The RFC has eight digits, the last six are the same
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	key := []byte("12345678901234567890")
+	for _, tt := range tests {
+		if got := totpCode(key, uint64(tt.unix) / totpPeriod); got != tt.want {
+			t.Errorf("code at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+		counter, ok := checkTOTP(rfcSecret, tt.want, time.Unix(tt.unix, 0))
+		if !ok || counter != uint64(tt.unix) / totpPeriod {
+			t.Errorf("checkTOTP at %d = %d, %v", tt.unix, counter, ok)
+		}
+	}
+}
+
+func TestCheckTOTPSkew(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	key := []byte("12345678901234567890")
+	counter := uint64(now.Unix()) / totpPeriod
+	tests := []struct {
+		name string
+		code string
+		ok   bool
+	}{
+		{"current", totpCode(key, counter), true},
+		{"previous", totpCode(key, counter - 1), true},
+		{"next", totpCode(key, counter + 1), true},
+		{"two periods ago", totpCode(key, counter - 2), false},
+		{"two periods ahead", totpCode(key, counter + 2), false},
+		{"too short", totpCode(key, counter)[1:], false},
+		{"too long", totpCode(key, counter) + "0", false},
+		{"empty", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, ok := checkTOTP(rfcSecret, tt.code, now); ok != tt.ok {
+				t.Errorf("checkTOTP(%q) = %v, want %v", tt.code, ok, tt.ok)
+			}
+		})
+	}
+	if _, ok := checkTOTP("not base32!", totpCode(key, counter), now); ok {
+		t.Error("code accepted for an invalid secret")
+	}
+}
+
+// useTestTOTPUser adds alice with two-factor authentication and returns her
+// recovery codes. Used codes and failures are forgotten after the test.
+func useTestTOTPUser(t *testing.T) []string {
+	t.Helper()
+	alice, codes, err := newTestUser(t, "alice").WithTOTP(rfcSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	useTestUsers(t, alice)
+	resetSecondFactor := func() {
+		secondFactorMutex.Lock()
+		clear(lastTOTPCounters)
+		clear(secondFactorFailures)
+		secondFactorMutex.Unlock()
+	}
+	resetSecondFactor()
+	t.Cleanup(resetSecondFactor)
+	return codes
+}
+
+func currentTOTPCode(offset int) string {
+	return totpCode([]byte("12345678901234567890"), uint64(time.Now().Unix() / totpPeriod + int64(offset)))
+}
+
+func TestCheckSecondFactorReplay(t *testing.T) {
+	useTestTOTPUser(t)
+	code := currentTOTPCode(0)
+	if err := CheckSecondFactor(ByName("alice"), code); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckSecondFactor(ByName("alice"), code); !errors.Is(err, ErrTOTP) {
+		t.Errorf("the same code again: err = %v, want %v", err, ErrTOTP)
+	}
+	// Older codes are still in the accepted window, but come before the used one
+	if err := CheckSecondFactor(ByName("alice"), currentTOTPCode(-1)); !errors.Is(err, ErrTOTP) {
+		t.Errorf("an older code: err = %v, want %v", err, ErrTOTP)
+	}
+	if err := CheckSecondFactor(ByName("alice"), currentTOTPCode(1)); err != nil {
+		t.Errorf("the next code: %v", err)
+	}
+}
+
+func TestCheckSecondFactorRecoveryCode(t *testing.T) {
+	codes := useTestTOTPUser(t)
+	if got := ByName("alice").RecoveryCodesLeft(); got != recoveryCodeCount {
+		t.Fatalf("%d recovery codes, want %d", got, recoveryCodeCount)
+	}
+	// Codes can be typed in capital letters, with spaces or without the dash
+	typed := " " + strings.ToUpper(strings.ReplaceAll(codes[3], "-", "")) + " "
+	if err := CheckSecondFactor(ByName("alice"), typed); err != nil {
+		t.Fatal(err)
+	}
+	if got := ByName("alice").RecoveryCodesLeft(); got != recoveryCodeCount - 1 {
+		t.Errorf("%d recovery codes left, want %d", got, recoveryCodeCount - 1)
+	}
+	if err := CheckSecondFactor(ByName("alice"), codes[3]); !errors.Is(err, ErrTOTP) {
+		t.Errorf("used code: err = %v, want %v", err, ErrTOTP)
+	}
+	// The user read before the code was used does not bring it back
+	stale := ByName("alice")
+	if err := CheckSecondFactor(stale, codes[4]); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckSecondFactor(stale, codes[4]); !errors.Is(err, ErrTOTP) {
+		t.Errorf("used code with a stale user: err = %v, want %v", err, ErrTOTP)
+	}
+
+	// New codes replace the old ones
+	renewed, newCodes, err := ByName("alice").WithNewRecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ReplaceUser(ByName("alice"), renewed); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckSecondFactor(ByName("alice"), codes[5]); !errors.Is(err, ErrTOTP) {
+		t.Errorf("old code: err = %v, want %v", err, ErrTOTP)
+	}
+	if err := CheckSecondFactor(ByName("alice"), newCodes[0]); err != nil {
+		t.Errorf("new code: %v", err)
+	}
+}
+
+func TestCheckSecondFactorBackoff(t *testing.T) {
+	useTestTOTPUser(t)
+	// wait lets the backoff pass and returns how long it was
+	wait := func() time.Duration {
+		secondFactorMutex.Lock()
+		defer secondFactorMutex.Unlock()
+		failure := secondFactorFailures["alice"]
+		backoff := time.Until(failure.next).Round(time.Second)
+		failure.next = time.Now()
+		return backoff
+	}
+
+	for i := range secondFactorFreeFailures {
+		if err := CheckSecondFactor(ByName("alice"), "000000"); !errors.Is(err, ErrTOTP) {
+			t.Fatalf("wrong code %d: err = %v, want %v", i + 1, err, ErrTOTP)
+		}
+	}
+	// Even the right code is not checked now
+	if err := CheckSecondFactor(ByName("alice"), currentTOTPCode(0)); !errors.Is(err, ErrTOTPLocked) {
+		t.Fatalf("err = %v, want %v", err, ErrTOTPLocked)
+	}
+	if got := wait(); got != secondFactorBackoff {
+		t.Errorf("backoff = %s, want %s", got, secondFactorBackoff)
+	}
+	if err := CheckSecondFactor(ByName("alice"), "000000"); !errors.Is(err, ErrTOTP) {
+		t.Fatalf("err = %v, want %v", err, ErrTOTP)
+	}
+	if got := wait(); got != 2 * secondFactorBackoff {
+		t.Errorf("backoff = %s, want %s", got, 2 * secondFactorBackoff)
+	}
+	for range 20 {
+		_ = CheckSecondFactor(ByName("alice"), "000000")
+		wait()
+	}
+	_ = CheckSecondFactor(ByName("alice"), "000000")
+	if got := wait(); got != secondFactorMaxBackoff {
+		t.Errorf("backoff = %s, want %s", got, secondFactorMaxBackoff)
+	}
+
+	// The right code resets the count
+	if err := CheckSecondFactor(ByName("alice"), currentTOTPCode(0)); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckSecondFactor(ByName("alice"), "000000"); !errors.Is(err, ErrTOTP) {
+		t.Errorf("err = %v, want %v", err, ErrTOTP)
+	}
+	if err := CheckSecondFactor(ByName("alice"), currentTOTPCode(1)); err != nil {
+		t.Errorf("right code after one wrong one: %v", err)
+	}
+}
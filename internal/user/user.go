@@ -17,6 +17,9 @@ type UserSource int
 const (
 	UserSourceLocal = iota
 	UserSourceTelegram
+	UserSourceOIDC
+	UserSourceLDAP
+	UserSourceProxy
 )
 
 // User contains information about a given user required for identification.
@@ -26,16 +29,31 @@ type User struct {
 	passwordHash []byte
 	registeredAt time.Time
 	source       UserSource
+	// totpSecret is the base32-encoded TOTP secret, if the user has set up
+	// two-factor authentication.
+	totpSecret string
+	// recoveryCodes are SHA-256 hashes of the unused recovery codes.
+	recoveryCodes []string
+	passkeys      []Passkey
+	// oidcIssuer and oidcSubject identify users from an OpenID Connect
+	// provider.
+	oidcIssuer  string
+	oidcSubject string
 }
 
 type userJson struct {
 	// Name is a username. It must follow hypha naming rules.
-	Name         string    `json:"name"`
-	Group        string    `json:"group"`
-	PasswordHash string    `json:"hashed_password"`
-	RegisteredAt time.Time `json:"registered_on"`
-	// Source is where the user from. Valid values: local, telegram.
-	Source       string    `json:"source"`
+	Name          string    `json:"name"`
+	Group         string    `json:"group"`
+	PasswordHash  string    `json:"hashed_password"`
+	RegisteredAt  time.Time `json:"registered_on"`
+	// Source is where the user from. Valid values: local, telegram, oidc, ldap, proxy.
+	Source        string    `json:"source"`
+	TOTPSecret    string    `json:"totp_secret,omitempty"`
+	RecoveryCodes []string  `json:"recovery_codes,omitempty"`
+	Passkeys      []Passkey `json:"passkeys,omitempty"`
+	OIDCIssuer    string    `json:"oidc_issuer,omitempty"`
+	OIDCSubject   string    `json:"oidc_subject,omitempty"`
 	// A note about why HashedPassword is string and not []byte. The reason is
 	// simple: golang's json marshals []byte as slice of numbers, which is not
 	// acceptable.
@@ -68,7 +86,8 @@ func WikimindUser() *User {
 
 // ValidSource checks whether provided user source name exists.
 func ValidSource(source string) bool {
-	return source == "local" || source == "telegram"
+	return source == "local" || source == "telegram" || source == "oidc" || source == "ldap" ||
+		source == "proxy"
 }
 
 func UserSourceFromString(source string) (UserSource, error) {
@@ -77,6 +96,12 @@ func UserSourceFromString(source string) (UserSource, error) {
 		return UserSourceLocal, nil
 	case "telegram":
 		return UserSourceTelegram, nil
+	case "oidc":
+		return UserSourceOIDC, nil
+	case "ldap":
+		return UserSourceLDAP, nil
+	case "proxy":
+		return UserSourceProxy, nil
 	default:
 		return UserSourceLocal, fmt.Errorf("invalid user source '%s'", source)
 	}
@@ -91,15 +116,26 @@ func (user *User) MarshalJSON() ([]byte, error) {
 	switch user.source {
 	case UserSourceTelegram:
 		src = "telegram"
+	case UserSourceOIDC:
+		src = "oidc"
+	case UserSourceLDAP:
+		src = "ldap"
+	case UserSourceProxy:
+		src = "proxy"
 	default:
 		src = "local"
 	}
 	return json.Marshal(userJson{
-		Name:         user.name,
-		Group:        user.group.Name(),
-		PasswordHash: string(user.passwordHash),
-		RegisteredAt: user.registeredAt,
-		Source:       src,
+		Name:          user.name,
+		Group:         user.group.Name(),
+		PasswordHash:  string(user.passwordHash),
+		RegisteredAt:  user.registeredAt,
+		Source:        src,
+		TOTPSecret:    user.totpSecret,
+		RecoveryCodes: user.recoveryCodes,
+		Passkeys:      user.passkeys,
+		OIDCIssuer:    user.oidcIssuer,
+		OIDCSubject:   user.oidcSubject,
 	})
 }
 
@@ -110,8 +146,15 @@ func (user *User) UnmarshalJSON(b []byte) error {
 		return err
 	}
 	var source UserSource = UserSourceLocal
-	if data.Source == "telegram" {
+	switch data.Source {
+	case "telegram":
 		source = UserSourceTelegram
+	case "oidc":
+		source = UserSourceOIDC
+	case "ldap":
+		source = UserSourceLDAP
+	case "proxy":
+		source = UserSourceProxy
 	}
 	user.name = util.CanonicalName(data.Name)
 	user.group, err = GroupByName(data.Group)
@@ -121,6 +164,11 @@ func (user *User) UnmarshalJSON(b []byte) error {
 	user.passwordHash = []byte(data.PasswordHash)
 	user.registeredAt = data.RegisteredAt
 	user.source = source
+	user.totpSecret = data.TOTPSecret
+	user.recoveryCodes = data.RecoveryCodes
+	user.passkeys = data.Passkeys
+	user.oidcIssuer = data.OIDCIssuer
+	user.oidcSubject = data.OIDCSubject
 	return nil
 }
 
@@ -144,7 +192,8 @@ func newUserPassword(
 	registeredAt time.Time, source UserSource,
 ) (*User, error) {
 	hash := []byte(nil)
-	if source != UserSourceTelegram {
+	// Users from elsewhere log in without passwords
+	if source == UserSourceLocal {
 		if password == "" {
 			return nil, fmt.Errorf("password must not be empty")
 		}
@@ -235,17 +284,17 @@ func (user *User) WithPassword(password string) (*User, error) {
 	if user.source != UserSourceLocal {
 		return nil, fmt.Errorf("Only local users can change their passwords.")
 	}
-	return newUserPassword(
+	return user.withCredentials(newUserPassword(
 		user.name, user.group, password,
 		user.registeredAt, user.source,
-	)
+	))
 }
 
 func (user *User) WithGroup(group Group) (*User, error) {
-	return newUser(
+	return user.withCredentials(newUser(
 		user.name, group, user.passwordHash,
 		user.registeredAt, user.source,
-	)
+	))
 }
 
 func (user *User) WithGroupName(group string) (*User, error) {
@@ -257,10 +306,23 @@ func (user *User) WithGroupName(group string) (*User, error) {
 }
 
 func (user *User) WithName(name string) (*User, error) {
-	return newUser(
+	return user.withCredentials(newUser(
 		name, user.group, user.passwordHash,
 		user.registeredAt, user.source,
-	)
+	))
+}
+
+// withCredentials copies the two-factor authentication data, the passkeys and
+// the OpenID Connect identity of the user to the new version of it.
+func (user *User) withCredentials(res *User, err error) (*User, error) {
+	if err == nil {
+		res.totpSecret = user.totpSecret
+		res.recoveryCodes = user.recoveryCodes
+		res.passkeys = user.passkeys
+		res.oidcIssuer = user.oidcIssuer
+		res.oidcSubject = user.oidcSubject
+	}
+	return res, err
 }
 
 // IsValidUsername checks if the given username is valid.
@@ -59,9 +59,15 @@ func HasAnyAdmins() bool {
 	return false
 }
 
-// CredentialsOK checks whether a correct user-password pair is provided
+// CredentialsOK checks whether a correct user-password pair is provided.
+// LDAP users are checked against the directory, and so are unknown users if
+// LDAP is enabled. They are created or updated if the check passes.
 func CredentialsOK(username, password string) bool {
-	return ByName(username).IsCorrectPassword(password)
+	user := ByName(username)
+	if user.Source() == UserSourceLDAP || (user.IsEmpty() && cfg.LDAPEnabled) {
+		return ldapCredentialsOK(user, username, password)
+	}
+	return user.IsCorrectPassword(password)
 }
 
 // ByToken finds a user by provided session token
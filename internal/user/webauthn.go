@@ -0,0 +1,554 @@
+package user
+
+// File `webauthn.go` contains passwordless login with passkeys, as described
+// in the Web Authentication specification. Only the parts needed for
+// passkeys are implemented: attestation statements are not verified, the
+// authenticator has to verify the user.
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bouncepaw/mycorrhiza/internal/cfg"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+var (
+	ErrPasskey          = errors.New("could not verify the passkey")
+	ErrPasskeyExpired   = errors.New("the passkey request expired, try again")
+	ErrPasskeyUnknown   = errors.New("unknown passkey")
+	ErrPasskeyNotLocal  = errors.New("only local users can use passkeys")
+	ErrPasskeyDuplicate = errors.New("the passkey is already added")
+	ErrPasskeyNotFound  = errors.New("no such passkey")
+)
+
+// Passkey is a WebAuthn credential of a user.
+type Passkey struct {
+	// ID is the base64url-encoded credential ID.
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// PublicKey is the base64url-encoded public key in the COSE format.
+	PublicKey string    `json:"public_key"`
+	SignCount uint32    `json:"sign_count"`
+	CreatedAt time.Time `json:"created_on"`
+}
+
+const (
+	passkeyTimeout       = 5 * time.Minute
+	passkeyNameMaxLength = 64
+
+	flagUserPresent        = 0x01
+	flagUserVerified       = 0x04
+	flagAttestedCredential = 0x40
+
+	coseAlgES256 = -7
+	coseAlgEdDSA = -8
+	coseAlgRS256 = -257
+)
+
+var b64 = base64.RawURLEncoding
+
+// Challenges are not stored when issued, so that anyone asking for them
+// cannot fill the memory. A challenge is a random nonce and its expiration
+// time, signed with a key known only to the wiki. The signature also covers
+// whether the challenge is for a login or for adding a passkey to a user.
+// Challenges are remembered once they have been used successfully, until
+// they expire, so that every challenge works only once.
+const (
+	passkeyNonceSize     = 16
+	passkeyChallengeSize = passkeyNonceSize + 8 + sha256.Size
+)
+
+var (
+	// passkeyKey signs challenges. It changes every time the wiki starts.
+	passkeyKey = sync.OnceValues(func() ([]byte, error) {
+		key := make([]byte, 32)
+		_, err := rand.Read(key)
+		return key, err
+	})
+
+	passkeyMutex sync.Mutex
+	// usedPasskeyChallenges maps used challenges to their expiration times.
+	usedPasskeyChallenges = make(map[string]time.Time)
+)
+
+// signPasskeyChallenge returns the signature of the challenge nonce and
+// expiration time. Login challenges have no username.
+func signPasskeyChallenge(key, nonceAndExpiry []byte, username string, login bool) []byte {
+	mac := hmac.New(sha256.New, key)
+	if login {
+		mac.Write([]byte{'l'})
+	} else {
+		mac.Write([]byte{'c'})
+	}
+	mac.Write(nonceAndExpiry)
+	mac.Write([]byte(username))
+	return mac.Sum(nil)
+}
+
+// newPasskeyChallenge returns a new challenge.
+func newPasskeyChallenge(username string, login bool) (string, error) {
+	key, err := passkeyKey()
+	if err != nil {
+		return "", err
+	}
+	b := make([]byte, passkeyNonceSize, passkeyChallengeSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	b = binary.BigEndian.AppendUint64(b, uint64(time.Now().Add(passkeyTimeout).Unix()))
+	b = append(b, signPasskeyChallenge(key, b, username, login)...)
+	return b64.EncodeToString(b), nil
+}
+
+// checkPasskeyChallenge checks that the challenge was issued by the wiki for
+// the user or for a login, did not expire and was not used.
+func checkPasskeyChallenge(challenge string, username string, login bool) error {
+	key, err := passkeyKey()
+	if err != nil {
+		return err
+	}
+	b, err := b64.DecodeString(challenge)
+	if err != nil || len(b) != passkeyChallengeSize {
+		return ErrPasskeyExpired
+	}
+	signed, sig := b[:passkeyNonceSize+8], b[passkeyNonceSize+8:]
+	if !hmac.Equal(sig, signPasskeyChallenge(key, signed, username, login)) {
+		return ErrPasskeyExpired
+	}
+	expires := time.Unix(int64(binary.BigEndian.Uint64(signed[passkeyNonceSize:])), 0)
+	if time.Now().After(expires) {
+		return ErrPasskeyExpired
+	}
+
+	passkeyMutex.Lock()
+	defer passkeyMutex.Unlock()
+	if _, used := usedPasskeyChallenges[challenge]; used {
+		return ErrPasskeyExpired
+	}
+	return nil
+}
+
+// usePasskeyChallenge remembers that the checked challenge was answered
+// correctly. It fails if it was used meanwhile.
+func usePasskeyChallenge(challenge string) error {
+	b, _ := b64.DecodeString(challenge)
+	expires := time.Unix(int64(binary.BigEndian.Uint64(b[passkeyNonceSize:])), 0)
+
+	passkeyMutex.Lock()
+	defer passkeyMutex.Unlock()
+	for c, exp := range usedPasskeyChallenges {
+		if time.Now().After(exp) {
+			delete(usedPasskeyChallenges, c)
+		}
+	}
+	if _, used := usedPasskeyChallenges[challenge]; used {
+		return ErrPasskeyExpired
+	}
+	usedPasskeyChallenges[challenge] = expires
+	return nil
+}
+
+// rpID returns the relying party ID, which is the host name of the wiki.
+func rpID() string {
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
+
+func passkeyOrigin() string {
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return ""
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+// PasskeyCreationOptions returns the options for navigator.credentials.create
+// in the JSON form of PublicKeyCredentialCreationOptions.
+func PasskeyCreationOptions(user *User) (map[string]any, error) {
+	if user.source != UserSourceLocal {
+		return nil, ErrPasskeyNotLocal
+	}
+	challenge, err := newPasskeyChallenge(user.name, false)
+	if err != nil {
+		return nil, err
+	}
+	exclude := []map[string]any{}
+	for _, passkey := range user.passkeys {
+		exclude = append(exclude, map[string]any{"type": "public-key", "id": passkey.ID})
+	}
+	params := []map[string]any{}
+	for _, alg := range []int{coseAlgES256, coseAlgEdDSA, coseAlgRS256} {
+		params = append(params, map[string]any{"type": "public-key", "alg": alg})
+	}
+	return map[string]any{
+		"challenge": challenge,
+		"rp": map[string]any{
+			"id":   rpID(),
+			"name": cfg.WikiName,
+		},
+		"user": map[string]any{
+			"id":          b64.EncodeToString([]byte(user.name)),
+			"name":        user.name,
+			"displayName": user.name,
+		},
+		"pubKeyCredParams":   params,
+		"excludeCredentials": exclude,
+		"authenticatorSelection": map[string]any{
+			"residentKey":        "required",
+			"requireResidentKey": true,
+			"userVerification":   "required",
+		},
+		"attestation": "none",
+		"timeout":     passkeyTimeout.Milliseconds(),
+	}, nil
+}
+
+// PasskeyRequestOptions returns the options for navigator.credentials.get in
+// the JSON form of PublicKeyCredentialRequestOptions. No credentials are
+// listed, the browser offers the passkeys it has for the wiki.
+func PasskeyRequestOptions() (map[string]any, error) {
+	challenge, err := newPasskeyChallenge("", true)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{
+		"challenge":        challenge,
+		"rpId":             rpID(),
+		"allowCredentials": []any{},
+		"userVerification": "required",
+		"timeout":          passkeyTimeout.Milliseconds(),
+	}, nil
+}
+
+// Passkeys returns the passkeys of the user.
+func (user *User) Passkeys() []Passkey {
+	return slices.Clone(user.passkeys)
+}
+
+// WithPasskey verifies the response of navigator.credentials.create and
+// returns the user with the new passkey. The arguments but the name are
+// base64url-encoded.
+func (user *User) WithPasskey(name, clientDataJSON, attestationObject string) (*User, error) {
+	if user.source != UserSourceLocal {
+		return nil, ErrPasskeyNotLocal
+	}
+	challenge, err := checkClientData(clientDataJSON, "webauthn.create", user.name)
+	if err != nil {
+		return nil, err
+	}
+
+	rawAttestation, err := decodeB64(attestationObject)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrPasskey, err)
+	}
+	var attestation struct {
+		AuthData []byte `cbor:"authData"`
+	}
+	if err := cbor.Unmarshal(rawAttestation, &attestation); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrPasskey, err)
+	}
+	authData, err := parseAuthenticatorData(attestation.AuthData)
+	if err != nil {
+		return nil, err
+	}
+	if authData.flags&flagAttestedCredential == 0 {
+		return nil, fmt.Errorf("%w: no credential", ErrPasskey)
+	}
+	if _, _, err := parsePasskeyKey(authData.publicKey); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrPasskey, err)
+	}
+
+	id := b64.EncodeToString(authData.credentialID)
+	if owner, _ := byPasskey(id); !owner.IsEmpty() {
+		return nil, ErrPasskeyDuplicate
+	}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = fmt.Sprintf("Passkey %d", len(user.passkeys)+1)
+	}
+	for utf8.RuneCountInString(name) > passkeyNameMaxLength {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+
+	if err := usePasskeyChallenge(challenge); err != nil {
+		return nil, err
+	}
+	res := *user
+	res.passkeys = append(slices.Clone(user.passkeys), Passkey{
+		ID:        id,
+		Name:      name,
+		PublicKey: b64.EncodeToString(authData.publicKey),
+		SignCount: authData.signCount,
+		CreatedAt: time.Now(),
+	})
+	return &res, nil
+}
+
+// WithoutPasskey returns the user without the passkey with the ID.
+func (user *User) WithoutPasskey(id string) (*User, error) {
+	i := slices.IndexFunc(user.passkeys, func(passkey Passkey) bool {
+		return passkey.ID == id
+	})
+	if i < 0 {
+		return nil, ErrPasskeyNotFound
+	}
+	res := *user
+	res.passkeys = slices.Delete(slices.Clone(user.passkeys), i, i+1)
+	return &res, nil
+}
+
+// LoginPasskeyHTTP verifies the response of navigator.credentials.get and
+// logs the owner of the passkey in. The arguments are base64url-encoded. The
+// username is returned.
+func LoginPasskeyHTTP(w http.ResponseWriter, id, clientDataJSON, authenticatorData, signature string) (string, error) {
+	w.Header().Set("Content-Type", "text/html;charset=utf-8")
+	username, err := checkPasskeyAssertion(id, clientDataJSON, authenticatorData, signature)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return username, err
+	}
+	return username, LoginHTTP(w, username)
+}
+
+func checkPasskeyAssertion(id, clientDataJSON, authenticatorData, signature string) (string, error) {
+	challenge, err := checkClientData(clientDataJSON, "webauthn.get", "")
+	if err != nil {
+		return "", err
+	}
+	user, passkey := byPasskey(id)
+	if user.IsEmpty() {
+		return "", ErrPasskeyUnknown
+	}
+	if user.source != UserSourceLocal {
+		return user.name, ErrPasskeyNotLocal
+	}
+
+	rawAuthData, err := decodeB64(authenticatorData)
+	if err != nil {
+		return user.name, fmt.Errorf("%w: %w", ErrPasskey, err)
+	}
+	authData, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return user.name, err
+	}
+	rawClientData, _ := decodeB64(clientDataJSON)
+	clientDataHash := sha256.Sum256(rawClientData)
+	sig, err := decodeB64(signature)
+	if err != nil {
+		return user.name, fmt.Errorf("%w: %w", ErrPasskey, err)
+	}
+	rawKey, err := decodeB64(passkey.PublicKey)
+	if err != nil {
+		return user.name, fmt.Errorf("%w: %w", ErrPasskey, err)
+	}
+	key, alg, err := parsePasskeyKey(rawKey)
+	if err != nil {
+		return user.name, fmt.Errorf("%w: %w", ErrPasskey, err)
+	}
+	signed := append(slices.Clone(rawAuthData), clientDataHash[:]...)
+	if err := verifyPasskeySignature(alg, key, signed, sig); err != nil {
+		return user.name, err
+	}
+
+	// Authenticators that count signatures give a greater number every time.
+	// A smaller one means that the passkey was cloned.
+	if (authData.signCount != 0 || passkey.SignCount != 0) && authData.signCount <= passkey.SignCount {
+		return user.name, fmt.Errorf("%w: the signature counter went back", ErrPasskey)
+	}
+	if err := usePasskeyChallenge(challenge); err != nil {
+		return user.name, err
+	}
+	if authData.signCount != passkey.SignCount {
+		updated := *user
+		updated.passkeys = slices.Clone(user.passkeys)
+		for i := range updated.passkeys {
+			if updated.passkeys[i].ID == passkey.ID {
+				updated.passkeys[i].SignCount = authData.signCount
+			}
+		}
+		if err := ReplaceUser(user, &updated); err != nil {
+			return user.name, err
+		}
+	}
+	return user.name, nil
+}
+
+// checkClientData checks the client data sent by the browser and returns the
+// challenge it answers. Login challenges are checked if the username is
+// empty, challenges for adding a passkey to the user otherwise.
+func checkClientData(clientDataJSON, typ, username string) (string, error) {
+	raw, err := decodeB64(clientDataJSON)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrPasskey, err)
+	}
+	var clientData struct {
+		Type      string `json:"type"`
+		Challenge string `json:"challenge"`
+		Origin    string `json:"origin"`
+	}
+	if err := json.Unmarshal(raw, &clientData); err != nil {
+		return "", fmt.Errorf("%w: %w", ErrPasskey, err)
+	}
+	if clientData.Type != typ {
+		return "", fmt.Errorf("%w: wrong type %s", ErrPasskey, clientData.Type)
+	}
+	if clientData.Origin != passkeyOrigin() {
+		return "", fmt.Errorf("%w: wrong origin %s, the wiki URL is %s", ErrPasskey, clientData.Origin, cfg.URL)
+	}
+	if err := checkPasskeyChallenge(clientData.Challenge, username, username == ""); err != nil {
+		return "", err
+	}
+	return clientData.Challenge, nil
+}
+
+type authenticatorData struct {
+	flags        byte
+	signCount    uint32
+	credentialID []byte
+	publicKey    []byte
+}
+
+// parseAuthenticatorData parses the authenticator data and checks that it is
+// meant for the wiki and that the user was verified.
+func parseAuthenticatorData(b []byte) (authenticatorData, error) {
+	var res authenticatorData
+	if len(b) < 37 {
+		return res, fmt.Errorf("%w: short authenticator data", ErrPasskey)
+	}
+	rpIDHash := sha256.Sum256([]byte(rpID()))
+	if !bytes.Equal(b[:32], rpIDHash[:]) {
+		return res, fmt.Errorf("%w: the passkey is for another site", ErrPasskey)
+	}
+	res.flags = b[32]
+	res.signCount = binary.BigEndian.Uint32(b[33:37])
+	if res.flags&flagUserPresent == 0 || res.flags&flagUserVerified == 0 {
+		return res, fmt.Errorf("%w: the user was not verified", ErrPasskey)
+	}
+	if res.flags&flagAttestedCredential == 0 {
+		return res, nil
+	}
+
+	// AAGUID, credential ID length, credential ID, public key
+	rest := b[37:]
+	if len(rest) < 18 {
+		return res, fmt.Errorf("%w: short credential data", ErrPasskey)
+	}
+	idLen := int(binary.BigEndian.Uint16(rest[16:18]))
+	rest = rest[18:]
+	if len(rest) < idLen {
+		return res, fmt.Errorf("%w: short credential ID", ErrPasskey)
+	}
+	res.credentialID = rest[:idLen]
+	var key cbor.RawMessage
+	if _, err := cbor.UnmarshalFirst(rest[idLen:], &key); err != nil {
+		return res, fmt.Errorf("%w: %w", ErrPasskey, err)
+	}
+	res.publicKey = key
+	return res, nil
+}
+
+// parsePasskeyKey parses a COSE public key and returns it with its algorithm.
+func parsePasskeyKey(b []byte) (crypto.PublicKey, int, error) {
+	var key map[int]cbor.RawMessage
+	if err := cbor.Unmarshal(b, &key); err != nil {
+		return nil, 0, err
+	}
+	var kty, alg, crv int
+	if err := cbor.Unmarshal(key[1], &kty); err != nil {
+		return nil, 0, fmt.Errorf("bad key type: %w", err)
+	}
+	if err := cbor.Unmarshal(key[3], &alg); err != nil {
+		return nil, 0, fmt.Errorf("bad algorithm: %w", err)
+	}
+	param := func(label int) []byte {
+		var v []byte
+		_ = cbor.Unmarshal(key[label], &v)
+		return v
+	}
+
+	switch {
+	case kty == 2 && alg == coseAlgES256:
+		if err := cbor.Unmarshal(key[-1], &crv); err != nil || crv != 1 {
+			return nil, 0, errors.New("unsupported curve")
+		}
+		x := new(big.Int).SetBytes(param(-2))
+		y := new(big.Int).SetBytes(param(-3))
+		if !elliptic.P256().IsOnCurve(x, y) {
+			return nil, 0, errors.New("the point is not on the curve")
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, alg, nil
+	case kty == 1 && alg == coseAlgEdDSA:
+		x := param(-2)
+		if err := cbor.Unmarshal(key[-1], &crv); err != nil || crv != 6 || len(x) != ed25519.PublicKeySize {
+			return nil, 0, errors.New("unsupported curve")
+		}
+		return ed25519.PublicKey(x), alg, nil
+	case kty == 3 && alg == coseAlgRS256:
+		n := new(big.Int).SetBytes(param(-1))
+		e := new(big.Int).SetBytes(param(-2))
+		if n.Sign() == 0 || !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, 0, errors.New("bad RSA key")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, alg, nil
+	}
+	return nil, 0, fmt.Errorf("unsupported key type %d with algorithm %d", kty, alg)
+}
+
+func verifyPasskeySignature(alg int, key crypto.PublicKey, signed, sig []byte) error {
+	digest := sha256.Sum256(signed)
+	ok := false
+	switch key := key.(type) {
+	case *ecdsa.PublicKey:
+		ok = alg == coseAlgES256 && ecdsa.VerifyASN1(key, digest[:], sig)
+	case ed25519.PublicKey:
+		ok = alg == coseAlgEdDSA && ed25519.Verify(key, signed, sig)
+	case *rsa.PublicKey:
+		ok = alg == coseAlgRS256 && rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig) == nil
+	}
+	if !ok {
+		return fmt.Errorf("%w: bad signature", ErrPasskey)
+	}
+	return nil
+}
+
+// byPasskey returns the user with the passkey and the passkey.
+func byPasskey(id string) (*User, Passkey) {
+	for user := range YieldUsers() {
+		for _, passkey := range user.passkeys {
+			if passkey.ID == id {
+				return user, passkey
+			}
+		}
+	}
+	return emptyUser, Passkey{}
+}
+
+func decodeB64(s string) ([]byte, error) {
+	return b64.DecodeString(strings.TrimRight(s, "="))
+}
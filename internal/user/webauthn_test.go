@@ -0,0 +1,457 @@
+package user
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/bouncepaw/mycorrhiza/internal/cfg"
+	"github.com/bouncepaw/mycorrhiza/internal/files"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+const testOrigin = "https://wiki.example.org"
+
+// useTestUsers makes the users the only ones of the wiki. The user database
+// is written to a temporary directory.
+func useTestUsers(t *testing.T, list ...*User) {
+	t.Helper()
+	wikiDir, url := cfg.WikiDir, cfg.URL
+	t.Cleanup(func() {
+		cfg.WikiDir, cfg.URL = wikiDir, url
+		rememberUsers(nil)
+	})
+	cfg.WikiDir = t.TempDir()
+	cfg.URL = testOrigin
+	if err := files.PrepareWikiRoot(); err != nil {
+		t.Fatal(err)
+	}
+	setGroups([]Group{EmptyGroup(), NewGroup("editor", 1), AdminGroup()})
+	rememberUsers(list)
+}
+
+func newTestUser(t *testing.T, name string) *User {
+	t.Helper()
+	user, err := newUser(name, NewGroup("editor", 1), []byte("hash"), time.Now(), UserSourceLocal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// testAuthenticator is a passkey authenticator with a single credential.
+type testAuthenticator struct {
+	id        []byte
+	alg       int
+	key       crypto.Signer
+	signCount uint32
+
+	// These are changed to make bad responses.
+	rpID   string
+	origin string
+	flags  byte
+}
+
+func newTestAuthenticator(t *testing.T, alg int) *testAuthenticator {
+	t.Helper()
+	var (
+		key crypto.Signer
+		err error
+	)
+	switch alg {
+	case coseAlgES256:
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case coseAlgEdDSA:
+		_, key, err = ed25519.GenerateKey(rand.Reader)
+	case coseAlgRS256:
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	return &testAuthenticator{
+		id:     id,
+		alg:    alg,
+		key:    key,
+		rpID:   "wiki.example.org",
+		origin: testOrigin,
+		flags:  flagUserPresent | flagUserVerified,
+	}
+}
+
+// coseKey returns the public key in the COSE format.
+func (a *testAuthenticator) coseKey() []byte {
+	var key map[int]any
+	switch pub := a.key.Public().(type) {
+	case *ecdsa.PublicKey:
+		key = map[int]any{1: 2, 3: a.alg, -1: 1, -2: pub.X.FillBytes(make([]byte, 32)), -3: pub.Y.FillBytes(make([]byte, 32))}
+	case ed25519.PublicKey:
+		key = map[int]any{1: 1, 3: a.alg, -1: 6, -2: []byte(pub)}
+	case *rsa.PublicKey:
+		key = map[int]any{1: 3, 3: a.alg, -1: pub.N.Bytes(), -2: big.NewInt(int64(pub.E)).Bytes()}
+	}
+	b, err := cbor.Marshal(key)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func (a *testAuthenticator) authData(attested bool) []byte {
+	rpIDHash := sha256.Sum256([]byte(a.rpID))
+	b := append([]byte{}, rpIDHash[:]...)
+	flags := a.flags
+	if attested {
+		flags |= flagAttestedCredential
+	}
+	b = append(b, flags)
+	b = binary.BigEndian.AppendUint32(b, a.signCount)
+	if attested {
+		b = append(b, make([]byte, 16)...) // AAGUID
+		b = binary.BigEndian.AppendUint16(b, uint16(len(a.id)))
+		b = append(b, a.id...)
+		b = append(b, a.coseKey()...)
+	}
+	return b
+}
+
+func (a *testAuthenticator) clientData(typ, challenge string) []byte {
+	b, err := json.Marshal(map[string]any{
+		"type":        typ,
+		"challenge":   challenge,
+		"origin":      a.origin,
+		"crossOrigin": false,
+	})
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// create answers navigator.credentials.create.
+func (a *testAuthenticator) create(challenge string) (clientDataJSON, attestationObject string) {
+	att, err := cbor.Marshal(map[string]any{
+		"fmt":      "none",
+		"attStmt":  map[string]any{},
+		"authData": a.authData(true),
+	})
+	if err != nil {
+		panic(err)
+	}
+	return b64.EncodeToString(a.clientData("webauthn.create", challenge)), b64.EncodeToString(att)
+}
+
+// get answers navigator.credentials.get.
+func (a *testAuthenticator) get(challenge string) (id, clientDataJSON, authenticatorData, signature string) {
+	clientData := a.clientData("webauthn.get", challenge)
+	authData := a.authData(false)
+	clientDataHash := sha256.Sum256(clientData)
+	signed := append(append([]byte{}, authData...), clientDataHash[:]...)
+	var (
+		sig []byte
+		err error
+	)
+	if a.alg == coseAlgEdDSA {
+		sig, err = a.key.Sign(rand.Reader, signed, crypto.Hash(0))
+	} else {
+		digest := sha256.Sum256(signed)
+		sig, err = a.key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	}
+	if err != nil {
+		panic(err)
+	}
+	return b64.EncodeToString(a.id), b64.EncodeToString(clientData), b64.EncodeToString(authData), b64.EncodeToString(sig)
+}
+
+func creationChallenge(t *testing.T, user *User) string {
+	t.Helper()
+	opts, err := PasskeyCreationOptions(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return opts["challenge"].(string)
+}
+
+func loginChallenge(t *testing.T) string {
+	t.Helper()
+	opts, err := PasskeyRequestOptions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return opts["challenge"].(string)
+}
+
+// expiredChallenge returns a challenge signed by the wiki that expired a
+// minute ago.
+func expiredChallenge(t *testing.T, username string, login bool) string {
+	t.Helper()
+	key, err := passkeyKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, passkeyNonceSize)
+	_, _ = rand.Read(b)
+	b = binary.BigEndian.AppendUint64(b, uint64(time.Now().Add(-time.Minute).Unix()))
+	b = append(b, signPasskeyChallenge(key, b, username, login)...)
+	return b64.EncodeToString(b)
+}
+
+// addTestPasskey registers the authenticator for the user and returns the
+// updated user.
+func addTestPasskey(t *testing.T, user *User, a *testAuthenticator) *User {
+	t.Helper()
+	clientData, attestation := a.create(creationChallenge(t, user))
+	updated, err := user.WithPasskey("Laptop", clientData, attestation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ReplaceUser(user, updated); err != nil {
+		t.Fatal(err)
+	}
+	return updated
+}
+
+func TestPasskey(t *testing.T) {
+	for _, alg := range []int{coseAlgES256, coseAlgEdDSA, coseAlgRS256} {
+		t.Run(map[int]string{coseAlgES256: "ES256", coseAlgEdDSA: "EdDSA", coseAlgRS256: "RS256"}[alg], func(t *testing.T) {
+			alice := newTestUser(t, "alice")
+			useTestUsers(t, alice)
+			a := newTestAuthenticator(t, alg)
+			a.signCount = 1
+			alice = addTestPasskey(t, alice, a)
+			if passkeys := alice.Passkeys(); len(passkeys) != 1 || passkeys[0].Name != "Laptop" || passkeys[0].SignCount != 1 {
+				t.Fatalf("passkeys = %+v", passkeys)
+			}
+
+			a.signCount = 2
+			username, err := checkPasskeyAssertion(a.get(loginChallenge(t)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if username != "alice" {
+				t.Errorf("username = %q, want alice", username)
+			}
+			if got := ByName("alice").Passkeys()[0].SignCount; got != 2 {
+				t.Errorf("sign count = %d, want 2", got)
+			}
+		})
+	}
+}
+
+func TestPasskeyRegistrationErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		want error
+		// change makes the authenticator or the challenge wrong
+		change func(t *testing.T, a *testAuthenticator, user *User) (challenge string)
+	}{
+		{"wrong origin", ErrPasskey, func(t *testing.T, a *testAuthenticator, user *User) string {
+			a.origin = "https://evil.example.org"
+			return creationChallenge(t, user)
+		}},
+		{"wrong rpId", ErrPasskey, func(t *testing.T, a *testAuthenticator, user *User) string {
+			a.rpID = "evil.example.org"
+			return creationChallenge(t, user)
+		}},
+		{"user not present", ErrPasskey, func(t *testing.T, a *testAuthenticator, user *User) string {
+			a.flags = flagUserVerified
+			return creationChallenge(t, user)
+		}},
+		{"user not verified", ErrPasskey, func(t *testing.T, a *testAuthenticator, user *User) string {
+			a.flags = flagUserPresent
+			return creationChallenge(t, user)
+		}},
+		{"challenge of another user", ErrPasskeyExpired, func(t *testing.T, a *testAuthenticator, user *User) string {
+			return creationChallenge(t, newTestUser(t, "mallory"))
+		}},
+		{"login challenge", ErrPasskeyExpired, func(t *testing.T, a *testAuthenticator, user *User) string {
+			return loginChallenge(t)
+		}},
+		{"expired challenge", ErrPasskeyExpired, func(t *testing.T, a *testAuthenticator, user *User) string {
+			return expiredChallenge(t, user.Name(), false)
+		}},
+		{"forged challenge", ErrPasskeyExpired, func(t *testing.T, a *testAuthenticator, user *User) string {
+			return b64.EncodeToString(make([]byte, passkeyChallengeSize))
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			alice := newTestUser(t, "alice")
+			useTestUsers(t, alice)
+			a := newTestAuthenticator(t, coseAlgES256)
+			clientData, attestation := a.create(tt.change(t, a, alice))
+			if _, err := alice.WithPasskey("", clientData, attestation); !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestPasskeyRegistrationReplay(t *testing.T) {
+	alice := newTestUser(t, "alice")
+	useTestUsers(t, alice)
+	a := newTestAuthenticator(t, coseAlgES256)
+	clientData, attestation := a.create(creationChallenge(t, alice))
+	if _, err := alice.WithPasskey("", clientData, attestation); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := alice.WithPasskey("", clientData, attestation); !errors.Is(err, ErrPasskeyExpired) {
+		t.Errorf("err = %v, want %v", err, ErrPasskeyExpired)
+	}
+}
+
+func TestPasskeyDuplicate(t *testing.T) {
+	alice := newTestUser(t, "alice")
+	useTestUsers(t, alice)
+	a := newTestAuthenticator(t, coseAlgES256)
+	alice = addTestPasskey(t, alice, a)
+	clientData, attestation := a.create(creationChallenge(t, alice))
+	if _, err := alice.WithPasskey("", clientData, attestation); !errors.Is(err, ErrPasskeyDuplicate) {
+		t.Errorf("err = %v, want %v", err, ErrPasskeyDuplicate)
+	}
+}
+
+func TestPasskeyAssertionErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		want error
+		// change makes the authenticator or the challenge wrong
+		change func(t *testing.T, a *testAuthenticator, user *User) (challenge string)
+	}{
+		{"wrong origin", ErrPasskey, func(t *testing.T, a *testAuthenticator, user *User) string {
+			a.origin = "http://wiki.example.org"
+			return loginChallenge(t)
+		}},
+		{"wrong rpId", ErrPasskey, func(t *testing.T, a *testAuthenticator, user *User) string {
+			a.rpID = "example.org"
+			return loginChallenge(t)
+		}},
+		{"user not present", ErrPasskey, func(t *testing.T, a *testAuthenticator, user *User) string {
+			a.flags = flagUserVerified
+			return loginChallenge(t)
+		}},
+		{"user not verified", ErrPasskey, func(t *testing.T, a *testAuthenticator, user *User) string {
+			a.flags = flagUserPresent
+			return loginChallenge(t)
+		}},
+		{"sign count went back", ErrPasskey, func(t *testing.T, a *testAuthenticator, user *User) string {
+			a.signCount = 4
+			return loginChallenge(t)
+		}},
+		{"sign count did not change", ErrPasskey, func(t *testing.T, a *testAuthenticator, user *User) string {
+			a.signCount = 5
+			return loginChallenge(t)
+		}},
+		{"sign count stopped", ErrPasskey, func(t *testing.T, a *testAuthenticator, user *User) string {
+			a.signCount = 0
+			return loginChallenge(t)
+		}},
+		{"expired challenge", ErrPasskeyExpired, func(t *testing.T, a *testAuthenticator, user *User) string {
+			return expiredChallenge(t, "", true)
+		}},
+		{"creation challenge", ErrPasskeyExpired, func(t *testing.T, a *testAuthenticator, user *User) string {
+			return creationChallenge(t, user)
+		}},
+		{"other key", ErrPasskey, func(t *testing.T, a *testAuthenticator, user *User) string {
+			a.key = newTestAuthenticator(t, coseAlgES256).key
+			return loginChallenge(t)
+		}},
+		{"unknown passkey", ErrPasskeyUnknown, func(t *testing.T, a *testAuthenticator, user *User) string {
+			a.id = []byte("unknown")
+			return loginChallenge(t)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			alice := newTestUser(t, "alice")
+			useTestUsers(t, alice)
+			a := newTestAuthenticator(t, coseAlgES256)
+			a.signCount = 5
+			addTestPasskey(t, alice, a)
+			a.signCount = 6
+
+			challenge := tt.change(t, a, alice)
+			if _, err := checkPasskeyAssertion(a.get(challenge)); !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestPasskeyAssertionReplay(t *testing.T) {
+	alice := newTestUser(t, "alice")
+	useTestUsers(t, alice)
+	a := newTestAuthenticator(t, coseAlgEdDSA)
+	addTestPasskey(t, alice, a)
+
+	// A failed attempt does not use the challenge up
+	challenge := loginChallenge(t)
+	good := a.key
+	a.key = newTestAuthenticator(t, coseAlgEdDSA).key
+	if _, err := checkPasskeyAssertion(a.get(challenge)); err == nil {
+		t.Fatal("logged in with another key")
+	}
+	a.key = good
+	id, clientData, authData, sig := a.get(challenge)
+	if _, err := checkPasskeyAssertion(id, clientData, authData, sig); err != nil {
+		t.Fatal(err)
+	}
+	// The counter stays zero, so only the used challenge stops a replay
+	if _, err := checkPasskeyAssertion(id, clientData, authData, sig); !errors.Is(err, ErrPasskeyExpired) {
+		t.Errorf("replayed: err = %v, want %v", err, ErrPasskeyExpired)
+	}
+	if _, err := checkPasskeyAssertion(a.get(challenge)); !errors.Is(err, ErrPasskeyExpired) {
+		t.Errorf("signed again: err = %v, want %v", err, ErrPasskeyExpired)
+	}
+}
+
+func TestPasskeyNotLocal(t *testing.T) {
+	bob, err := newUser("bob", NewGroup("editor", 1), nil, time.Now(), UserSourceOIDC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	useTestUsers(t, bob)
+	if _, err := PasskeyCreationOptions(bob); !errors.Is(err, ErrPasskeyNotLocal) {
+		t.Errorf("err = %v, want %v", err, ErrPasskeyNotLocal)
+	}
+}
+
+func TestParsePasskeyKey(t *testing.T) {
+	valid := newTestAuthenticator(t, coseAlgES256).coseKey()
+	offCurve, _ := cbor.Marshal(map[int]any{1: 2, 3: coseAlgES256, -1: 1, -2: make([]byte, 32), -3: make([]byte, 32)})
+	wrongCurve, _ := cbor.Marshal(map[int]any{1: 2, 3: coseAlgES256, -1: 2, -2: make([]byte, 32), -3: make([]byte, 32)})
+	shortEd25519, _ := cbor.Marshal(map[int]any{1: 1, 3: coseAlgEdDSA, -1: 6, -2: make([]byte, 31)})
+	wrongAlg, _ := cbor.Marshal(map[int]any{1: 2, 3: coseAlgRS256, -1: 1})
+	tests := []struct {
+		name string
+		key  []byte
+		ok   bool
+	}{
+		{"valid", valid, true},
+		{"point not on the curve", offCurve, false},
+		{"wrong curve", wrongCurve, false},
+		{"short Ed25519 key", shortEd25519, false},
+		{"algorithm of another key type", wrongAlg, false},
+		{"not CBOR", []byte{0xff}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := parsePasskeyKey(tt.key); (err == nil) != tt.ok {
+				t.Errorf("err = %v, want ok: %v", err, tt.ok)
+			}
+		})
+	}
+}
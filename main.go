@@ -79,6 +79,13 @@ func main() {
 		exit()
 	}
 
+	if checkLinksFlag {
+		status := checkLinksCommand()
+		process.Shutdown()
+		process.Wait()
+		os.Exit(status)
+	}
+
 	switch {
 	case !cfg.UseAuth:
 		slog.Warn(
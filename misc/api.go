@@ -0,0 +1,98 @@
+package misc
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/bouncepaw/mycorrhiza/internal/search"
+)
+
+// Search pages return JSON instead of HTML if asked with format=json.
+
+type titleSearchJSON struct {
+	Query string `json:"query"`
+	// HyphaName is the name of the hypha the query refers to.
+	HyphaName  string                `json:"hypha_name"`
+	ExactMatch bool                  `json:"exact_match"`
+	Hyphae     []string              `json:"hyphae"`
+	Text       *search.SearchResults `json:"text"`
+	Categories []categoryFacet       `json:"categories"`
+}
+
+type textSearchJSON struct {
+	Query string `json:"query"`
+	*search.SearchResults
+	Categories []categoryFacet `json:"categories"`
+}
+
+func wantsJSON(rq *http.Request) bool {
+	return rq.FormValue("format") == "json"
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("Failed to write JSON", "err", err)
+	}
+}
+
+func writeJSONError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// jsonResults makes sure empty results are encoded as empty lists.
+func jsonResults(res *search.SearchResults) *search.SearchResults {
+	if res == nil {
+		res = search.NewSearchResults()
+	}
+	if res.Hyphae == nil {
+		res.Hyphae = []*search.SearchResult{}
+	}
+	return res
+}
+
+func viewTitleSearchJSON(
+	w http.ResponseWriter,
+	query string,
+	hyphaName string,
+	hasExactMatch bool,
+	results []string,
+	textResults *search.SearchResults,
+	facets []categoryFacet,
+) {
+	if results == nil {
+		results = []string{}
+	}
+	if facets == nil {
+		facets = []categoryFacet{}
+	}
+	if textResults != nil {
+		textResults = jsonResults(textResults)
+	}
+	writeJSON(w, http.StatusOK, titleSearchJSON{
+		Query:      query,
+		HyphaName:  hyphaName,
+		ExactMatch: hasExactMatch,
+		Hyphae:     results,
+		Text:       textResults,
+		Categories: facets,
+	})
+}
+
+func viewTextSearchJSON(
+	w http.ResponseWriter,
+	query string,
+	results *search.SearchResults,
+	facets []categoryFacet,
+) {
+	if facets == nil {
+		facets = []categoryFacet{}
+	}
+	writeJSON(w, http.StatusOK, textSearchJSON{
+		Query:         query,
+		SearchResults: jsonResults(results),
+		Categories:    facets,
+	})
+}
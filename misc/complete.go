@@ -0,0 +1,111 @@
+package misc
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/bouncepaw/mycorrhiza/internal/hyphae"
+	"github.com/bouncepaw/mycorrhiza/internal/search"
+	"github.com/bouncepaw/mycorrhiza/internal/user"
+	"github.com/bouncepaw/mycorrhiza/util"
+)
+
+const (
+	completionLimit    = 10
+	completionMaxLimit = 50
+)
+
+type completion struct {
+	Name      string `json:"name"`
+	Display   string `json:"display"`
+	Backlinks int    `json:"backlinks"`
+
+	prefix int
+	score  float64
+}
+
+// prefixMatch tells if the name starts with the query (2), has a word
+// starting with it (1), or neither (0).
+func prefixMatch(hyphaName string, query string) int {
+	name := search.Transliterate(hyphaName)
+	switch {
+	case strings.HasPrefix(name, query):
+		return 2
+	case strings.Contains(name, "/" + query), strings.Contains(name, "_" + query):
+		return 1
+	default:
+		return 0
+	}
+}
+
+// completeHyphaName suggests hypha names for the query. Names starting with
+// the query come first, then names with a word starting with it, then other
+// fuzzy matches. Within each group, hyphae with more backlinks come first.
+func completeHyphaName(query string, limit int) []completion {
+	canonicalQuery := search.Transliterate(util.CanonicalName(query))
+	res := []completion{}
+	for hyphaName, score := range hyphae.YieldHyphaNamesMatching(query) {
+		res = append(res, completion{Name: hyphaName, score: score})
+	}
+	for i := range res {
+		c := &res[i]
+		c.Display = util.BeautifulName(c.Name)
+		c.Backlinks = hyphae.BacklinksCount(c.Name)
+		c.prefix = prefixMatch(c.Name, canonicalQuery)
+	}
+	slices.SortStableFunc(res, func(a, b completion) int {
+		switch {
+		case a.prefix != b.prefix:
+			return b.prefix - a.prefix
+		case a.Backlinks != b.Backlinks:
+			return b.Backlinks - a.Backlinks
+		case a.score > b.score:
+			return -1
+		case a.score < b.score:
+			return 1
+		default:
+			return 0
+		}
+	})
+	if len(res) > limit {
+		res = res[:limit]
+	}
+	return res
+}
+
+// handlerComplete returns hypha names to complete the query with as JSON.
+// With format=opensearch, the response is in the OpenSearch suggestions
+// format understood by browsers.
+func handlerComplete(w http.ResponseWriter, rq *http.Request) {
+	if !user.FromRequest(rq).CanProceed("title-search") {
+		http.Error(w, "Permission denied", http.StatusForbidden)
+		return
+	}
+	var (
+		query  = strings.TrimSpace(rq.FormValue("q"))
+		limit  = completionLimit
+		result = []completion{}
+	)
+	if n, err := strconv.Atoi(rq.FormValue("limit")); err == nil && n > 0 {
+		limit = min(n, completionMaxLimit)
+	}
+	if query != "" {
+		result = completeHyphaName(query, limit)
+	}
+	if rq.FormValue("format") != "opensearch" {
+		writeJSON(w, http.StatusOK, result)
+		return
+	}
+	names := make([]string, len(result))
+	for i, c := range result {
+		names[i] = c.Display
+	}
+	w.Header().Set("Content-Type", "application/x-suggestions+json")
+	if err := json.NewEncoder(w).Encode([]any{query, names}); err != nil {
+		slog.Error("Failed to write completions", "err", err)
+	}
+}
@@ -0,0 +1,151 @@
+package misc
+
+import (
+	"cmp"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/bouncepaw/mycorrhiza/internal/categories"
+	"github.com/bouncepaw/mycorrhiza/internal/cfg"
+	"github.com/bouncepaw/mycorrhiza/internal/search"
+	"github.com/bouncepaw/mycorrhiza/util"
+)
+
+// facetLimit is the maximum number of category facets shown.
+const facetLimit = 20
+
+// categoryFacet is a category of search results. Selecting it leaves only
+// the results in the category.
+type categoryFacet struct {
+	Name     string `json:"name"`
+	Count    int    `json:"count"`
+	Selected bool   `json:"selected"`
+	// Partial is true if the search did not find all results, so that there
+	// can be more of them in the category than counted.
+	Partial bool `json:"partial"`
+	// Href is the address of the search page with the facet toggled.
+	Href string `json:"-"`
+}
+
+// selectedCategories returns distinct canonical names of categories chosen
+// with the category parameter.
+func selectedCategories(rq *http.Request) []string {
+	var res []string
+	for _, cat := range rq.Form["category"] {
+		cat = util.CanonicalName(strings.TrimSpace(cat))
+		if cat != "" && !slices.Contains(res, cat) {
+			res = append(res, cat)
+		}
+	}
+	return res
+}
+
+// withCategoryFilters narrows the query down to hyphae in all the categories.
+func withCategoryFilters(query *search.Query, cats []string) *search.Query {
+	if len(cats) == 0 {
+		return query
+	}
+	args := []*search.Query{query}
+	for _, cat := range cats {
+		args = append(args, &search.Query{
+			Kind: search.QueryFilter,
+			Key:  search.FilterCategory,
+			Text: cat,
+		})
+	}
+	return &search.Query{Kind: search.QueryAnd, Args: args}
+}
+
+// inCategories tells if the hypha is in all the categories.
+func inCategories(hyphaName string, cats []string) bool {
+	if len(cats) == 0 {
+		return true
+	}
+	hyphaCats := categories.CategoriesWithHypha(hyphaName)
+	for _, cat := range cats {
+		if !slices.Contains(hyphaCats, cat) {
+			return false
+		}
+	}
+	return true
+}
+
+// categoryFacets counts categories of the found hyphae. Selected categories
+// come first, then the most common ones. If the found hyphae are not all
+// results, the counts are marked partial.
+func categoryFacets(
+	rq *http.Request,
+	page string,
+	hyphaNames []string,
+	complete bool,
+	selected []string,
+) []categoryFacet {
+	counts := categories.CategoryCounts(hyphaNames)
+	for _, cat := range selected {
+		if _, ok := counts[cat]; !ok {
+			counts[cat] = 0
+		}
+	}
+	facets := make([]categoryFacet, 0, len(counts))
+	for cat, count := range counts {
+		facets = append(facets, categoryFacet{
+			Name:     cat,
+			Count:    count,
+			Selected: slices.Contains(selected, cat),
+			Partial:  !complete,
+		})
+	}
+	slices.SortFunc(facets, func(a, b categoryFacet) int {
+		switch {
+		case a.Selected && !b.Selected:
+			return -1
+		case !a.Selected && b.Selected:
+			return 1
+		case a.Count != b.Count:
+			return b.Count - a.Count
+		default:
+			return cmp.Compare(a.Name, b.Name)
+		}
+	})
+	if len(facets) > facetLimit {
+		facets = facets[:max(facetLimit, len(selected))]
+	}
+	for i := range facets {
+		facets[i].Href = facetHref(rq, page, selected, facets[i].Name)
+	}
+	return facets
+}
+
+// facetHref returns the address of the search page with the category
+// selected or unselected.
+func facetHref(rq *http.Request, page string, selected []string, cat string) string {
+	values := url.Values{}
+	for key, vals := range rq.Form {
+		if key != "category" && key != "format" {
+			values[key] = vals
+		}
+	}
+	for _, c := range selected {
+		if c != cat {
+			values.Add("category", c)
+		}
+	}
+	if !slices.Contains(selected, cat) {
+		values.Add("category", cat)
+	}
+	return cfg.Root + page + "/?" + values.Encode()
+}
+
+// resultNames returns names of the hyphae found by the full text search.
+func resultNames(res *search.SearchResults) []string {
+	if res == nil {
+		return nil
+	}
+	names := make([]string, len(res.Hyphae))
+	for i, r := range res.Hyphae {
+		names[i] = r.Hypha
+	}
+	return names
+}
@@ -2,11 +2,14 @@
 package misc
 
 import (
+	"errors"
 	"io"
 	"log/slog"
 	"mime"
 	"net/http"
 	"path/filepath"
+	"slices"
+	"strings"
 
 	"github.com/gorilla/mux"
 
@@ -22,6 +25,7 @@ import (
 func InitAssetHandlers(rtr *mux.Router, root *mux.Router) {
 	rtr.HandleFunc("/static/style.css", handlerStyle)
 	rtr.HandleFunc("/robots.txt", handlerRobotsTxt)
+	rtr.HandleFunc("/opensearch.xml", handlerOpenSearch)
 	rtr.PathPrefix("/static/").
 		Handler(http.StripPrefix(cfg.Root + "static/", http.FileServer(http.FS(static.FS))))
 	root.HandleFunc("/favicon.ico", handlerFavicon)
@@ -31,7 +35,9 @@ func InitHandlers(rtr *mux.Router) {
 	rtr.HandleFunc("/list", handlerList)
 	rtr.HandleFunc("/random", handlerRandom)
 	rtr.HandleFunc("/about", handlerAbout)
+	rtr.HandleFunc("/stats", handlerStats).Methods(http.MethodGet)
 	rtr.HandleFunc("/title-search/", handlerTitleSearch)
+	rtr.HandleFunc("/api/complete", handlerComplete).Methods(http.MethodGet)
 	if cfg.FullTextSearchPage {
 		rtr.HandleFunc("/text-search/", handlerTextSearch)
 	}
@@ -120,28 +126,53 @@ func handlerTitleSearch(w http.ResponseWriter, rq *http.Request) {
 	_ = rq.ParseForm()
 	var (
 		meta        = viewutil.MetaFrom(w, rq)
-		query       = normalizeQuery(rq.FormValue("q"))
+		rawQuery    = strings.TrimSpace(rq.FormValue("q"))
+		query       = normalizeQuery(rawQuery)
 		hyphaName   = util.CanonicalName(query)
 		_, nameFree = hyphae.AreFreeNames(hyphaName)
+		cats        = selectedCategories(rq)
 		results     []string
+		scores      = make(map[string]float64)
 		textResults *search.SearchResults = nil
+		facets      []categoryFacet
 	)
 	if query != "" {
-		for hyphaName := range hyphae.YieldHyphaNamesContainingString(query) {
+		for hyphaName, score := range hyphae.YieldHyphaNamesMatching(query) {
+			if !inCategories(hyphaName, cats) {
+				continue
+			}
 			results = append(results, hyphaName)
+			scores[hyphaName] = score
 		}
 		if (cfg.FullTextSearch != cfg.FullTextDisabled &&
 			cfg.FullTextLowerLimit != 0 &&
 			meta.U.CanProceed("text-search")) {
-			textResults, _ = fullTextSearch(query, cfg.FullTextLowerLimit)
+			textResults, _ = fullTextSearch(rawQuery, search.Options{}, cats, cfg.FullTextLowerLimit)
 		}
+		rankTitles(results, scores, textResults)
+		found := slices.Clone(results)
+		for _, name := range resultNames(textResults) {
+			if !slices.Contains(found, name) {
+				found = append(found, name)
+			}
+		}
+		complete := textResults == nil || textResults.Complete
+		facets = categoryFacets(rq, "title-search", found, complete, cats)
+	}
+	if wantsJSON(rq) {
+		viewTitleSearchJSON(w, query, hyphaName, !nameFree, results, textResults, facets)
+		return
 	}
 	w.WriteHeader(http.StatusOK)
-	viewTitleSearch(meta, query, hyphaName, !nameFree, results, textResults)
+	viewTitleSearch(meta, query, hyphaName, !nameFree, results, textResults, facets)
 }
 
 func handlerTextSearch(w http.ResponseWriter, rq *http.Request) {
 	if cfg.FullTextSearch == cfg.FullTextDisabled || cfg.FullTextUpperLimit == 0 {
+		if wantsJSON(rq) {
+			writeJSONError(w, http.StatusNotFound, ErrTextSearchDisabled)
+			return
+		}
 		w.WriteHeader(http.StatusNotFound)
 		_, _ = io.WriteString(w, "404 Not found")
 		return
@@ -149,18 +180,36 @@ func handlerTextSearch(w http.ResponseWriter, rq *http.Request) {
 	_ = rq.ParseForm()
 	var (
 		meta = viewutil.MetaFrom(w, rq)
-		query = normalizeQuery(rq.FormValue("q"))
+		query = strings.TrimSpace(rq.FormValue("q"))
+		opts = searchOptions(rq)
+		cats = selectedCategories(rq)
 		results *search.SearchResults = nil
+		facets []categoryFacet
 		err error = nil
 	)
 	if query != "" {
-		results, err = fullTextSearch(query, cfg.FullTextUpperLimit)
+		results, err = fullTextSearch(query, opts, cats, cfg.FullTextUpperLimit)
 	}
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+	if err == nil && results != nil {
+		facets = categoryFacets(rq, "text-search", resultNames(results), results.Complete, cats)
+	}
+	status := http.StatusOK
+	switch {
+	case errors.Is(err, search.ErrQuerySyntax):
+		status = http.StatusBadRequest
+	case err != nil:
+		status = http.StatusInternalServerError
+	}
+	switch {
+	case err != nil && wantsJSON(rq):
+		writeJSONError(w, status, err)
+	case err != nil:
+		w.WriteHeader(status)
 		_, _ = io.WriteString(w, err.Error())
-		return
+	case wantsJSON(rq):
+		viewTextSearchJSON(w, query, results, facets)
+	default:
+		w.WriteHeader(http.StatusOK)
+		viewTextSearch(meta, query, opts, cats, results, facets)
 	}
-	w.WriteHeader(http.StatusOK)
-	viewTextSearch(meta, query, results)
 }
@@ -0,0 +1,90 @@
+package misc
+
+import (
+	"encoding/xml"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/bouncepaw/mycorrhiza/internal/cfg"
+)
+
+// OpenSearch description documents let browsers add the wiki as a search
+// engine. See https://github.com/dewitt/opensearch.
+
+type openSearchURL struct {
+	Type     string `xml:"type,attr"`
+	Method   string `xml:"method,attr,omitempty"`
+	Rel      string `xml:"rel,attr,omitempty"`
+	Template string `xml:"template,attr"`
+}
+
+type openSearchImage struct {
+	Width  int    `xml:"width,attr"`
+	Height int    `xml:"height,attr"`
+	Type   string `xml:"type,attr"`
+	URL    string `xml:",chardata"`
+}
+
+type openSearchDescription struct {
+	XMLName       xml.Name        `xml:"http://a9.com/-/spec/opensearch/1.1/ OpenSearchDescription"`
+	ShortName     string          `xml:"ShortName"`
+	Description   string          `xml:"Description"`
+	InputEncoding string          `xml:"InputEncoding"`
+	Image         openSearchImage `xml:"Image"`
+	URLs          []openSearchURL `xml:"Url"`
+}
+
+func handlerOpenSearch(w http.ResponseWriter, rq *http.Request) {
+	base := strings.TrimSuffix(cfg.URL, "/") + "/"
+	shortName := []rune(cfg.WikiName)
+	// ShortName must be no longer than 16 characters
+	if len(shortName) > 16 {
+		shortName = shortName[:16]
+	}
+	urls := []openSearchURL{
+		{
+			Type:     "text/html",
+			Method:   "get",
+			Template: base + "title-search/?q={searchTerms}",
+		},
+		{
+			Type:     "application/x-suggestions+json",
+			Method:   "get",
+			Template: base + "api/complete?format=opensearch&q={searchTerms}",
+		},
+		{
+			Type:     "application/opensearchdescription+xml",
+			Rel:      "self",
+			Template: base + "opensearch.xml",
+		},
+	}
+	if cfg.FullTextSearchPage {
+		urls = append(urls, openSearchURL{
+			Type:     "application/json",
+			Method:   "get",
+			Rel:      "results",
+			Template: base + "text-search/?format=json&q={searchTerms}",
+		})
+	}
+	w.Header().Set("Content-Type", "application/opensearchdescription+xml; charset=utf-8")
+	_, _ = io.WriteString(w, xml.Header)
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "\t")
+	err := enc.Encode(openSearchDescription{
+		ShortName:     string(shortName),
+		Description:   "Search " + cfg.WikiName,
+		InputEncoding: "UTF-8",
+		Image: openSearchImage{
+			Width:  32,
+			Height: 32,
+			Type:   "image/x-icon",
+			URL:    base + "static/icon/favicon.ico",
+		},
+		URLs: urls,
+	})
+	if err != nil {
+		slog.Error("Failed to write OpenSearch description", "err", err)
+	}
+}
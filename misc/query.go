@@ -0,0 +1,182 @@
+package misc
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/bouncepaw/mycorrhiza/history"
+	"github.com/bouncepaw/mycorrhiza/internal/categories"
+	"github.com/bouncepaw/mycorrhiza/internal/cfg"
+	"github.com/bouncepaw/mycorrhiza/internal/hyphae"
+	"github.com/bouncepaw/mycorrhiza/internal/mimetype"
+	"github.com/bouncepaw/mycorrhiza/internal/search"
+	"github.com/bouncepaw/mycorrhiza/util"
+)
+
+// termSearch looks up a single term in hypha texts. It reads at most
+// matchLimit matched lines per hypha, all of them if it is negative, and
+// only finds hypha names if it is zero.
+type termSearch func(
+	term string,
+	opts search.Options,
+	limit int,
+	matchLimit int,
+) (*search.SearchResults, error)
+
+// matchLimit is the configured number of matched lines per hypha.
+func matchLimit() int {
+	if cfg.GrepMatchLimitPerHypha == 0 {
+		return -1
+	}
+	return int(cfg.GrepMatchLimitPerHypha)
+}
+
+func nameSet(names []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		set[name] = struct{}{}
+	}
+	return set
+}
+
+// filterPredicate returns a function checking if a hypha passes the filter.
+func filterPredicate(filter *search.Query) (func(hyphae.ExistingHypha) bool, error) {
+	value := filter.Text
+	switch filter.Key {
+	case search.FilterCategory:
+		set := nameSet(categories.HyphaeInCategory(util.CanonicalName(value)))
+		return func(h hyphae.ExistingHypha) bool {
+			_, ok := set[h.CanonicalName()]
+			return ok
+		}, nil
+	case search.FilterPrefix:
+		prefix := util.CanonicalName(strings.Trim(value, "/"))
+		return func(h hyphae.ExistingHypha) bool {
+			name := h.CanonicalName()
+			return name == prefix || strings.HasPrefix(name, prefix + "/")
+		}, nil
+	case search.FilterMedia:
+		return mediaPredicate(strings.ToLower(value)), nil
+	case search.FilterAuthor:
+		names, err := history.HyphaeEditedBy(util.CanonicalName(value))
+		if err != nil {
+			return nil, err
+		}
+		set := nameSet(names)
+		return func(h hyphae.ExistingHypha) bool {
+			_, ok := set[h.CanonicalName()]
+			return ok
+		}, nil
+	default:
+		return func(hyphae.ExistingHypha) bool { return false }, nil
+	}
+}
+
+// mediaPredicate matches media hyphae by kind. The value is either yes or no,
+// a mime type or its first part, like image, or a file extension.
+func mediaPredicate(value string) func(hyphae.ExistingHypha) bool {
+	return func(h hyphae.ExistingHypha) bool {
+		m, isMedia := h.(*hyphae.MediaHypha)
+		switch value {
+		case "yes", "true", "any":
+			return isMedia
+		case "no", "false", "none":
+			return !isMedia
+		}
+		if !isMedia {
+			return false
+		}
+		ext := strings.ToLower(filepath.Ext(m.MediaFilePath()))
+		mime := mimetype.FromExtension(ext)
+		return (value == strings.TrimPrefix(ext, ".") ||
+			value == mime ||
+			strings.HasPrefix(mime, value + "/"))
+	}
+}
+
+// mergeResults combines lines and hits of the terms found in the hypha.
+func mergeResults(
+	hyphaName string,
+	found map[string]map[string]*search.SearchResult,
+	terms []string,
+) *search.SearchResult {
+	merged := search.NewSearchResult(hyphaName)
+	for _, term := range terms {
+		r, ok := found[term][hyphaName]
+		if !ok {
+			continue
+		}
+		merged.Hits += r.Hits
+		merged.HeadingHits += r.HeadingHits
+		for _, snippet := range r.Lines {
+			if limit := matchLimit(); limit < 0 || len(merged.Lines) < limit {
+				merged.Append(snippet)
+			}
+		}
+	}
+	return merged
+}
+
+// searchQuery evaluates a parsed query. Every distinct term is looked up
+// with the given backend, filters are checked against the hypha index,
+// categories and history. Lines of matched positive terms are shown, only
+// hypha names are looked up for negated ones.
+func searchQuery(
+	query *search.Query,
+	opts search.Options,
+	limit int,
+	lookup termSearch,
+) (*search.SearchResults, error) {
+	if query.IsTerm() {
+		return lookup(query.Text, opts, limit, matchLimit())
+	}
+	res := search.NewSearchResults()
+	found := make(map[string]map[string]*search.SearchResult)
+	positive := query.Terms(true)
+	for _, term := range query.Terms(false) {
+		termLimit := 0
+		if slices.Contains(positive, term) {
+			termLimit = matchLimit()
+		}
+		termResults, err := lookup(term, opts, -1, termLimit)
+		if err != nil {
+			return nil, err
+		}
+		if !termResults.Complete {
+			res.Complete = false
+		}
+		byHypha := make(map[string]*search.SearchResult, len(termResults.Hyphae))
+		for _, r := range termResults.Hyphae {
+			byHypha[r.Hypha] = r
+		}
+		found[term] = byHypha
+	}
+	predicates := make(map[*search.Query]func(hyphae.ExistingHypha) bool)
+	for _, filter := range query.Filters() {
+		pred, err := filterPredicate(filter)
+		if err != nil {
+			return nil, err
+		}
+		predicates[filter] = pred
+	}
+
+	for h := range hyphae.YieldExistingHyphae() {
+		name := h.CanonicalName()
+		matches := query.Eval(func(q *search.Query) bool {
+			if q.Kind == search.QueryFilter {
+				return predicates[q](h)
+			}
+			_, ok := found[q.Text][name]
+			return ok
+		})
+		if !matches {
+			continue
+		}
+		res.Hyphae = append(res.Hyphae, mergeResults(name, found, positive))
+		if !res.Limit(limit) {
+			break
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,113 @@
+package misc
+
+import (
+	"errors"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/bouncepaw/mycorrhiza/history"
+	"github.com/bouncepaw/mycorrhiza/internal/cfg"
+	"github.com/bouncepaw/mycorrhiza/internal/hyphae"
+	"github.com/bouncepaw/mycorrhiza/internal/search"
+)
+
+// rankPoolSize returns how many full text search results to find so that the
+// best limit of them can be shown.
+func rankPoolSize(limit int) int {
+	switch {
+	case cfg.FullTextRankLimit == 0:
+		return limit
+	case limit < 0 || cfg.FullTextRankLimit < 0:
+		return -1
+	default:
+		return max(limit, cfg.FullTextRankLimit)
+	}
+}
+
+// lastEdited returns recent edit times of the hyphae for ranking. Failures
+// are logged and result in no recency data.
+func lastEdited(hyphaNames []string, now time.Time) map[string]time.Time {
+	edits, err := history.LastEdited(hyphaNames, now.Add(-search.RecencyWindow))
+	switch {
+	case errors.Is(err, history.ErrGrepLimit):
+		slog.Info("Ranking without last edits", "err", err)
+	case err != nil:
+		slog.Error("Failed to find last edits for ranking", "err", err)
+	}
+	return edits
+}
+
+func bestTitleMatch(hyphaName string, terms []string) float64 {
+	best := 0.0
+	for _, term := range terms {
+		best = max(best, search.TitleMatch(hyphaName, term))
+	}
+	return best
+}
+
+// rankResults sorts full text search results by relevance to the terms.
+func rankResults(res *search.SearchResults, terms []string) {
+	if res == nil || len(res.Hyphae) < 2 {
+		return
+	}
+	now := time.Now()
+	names := make([]string, len(res.Hyphae))
+	for i, r := range res.Hyphae {
+		names[i] = r.Hypha
+	}
+	edits := lastEdited(names, now)
+	for _, r := range res.Hyphae {
+		r.Score = search.RankSignals{
+			TitleMatch:  bestTitleMatch(r.Hypha, terms),
+			Hits:        r.Hits,
+			HeadingHits: r.HeadingHits,
+			Backlinks:   hyphae.BacklinksCount(r.Hypha),
+			LastEdited:  edits[r.Hypha],
+		}.Score(now)
+	}
+	res.Sort()
+}
+
+// rankTitles sorts title search results by relevance, given how well their
+// names match the query. Text search results, if any, contribute their hits.
+func rankTitles(
+	hyphaNames []string,
+	titleScores map[string]float64,
+	text *search.SearchResults,
+) {
+	if len(hyphaNames) < 2 {
+		return
+	}
+	now := time.Now()
+	edits := lastEdited(hyphaNames, now)
+	textHits := make(map[string]*search.SearchResult)
+	if text != nil {
+		for _, r := range text.Hyphae {
+			textHits[r.Hypha] = r
+		}
+	}
+	scores := make(map[string]float64, len(hyphaNames))
+	for _, name := range hyphaNames {
+		signals := search.RankSignals{
+			TitleMatch: titleScores[name],
+			Backlinks:  hyphae.BacklinksCount(name),
+			LastEdited: edits[name],
+		}
+		if r, ok := textHits[name]; ok {
+			signals.Hits = r.Hits
+			signals.HeadingHits = r.HeadingHits
+		}
+		scores[name] = signals.Score(now)
+	}
+	slices.SortStableFunc(hyphaNames, func(a, b string) int {
+		switch {
+		case scores[a] > scores[b]:
+			return -1
+		case scores[a] < scores[b]:
+			return 1
+		default:
+			return 0
+		}
+	})
+}
@@ -2,27 +2,116 @@ package misc
 
 import (
 	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
 	"strings"
 
 	"github.com/bouncepaw/mycorrhiza/history"
 	"github.com/bouncepaw/mycorrhiza/internal/cfg"
+	"github.com/bouncepaw/mycorrhiza/internal/hyphae"
 	"github.com/bouncepaw/mycorrhiza/internal/search"
 )
 
-var ErrTextSearchDisabled = errors.New("full text search is disabled")
+var (
+	ErrTextSearchDisabled = errors.New("full text search is disabled")
+	ErrRegexDisabled      = fmt.Errorf("%w: regular expressions are disabled", search.ErrQuerySyntax)
+)
 
 func normalizeQuery(query string) string {
 	return strings.ToLower(strings.TrimSpace(query))
 }
 
-func fullTextSearch(query string, limit int) (*search.SearchResults, error) {
+// searchOptions reads full text search modes from the request form.
+func searchOptions(rq *http.Request) search.Options {
+	return search.Options{
+		Regex:         rq.FormValue("regex") != "",
+		Perl:          cfg.GrepRegex == cfg.RegexPerl,
+		CaseSensitive: rq.FormValue("case") != "",
+	}
+}
+
+// parseSearchQuery parses the query language. A regular expression is a
+// single term, it is validated instead.
+func parseSearchQuery(query string, opts search.Options) (*search.Query, error) {
+	if !opts.Regex {
+		return search.ParseQuery(query)
+	}
+	if cfg.GrepRegex == cfg.RegexDisabled {
+		return nil, ErrRegexDisabled
+	}
+	err := search.ValidateRegex(query, opts.Perl, cfg.GrepRegexComplexity)
+	if err != nil {
+		return nil, err
+	}
+	return &search.Query{Kind: search.QueryTerm, Text: query}, nil
+}
+
+// fullTextSearch parses the query, runs it with the configured backend and
+// ranks the results. Only hyphae in all the given categories are found.
+func fullTextSearch(
+	query string,
+	opts search.Options,
+	cats []string,
+	limit int,
+) (*search.SearchResults, error) {
 	if limit == 0 {
 		return nil, ErrTextSearchDisabled
 	}
+	var lookup termSearch
 	switch cfg.FullTextSearch {
 	case cfg.FullTextGrep:
-		return history.Grep(query, limit)
+		lookup = history.Grep
+	case cfg.FullTextIndex:
+		lookup = hyphae.SearchText
 	default:
 		return nil, ErrTextSearchDisabled
 	}
+	parsed, err := parseSearchQuery(query, opts)
+	if err != nil {
+		return nil, err
+	}
+	parsed = withCategoryFilters(parsed, cats)
+	if cfg.FullTextRankLimit == 0 {
+		res, err := searchQuery(parsed, opts, limit, lookup)
+		if err != nil {
+			return nil, err
+		}
+		addAnchors(res)
+		return res, nil
+	}
+	res, err := searchQuery(parsed, opts, rankPoolSize(limit), lookup)
+	if err != nil {
+		return nil, err
+	}
+	rankResults(res, parsed.Terms(true))
+	res.Limit(limit)
+	addAnchors(res)
+	return res, nil
+}
+
+// addAnchors finds the headings matched lines are under, so that results
+// can link to them.
+func addAnchors(res *search.SearchResults) {
+	hop := history.ReadOperation()
+	defer hop.Close()
+	for _, r := range res.Hyphae {
+		if len(r.Lines) == 0 {
+			continue
+		}
+		text, err := hyphae.ByName(r.Hypha).Text(hop)
+		if err != nil {
+			slog.Error("Failed to read hypha text", "hypha", r.Hypha, "err", err)
+			continue
+		}
+		headings := hyphae.ExtractHeadingsFromString(r.Hypha, text)
+		for _, snippet := range r.Lines {
+			for _, heading := range headings {
+				if snippet.Number == 0 || heading.Line > snippet.Number {
+					break
+				}
+				snippet.Anchor, snippet.Heading = heading.ID, heading.Title
+			}
+		}
+	}
 }
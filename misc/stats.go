@@ -0,0 +1,173 @@
+package misc
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bouncepaw/mycorrhiza/history"
+	"github.com/bouncepaw/mycorrhiza/internal/cfg"
+	"github.com/bouncepaw/mycorrhiza/internal/hyphae"
+	"github.com/bouncepaw/mycorrhiza/web/viewutil"
+)
+
+const (
+	// statsTopSize is the length of the lists of the most linked hyphae,
+	// the most edited hyphae and the top contributors.
+	statsTopSize = 10
+	// statsDays and statsWeeks are the numbers of the last days and weeks
+	// edits are counted for.
+	statsDays  = 30
+	statsWeeks = 12
+)
+
+// statsCount is a number of something about a hypha or a user.
+type statsCount struct {
+	Name  string
+	Count int
+}
+
+// statsPeriod is the number of edits made in a day or a week.
+type statsPeriod struct {
+	Start time.Time
+	Count int
+	// Percent is the count relative to the largest one among the periods.
+	Percent int
+}
+
+type statsData struct {
+	*viewutil.BaseData
+	HyphaCount      int
+	TextualCount    int
+	MediaCount      int
+	MediaSize       string
+	OrphanCount     int
+	RedLinkCount    int
+	MostLinked      []statsCount
+	EditCount       int
+	MostEdited      []statsCount
+	TopContributors []statsCount
+	Days            []statsPeriod
+	Weeks           []statsPeriod
+	UserHypha       string
+}
+
+// handlerStats shows the statistics of the wiki.
+func handlerStats(w http.ResponseWriter, rq *http.Request) {
+	edits, err := history.Stats()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data := statsData{
+		BaseData:        &viewutil.BaseData{},
+		OrphanCount:     len(hyphae.Orphans()),
+		EditCount:       edits.Total,
+		MostEdited:      topCounts(edits.ByHypha),
+		TopContributors: topCounts(edits.ByUser),
+		UserHypha:       cfg.UserHypha,
+	}
+
+	var mediaPaths []string
+	for h := range hyphae.YieldExistingHyphae() {
+		data.HyphaCount++
+		switch h := h.(type) {
+		case *hyphae.TextualHypha:
+			data.TextualCount++
+		case *hyphae.MediaHypha:
+			data.MediaCount++
+			mediaPaths = append(mediaPaths, h.MediaFilePath())
+		}
+	}
+	var mediaSize int64
+	for _, path := range mediaPaths {
+		info, err := os.Stat(path)
+		if err != nil {
+			slog.Warn("Failed to stat media file", "path", path, "err", err)
+			continue
+		}
+		mediaSize += info.Size()
+	}
+	data.MediaSize = byteSize(mediaSize)
+
+	linked := make(map[string]int)
+	for hyphaName, count := range hyphae.BacklinkCounts() {
+		if _, empty := hyphae.ByName(hyphaName).(*hyphae.EmptyHypha); empty {
+			data.RedLinkCount++
+		} else {
+			linked[hyphaName] = count
+		}
+	}
+	data.MostLinked = topCounts(linked)
+
+	data.Days, data.Weeks = editPeriods(edits.ByDay, time.Now().UTC())
+	viewutil.ExecutePage(viewutil.MetaFrom(w, rq), chainStats, data)
+}
+
+// topCounts returns the statsTopSize largest counts, largest first.
+func topCounts(counts map[string]int) []statsCount {
+	res := make([]statsCount, 0, len(counts))
+	for name, count := range counts {
+		res = append(res, statsCount{name, count})
+	}
+	slices.SortFunc(res, func(a, b statsCount) int {
+		if a.Count != b.Count {
+			return b.Count - a.Count
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+	return res[:min(len(res), statsTopSize)]
+}
+
+// editPeriods counts edits in the last statsDays days and the last statsWeeks
+// weeks, most recent first. Weeks start on Monday.
+func editPeriods(byDay map[time.Time]int, now time.Time) (days, weeks []statsPeriod) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	for i := range statsDays {
+		day := today.AddDate(0, 0, -i)
+		days = append(days, statsPeriod{Start: day, Count: byDay[day]})
+	}
+	sinceMonday := (int(today.Weekday()) + 6) % 7
+	monday := today.AddDate(0, 0, -sinceMonday)
+	for i := range statsWeeks {
+		week := statsPeriod{Start: monday.AddDate(0, 0, -7 * i)}
+		for j := range 7 {
+			week.Count += byDay[week.Start.AddDate(0, 0, j)]
+		}
+		weeks = append(weeks, week)
+	}
+	setPercents(days)
+	setPercents(weeks)
+	return days, weeks
+}
+
+func setPercents(periods []statsPeriod) {
+	largest := 0
+	for _, period := range periods {
+		largest = max(largest, period.Count)
+	}
+	if largest == 0 {
+		return
+	}
+	for i := range periods {
+		periods[i].Percent = periods[i].Count * 100 / largest
+	}
+}
+
+// byteSize formats the size in bytes for people.
+func byteSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	value, exp := float64(size) / unit, 0
+	for value >= unit && exp < 3 {
+		value /= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", value, "KMGT"[exp])
+}
@@ -13,7 +13,7 @@ var (
 	//go:embed *html
 	fs                          embed.FS
 	chainList, chainTitleSearch viewutil.Chain
-	chainTextSearch             viewutil.Chain
+	chainTextSearch, chainStats viewutil.Chain
 	ruTranslation               = `
 {{define "list of hyphae"}}Список гиф{{end}}
 {{define "search:"}}Поиск: {{.}}{{end}}
@@ -26,6 +26,25 @@ var (
 {{define "search more"}}Больше результатов поиска{{end}}
 {{define "search in text"}}Поиск в тексте{{end}}
 {{define "search not complete"}}{{end}}
+{{define "search query"}}Запрос{{end}}
+{{define "search regex"}}Регулярное выражение{{end}}
+{{define "search case sensitive"}}С учётом регистра{{end}}
+{{define "search submit"}}Найти{{end}}
+{{define "search categories"}}Категории{{end}}
+{{define "wiki statistics"}}Статистика вики{{end}}
+{{define "stats hyphae"}}Гифы{{end}}
+{{define "stats hypha count"}}Гиф: <a class="wikilink" href="{{.Meta.Root}}list">{{.HyphaCount}}</a>{{end}}
+{{define "stats textual count"}}Текстовых гиф: {{.TextualCount}}{{end}}
+{{define "stats media count"}}Медиа-гиф: {{.MediaCount}}, всего {{.MediaSize}}{{end}}
+{{define "stats orphan count"}}Сирот: <a class="wikilink" href="{{.Meta.Root}}orphans">{{.OrphanCount}}</a>{{end}}
+{{define "stats red link count"}}Несозданных гиф, на которые есть ссылки: <a class="wikilink" href="{{.Meta.Root}}wanted">{{.RedLinkCount}}</a>{{end}}
+{{define "stats most linked"}}Гифы с наибольшим числом обратных ссылок{{end}}
+{{define "stats edits"}}Правки{{end}}
+{{define "stats edit count"}}Всего правок: {{.EditCount}}{{end}}
+{{define "stats most edited"}}Самые редактируемые гифы{{end}}
+{{define "stats top contributors"}}Самые активные участники{{end}}
+{{define "stats edits per day"}}Правки по дням{{end}}
+{{define "stats edits per week"}}Правки по неделям{{end}}
 `
 )
 
@@ -33,6 +52,7 @@ func initViews() {
 	chainList = viewutil.CopyEnRuWith(fs, "view_list.html", ruTranslation)
 	chainTitleSearch = viewutil.CopyEnRuWith(fs, "view_title_search.html", ruTranslation)
 	chainTextSearch = viewutil.CopyEnRuWith(fs, "view_text_search.html", ruTranslation)
+	chainStats = viewutil.CopyEnRuWith(fs, "view_stats.html", ruTranslation)
 }
 
 type listDatum struct {
@@ -64,9 +84,10 @@ type titleSearchData struct {
 	HasTextResults    bool
 	HasAnyResults     bool
 	HasTextSearchLink bool
+	Facets            []categoryFacet
 }
 
-func viewTitleSearch(meta viewutil.Meta, query string, hyphaName string, hasExactMatch bool, results []string, textResults *search.SearchResults) {
+func viewTitleSearch(meta viewutil.Meta, query string, hyphaName string, hasExactMatch bool, results []string, textResults *search.SearchResults, facets []categoryFacet) {
 	hasTextResults := textResults != nil && len(textResults.Hyphae) > 0
 	hasTextSearchLink := cfg.FullTextSearchPage &&
 		(cfg.FullTextLowerLimit == 0 ||
@@ -83,6 +104,7 @@ func viewTitleSearch(meta viewutil.Meta, query string, hyphaName string, hasExac
 		HasTextResults:    hasTextResults,
 		HasAnyResults:     hasTextResults || len(results) > 0,
 		HasTextSearchLink: hasTextSearchLink,
+		Facets:            facets,
 	})
 }
 
@@ -90,15 +112,23 @@ func viewTitleSearch(meta viewutil.Meta, query string, hyphaName string, hasExac
 type textSearchData struct {
 	*viewutil.BaseData
 	Query            string
+	Options          search.Options
+	Categories       []string
 	Results          *search.SearchResults
 	HasResults       bool
+	RegexAllowed     bool
+	Facets           []categoryFacet
 }
 
-func viewTextSearch(meta viewutil.Meta, query string, results *search.SearchResults) {
+func viewTextSearch(meta viewutil.Meta, query string, opts search.Options, cats []string, results *search.SearchResults, facets []categoryFacet) {
 	viewutil.ExecutePage(meta, chainTextSearch, textSearchData{
 		BaseData:         &viewutil.BaseData{},
 		Query:            query,
+		Options:          opts,
+		Categories:       cats,
 		Results:          results,
 		HasResults:       results != nil,
+		RegexAllowed:     cfg.GrepRegex != cfg.RegexDisabled,
+		Facets:           facets,
 	})
 }
@@ -6,7 +6,9 @@ import (
 	"mime"
 	"net/http"
 
+	"github.com/bouncepaw/mycorrhiza/history"
 	"github.com/bouncepaw/mycorrhiza/internal/cfg"
+	"github.com/bouncepaw/mycorrhiza/internal/hyphae"
 	"github.com/bouncepaw/mycorrhiza/internal/process"
 	"github.com/bouncepaw/mycorrhiza/internal/shroom"
 	"github.com/bouncepaw/mycorrhiza/internal/user"
@@ -26,6 +28,8 @@ const adminTranslationRu = `
 {{define "panel shutdown"}}Выключить вики{{end}}
 {{define "panel reindex hyphae"}}Переиндексировать гифы{{end}}
 {{define "panel interwiki"}}Интервики{{end}}
+{{define "panel links"}}Битые ссылки{{end}}
+{{define "panel deleted"}}Удалённые гифы{{end}}
 
 {{define "manage users"}}Управление пользователями{{end}}
 {{define "create user"}}Создать пользователя{{end}}
@@ -49,6 +53,10 @@ const adminTranslationRu = `
 {{define "delete user"}}Удалить пользователя{{end}}
 {{define "delete user tip"}}Удаляет пользователя из базы данных. Правки пользователя будут сохранены. Имя пользователя освободится для повторной регистрации.{{end}}
 
+{{define "two-factor authentication"}}Двухфакторная аутентификация{{end}}
+{{define "reset totp tip"}}Пользователь включил двухфакторную аутентификацию. Выключите её, если он потерял доступ к приложению-аутентификатору и кодам восстановления.{{end}}
+{{define "reset totp"}}Выключить{{end}}
+
 {{define "delete user?"}}Удалить пользователя {{.}}?{{end}}
 {{define "delete user warning"}}Вы уверены, что хотите удалить этого пользователя из базы данных? Это действие нельзя отменить.{{end}}
 `
@@ -150,6 +158,13 @@ func handlerAdminUpdateHeaderLinks(w http.ResponseWriter, rq *http.Request) {
 	http.Redirect(w, rq, redirectTo, http.StatusSeeOther)
 }
 
+// handlerAdminLinks lists broken links in all hyphae.
+func handlerAdminLinks(w http.ResponseWriter, rq *http.Request) {
+	_ = pageAdminLinks.RenderTo(viewutil.MetaFrom(w, rq), map[string]any{
+		"Problems": hyphae.LintLinks(history.FileReader()),
+	})
+}
+
 func handlerAdminUserEdit(w http.ResponseWriter, rq *http.Request) {
 	vars := mux.Vars(rq)
 	u := user.ByName(vars["username"])
@@ -214,6 +229,24 @@ func handlerAdminUserChangePassword(w http.ResponseWriter, rq *http.Request) {
 	viewEditUser(viewutil.MetaFrom(w, rq), f, u)
 }
 
+func handlerAdminUserResetTOTP(w http.ResponseWriter, rq *http.Request) {
+	vars := mux.Vars(rq)
+	u := user.ByName(vars["username"])
+	if u.IsEmpty() {
+		util.HTTP404Page(w, "404 not found")
+		return
+	}
+
+	if err := user.ReplaceUser(u, u.WithoutTOTP()); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Header().Set("Content-Type", mime.TypeByExtension(".html"))
+		viewEditUser(viewutil.MetaFrom(w, rq), util.NewFormData().WithError(err), u)
+		return
+	}
+	slog.Info("Reset two-factor authentication", "username", u.Name())
+	http.Redirect(w, rq, cfg.Root + "admin/users/" + u.Name() + "/edit", http.StatusSeeOther)
+}
+
 func handlerAdminUserDelete(w http.ResponseWriter, rq *http.Request) {
 	vars := mux.Vars(rq)
 	u := user.ByName(vars["username"])
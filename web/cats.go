@@ -6,6 +6,7 @@ import (
 	"sort"
 	"strings"
 
+	"github.com/bouncepaw/mycorrhiza/history/histweb"
 	"github.com/bouncepaw/mycorrhiza/internal/cfg"
 	"github.com/bouncepaw/mycorrhiza/internal/categories"
 	"github.com/bouncepaw/mycorrhiza/internal/user"
@@ -50,6 +51,7 @@ func handlerCategory(w http.ResponseWriter, rq *http.Request) {
 
 	meta := viewutil.MetaFrom(w, rq)
 	slog.Info("Viewing category", "name", catName)
+	meta.HeadElements = histweb.FeedLinks("category", catName, "Category " + util.BeautifulName(catName), nil)
 	_ = pageCatPage.RenderTo(meta, map[string]any{
 		"Addr":                    cfg.Root + "category/" + catName,
 		"CatName":                 catName,
@@ -67,11 +67,21 @@ func authMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// redirectToLogin sends the user to the login page. There is no such page if
+// users are logged in by a proxy, so an error is shown instead.
+func redirectToLogin(w http.ResponseWriter, rq *http.Request) {
+	if cfg.ProxyAuthEnabled {
+		http.Error(w, "401 Unauthorized: the proxy did not log you in", http.StatusUnauthorized)
+		return
+	}
+	http.Redirect(w, rq, cfg.Root + "login", http.StatusSeeOther)
+}
+
 func requireLoginMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, rq *http.Request) {
 		user := user.FromRequest(rq)
 		if user.IsEmpty() {
-			http.Redirect(w, rq, cfg.Root + "login", http.StatusSeeOther)
+			redirectToLogin(w, rq)
 			return
 		}
 		next.ServeHTTP(w, rq)
@@ -83,7 +93,7 @@ func wikiMiddleware(next http.Handler) http.Handler {
 		user := user.FromRequest(rq)
 		// slog.Info("wikiMiddleware", "path", rq.URL.Path, "method", rq.Method, "user", user)
 		if user.ShowLock() {
-			http.Redirect(w, rq, cfg.Root + "login", http.StatusSeeOther)
+			redirectToLogin(w, rq)
 			return
 		}
 		route := rq.URL.Path
@@ -102,6 +112,10 @@ func wikiMiddleware(next http.Handler) http.Handler {
 			http.Error(w, "Permission denied", http.StatusForbidden)
 			return
 		}
+		if user.NeedsTOTPSetup() && !strings.HasPrefix(route, "settings") {
+			http.Redirect(w, rq, cfg.Root + "settings/totp", http.StatusSeeOther)
+			return
+		}
 		maxSize := maxBodySize(rq)
 		if maxSize > 0 {
 			rq.Body = http.MaxBytesReader(w, rq.Body, maxSize)
@@ -1,6 +1,7 @@
 package web
 
 import (
+	"errors"
 	"html/template"
 	"log/slog"
 	"net/http"
@@ -26,6 +27,7 @@ func initMutators(r *mux.Router) {
 	r.PathPrefix("/rename/").HandlerFunc(handlerRename).Methods("GET", "POST")
 	r.PathPrefix("/delete/").HandlerFunc(handlerDelete).Methods("GET", "POST")
 	r.PathPrefix("/revert/").HandlerFunc(handlerRevert).Methods("GET", "POST")
+	r.PathPrefix("/undelete/").HandlerFunc(handlerUndelete).Methods("POST")
 	r.PathPrefix("/remove-media/").HandlerFunc(handlerRemoveMedia).Methods("POST")
 	r.PathPrefix("/upload-binary/").HandlerFunc(handlerUploadBinary).Methods("POST")
 }
@@ -120,6 +122,31 @@ func handlerRevert(w http.ResponseWriter, rq *http.Request) {
 	http.Redirect(w, rq, cfg.Root+"hypha/"+h.CanonicalName(), http.StatusSeeOther)
 }
 
+func handlerUndelete(w http.ResponseWriter, rq *http.Request) {
+	shorterURL := strings.TrimPrefix(rq.URL.Path, cfg.Root+"undelete/")
+	revHash, slug, found := strings.Cut(shorterURL, "/")
+	if !found || !util.IsRevHash(revHash) || len(slug) < 1 {
+		http.Error(w, "400 bad request", http.StatusBadRequest)
+		return
+	}
+
+	var (
+		hyphaName = util.CanonicalName(slug)
+		meta      = viewutil.MetaFrom(w, rq)
+	)
+	h, err := shroom.Undelete(meta.U, hyphaName, revHash)
+	switch {
+	case errors.Is(err, shroom.ErrUndeleteExists), errors.Is(err, shroom.ErrUndeleteNothing):
+		viewutil.HttpErr(meta, http.StatusBadRequest, hyphaName, err.Error())
+		return
+	case err != nil:
+		slog.Error("Failed to undelete hypha", "hypha", hyphaName, "err", err)
+		viewutil.HttpErr(meta, http.StatusInternalServerError, hyphaName, err.Error())
+		return
+	}
+	http.Redirect(w, rq, cfg.Root+"hypha/"+h.CanonicalName(), http.StatusSeeOther)
+}
+
 func handlerRename(w http.ResponseWriter, rq *http.Request) {
 	var (
 		lc   = l18n.FromRequest(rq)
@@ -55,9 +55,11 @@ func NewPage(fs embed.FS, russianTranslation map[string]string, tmpls ...string)
 <ul class="top-bar__auth auth-links">
 	<li class="auth-links__box auth-links__user-box">
 		{{if .Meta.U.IsEmpty }}
+			{{block "login link" .}}
 			<a href="{{ .Meta.Root }}login" class="auth-links__link auth-links__login-link">
 				{{block "login" .}}Login{{end}}
 			</a>
+			{{end}}
 		{{else}}
 			<a href="{{ .Meta.Root }}hypha/{{block "user hypha" .}}{{end}}/{{.Meta.U.Name}}" class="auth-links__link auth-links__user-link">
 				{{beautifulName .Meta.U.Name}}
@@ -69,7 +71,11 @@ func NewPage(fs embed.FS, russianTranslation map[string]string, tmpls ...string)
 {{end}}
 `))
 	}
-	if cfg.AllowRegistration {
+	if cfg.ProxyAuthEnabled {
+		// The proxy logs users in, there is no login page
+		must(en.Parse(`{{define "login link"}}{{end}}`))
+	}
+	if cfg.AllowRegistration && !cfg.ProxyAuthEnabled {
 		must(en.Parse(`{{define "registration"}}
 {{if .Meta.U.IsEmpty}}
 	 <li class="auth-links__box auth-links__register-box">
@@ -114,6 +120,8 @@ func (p *Page) RenderTo(meta viewutil.Meta, data map[string]any) error {
 	data["EditScripts"] = cfg.EditScripts
 	data["HeaderLinks"] = viewutil.HeaderLinks()
 	data["UseAuth"] = cfg.UseAuth
+	data["ProxyAuth"] = cfg.ProxyAuthEnabled
+	data["Passkeys"] = cfg.PasskeysEnabled
 
 	tmpl := p.TemplateEnglish
 	if meta.LocaleIsRussian() {
@@ -0,0 +1,127 @@
+package web
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/bouncepaw/mycorrhiza/internal/cfg"
+	"github.com/bouncepaw/mycorrhiza/internal/oidc"
+	"github.com/bouncepaw/mycorrhiza/internal/user"
+	"github.com/bouncepaw/mycorrhiza/web/viewutil"
+)
+
+// oidcStateCookie binds the login attempt to the browser that started it.
+const oidcStateCookie = "mycorrhiza_oidc_state"
+
+// handlerOIDCLogin sends the user to the OpenID Connect provider.
+func handlerOIDCLogin(w http.ResponseWriter, rq *http.Request) {
+	addr, state, err := oidc.Start(rq.Context())
+	if err != nil {
+		slog.Error("Failed to start OIDC login", "err", err)
+		renderOIDCError(w, rq, http.StatusBadGateway, err)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     cfg.Root,
+		MaxAge:   600,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, rq, addr, http.StatusSeeOther)
+}
+
+// handlerOIDCCallback logs the user the provider sent back in, registering
+// them first if needed.
+func handlerOIDCCallback(w http.ResponseWriter, rq *http.Request) {
+	var (
+		query = rq.URL.Query()
+		state = query.Get("state")
+	)
+	http.SetCookie(w, &http.Cookie{
+		Name:   oidcStateCookie,
+		Path:   cfg.Root,
+		MaxAge: -1,
+	})
+	if e := query.Get("error"); e != "" {
+		err := fmt.Errorf("the provider refused: %s %s", e, query.Get("error_description"))
+		slog.Info("Failed to log in", "err", err, "method", "oidc")
+		renderOIDCError(w, rq, http.StatusBadRequest, err)
+		return
+	}
+	if c, err := rq.Cookie(oidcStateCookie); err != nil || c.Value != state {
+		slog.Info("Failed to log in", "err", oidc.ErrState, "method", "oidc")
+		renderOIDCError(w, rq, http.StatusBadRequest, oidc.ErrState)
+		return
+	}
+
+	id, err := oidc.Finish(rq.Context(), state, query.Get("code"))
+	if err != nil {
+		slog.Info("Failed to log in", "err", err, "method", "oidc")
+		renderOIDCError(w, rq, http.StatusBadRequest, err)
+		return
+	}
+	username, err := syncOIDCUser(id)
+	if err != nil {
+		slog.Info("Failed to log in", "username", username, "subject", id.Subject, "err", err, "method", "oidc")
+		renderOIDCError(w, rq, http.StatusBadRequest, err)
+		return
+	}
+	if err := user.LoginHTTP(w, username); err != nil {
+		renderOIDCError(w, rq, http.StatusBadRequest, err)
+		return
+	}
+	http.Redirect(w, rq, cfg.Root, http.StatusSeeOther)
+	slog.Info("Logged in", "username", username, "subject", id.Subject, "method", "oidc")
+}
+
+// syncOIDCUser registers the user if they are new, or updates their group if
+// the provider told their groups, and returns their username. Users are found
+// by their subject, the username claim only names new users: it is not unique
+// and users may change it at the provider.
+func syncOIDCUser(id oidc.Identity) (string, error) {
+	group := id.Group
+	if group == "" {
+		group = cfg.RegistrationGroup
+	}
+	existing := user.ByOIDCSubject(id.Issuer, id.Subject)
+	if existing.IsEmpty() {
+		if id.Username == "" {
+			return "", oidc.ErrUsername
+		}
+		// The provider decides who may log in, so the registration limit
+		// does not apply
+		err := user.RegisterOIDC(id.Username, group, id.Issuer, id.Subject)
+		if err == nil {
+			slog.Info("Registered user", "username", id.Username, "group", group, "method", "oidc")
+		}
+		return id.Username, err
+	}
+	if !id.GroupsKnown || group == existing.GroupName() {
+		return existing.Name(), nil
+	}
+	updated, err := existing.WithGroupName(group)
+	if err == nil {
+		err = user.ReplaceUser(existing, updated)
+	}
+	if err == nil {
+		slog.Info("Updated user group", "username", existing.Name(), "group", group, "method", "oidc")
+	}
+	return existing.Name(), err
+}
+
+func renderOIDCError(w http.ResponseWriter, rq *http.Request, status int, err error) {
+	meta := viewutil.MetaFrom(w, rq)
+	w.WriteHeader(status)
+	_ = pageAuthLogin.RenderTo(meta, map[string]any{
+		"AllowRegistration": cfg.AllowRegistration,
+		"OIDCEnabled":       cfg.OIDCEnabled,
+		"OIDCProviderName":  cfg.OIDCProviderName,
+		"Err":               err.Error(),
+		"ErrOIDC":           true,
+		"Locked":            meta.U.ShowLock(),
+		"WikiName":          cfg.WikiName,
+	})
+}
@@ -10,13 +10,13 @@ import (
 //go:embed views/*.html
 var fs embed.FS
 
-var pageOrphans, pageBacklinks, pageSubhyphae, pageUserList *newtmpl.Page
-var pageUserSettings, pageUserDelete *newtmpl.Page
+var pageOrphans, pageWanted, pageDeleted, pageBacklinks, pageSubhyphae, pageUserList *newtmpl.Page
+var pageUserSettings, pageUserDelete, pageUserTOTP *newtmpl.Page
 var pageHyphaDelete, pageHyphaRevert, pageHyphaEdit, pageHyphaEmpty, pageHypha *newtmpl.Page
 var pageRevision, pageMedia *newtmpl.Page
 var pageAuthLogin, pageAuthRegister *newtmpl.Page
 var pageCatPage, pageCatList, pageCatEdit *newtmpl.Page
-var pageShutdown *newtmpl.Page
+var pageShutdown, pageAdminLinks *newtmpl.Page
 
 var panelChain, newUserChain, editUserChain, deleteUserChain viewutil.Chain
 
@@ -31,6 +31,24 @@ func initPages() {
 		"orphaned hyphae":    "Гифы-сироты",
 		"orphan description": "Ниже перечислены гифы без ссылок на них.",
 	}, "views/orphans.html")
+	pageWanted = newtmpl.NewPage(fs, map[string]string{
+		"wanted hyphae":      "Желаемые гифы",
+		"wanted description": "Ниже перечислены гифы, которые ещё не созданы, но на которые есть ссылки. Сначала идут гифы с наибольшим числом ссылок.",
+		"wanted backlinks":   "{{.BacklinkCount}} ссылк{{if eq .BacklinkCount 1}}а{{else if and (le .BacklinkCount 4) (gt .BacklinkCount 1)}}и{{else}}ок{{end}}",
+		"wanted create":      "создать",
+		"wanted none":        "Все гифы, на которые есть ссылки, созданы.",
+	}, "views/wanted.html")
+	pageDeleted = newtmpl.NewPage(fs, map[string]string{
+		"deleted hyphae":      "Удалённые гифы",
+		"deleted description": "Ниже перечислены гифы, которые были удалены и не созданы заново. Сначала идут гифы, удалённые последними.",
+		"deleted hypha":       "Гифа",
+		"deleted at":          "Удалена",
+		"deleted by":          "Кем",
+		"deleted revision":    "Ревизия",
+		"deleted actions":     "Действия",
+		"undelete":            "Восстановить",
+		"deleted none":        "Удалённых гиф нет.",
+	}, "views/deleted.html")
 	pageBacklinks = newtmpl.NewPage(fs, map[string]string{
 		"backlinks to text": `Обратные ссылки на {{.}}`,
 		"backlinks to link": `Обратные ссылки на <a href="{{.Meta.Root}}hypha/{{.HyphaName}}">{{beautifulName .HyphaName}}</a>`,
@@ -47,6 +65,7 @@ func initPages() {
 		"name":          "Имя",
 		"group":         "Группа",
 		"registered at": "Зарегистрирован",
+		"contributions": "Вклад",
 		"actions":       "Действия",
 		"edit":          "Изменить",
 	}, "views/user-list.html")
@@ -60,7 +79,35 @@ func initPages() {
 		"password":                  "Пароль",
 		"delete user":               "Удалить пользователя",
 		"delete user tip":           "Удаляет пользователя из базы данных. Правки пользователя будут сохранены. Имя пользователя освободится для повторной регистрации.",
+		"two-factor authentication": "Двухфакторная аутентификация",
+		"non local totp":            "Двухфакторную аутентификацию здесь можно включить только местным аккаунтам.",
+		"totp on":                   "Двухфакторная аутентификация включена. Осталось кодов восстановления: {{.}}.",
+		"one-time code":             "Одноразовый код",
+		"new recovery codes":        "Новые коды восстановления",
+		"turn off":                  "Выключить",
+		"totp tip":                  "Спрашивать при входе не только пароль, но и одноразовый код из приложения-аутентификатора.",
+		"set up":                    "Настроить",
+		"passkeys":                  "Ключи доступа",
+		"non local passkeys":        "Ключи доступа здесь можно добавить только местным аккаунтам.",
+		"passkeys tip":              "Входите с ключом доступа, который хранит ваше устройство или менеджер паролей, вместо логина и пароля.",
+		"added on":                  "добавлен {{.Format \"2006-01-02\"}}",
+		"passkey name":              "Название",
+		"add passkey":               "Добавить ключ доступа",
 	}, "views/user-settings.html")
+	pageUserTOTP = newtmpl.NewPage(fs, map[string]string{
+		"two-factor authentication": "Двухфакторная аутентификация",
+		"error":                     "Ошибка",
+		"recovery codes":            "Коды восстановления",
+		"recovery codes tip":        "Двухфакторная аутентификация включена. Сохраните эти коды восстановления в надёжном месте. Если вы потеряете доступ к приложению-аутентификатору, вы сможете войти с одним из них вместо одноразового кода. Каждый код работает один раз. Они показываются только сейчас.",
+		"done":                      "Готово",
+		"totp required":             "Ваша группа должна использовать двухфакторную аутентификацию. Настройте её, чтобы продолжить пользоваться вики.",
+		"set up totp":               "Настройка приложения-аутентификатора",
+		"scan qr tip":               "Отсканируйте QR-код приложением-аутентификатором, например FreeOTP или Aegis, или введите ключ вручную.",
+		"key":                       "Ключ",
+		"current password":          "Текущий пароль",
+		"one-time code":             "Одноразовый код",
+		"turn on":                   "Включить",
+	}, "views/user-totp.html")
 	pageUserDelete = newtmpl.NewPage(fs, map[string]string{
 		"delete user?":        "Удалить пользователя?",
 		"delete user warning": "Вы уверены, что хотите удалиться из базы данных? Это действие нельзя отменить.",
@@ -120,9 +167,11 @@ func initPages() {
 		"user settings": "Настройки",
 		"subhyphae":     "Подгифы",
 		"history":       "История",
+		"contributions": "Вклад",
 		"rename":        "Переименовать",
 		"delete":        "Удалить",
 		"view markup":   "Посмотреть разметку",
+		"blame":         "Авторство",
 		"manage media":  "Медиа",
 		"turn to media": "Превратить в медиа-гифу",
 		"backlinks":     "{{.BacklinkCount}} обратн{{if eq .BacklinkCount 1}}ая ссылка{{else if and (le .BacklinkCount 4) (gt .BacklinkCount 1)}}ые ссылки{{else}}ых ссылок{{end}}",
@@ -130,6 +179,7 @@ func initPages() {
 
 		"empty heading":                    `Эта гифа не существует`,
 		"empty no rights":                  `У вас нет прав для создания новых гиф. Вы можете:`,
+		"empty no rights proxy":            `У вас нет прав для создания новых гиф.`,
 		"empty log in":                     `Войти в свою учётную запись, если она у вас есть`,
 		"empty register":                   `Создать новую учётную запись`,
 		"write a text":                     `Написать текст`,
@@ -164,19 +214,25 @@ func initPages() {
 	}, "views/hypha-media.html")
 
 	pageAuthLogin = newtmpl.NewPage(fs, map[string]string{
-		"username":       "Логин",
-		"password":       "Пароль",
-		"log in":         "Войти",
-		"log out":        "Выйти",
-		"approval tip":   "Новые пользователи должны быть одобрены администратором, прежде чем они смогут получить доступ к вики.",
-		"cookie tip":     "Отправляя эту форму, вы разрешаете вики хранить cookie в вашем браузере. Это позволит движку связывать ваши правки с вашей учётной записью. Вы будете авторизованы, пока не выйдете из учётной записи.",
-		"log in to x":    "Войти в {{.}}",
-		"lock title":     "Доступ закрыт",
-		"error":          "Ошибка",
-		"error login":    "Неправильное имя пользователя или пароль.",
-		"error telegram": "Не удалось войти через Телеграм.",
-		"register":       "Регистрация",
-	}, "views/auth-base.html", "views/auth-telegram.html", "views/auth-login.html")
+		"username":            "Логин",
+		"password":            "Пароль",
+		"log in":              "Войти",
+		"log out":             "Выйти",
+		"approval tip":        "Новые пользователи должны быть одобрены администратором, прежде чем они смогут получить доступ к вики.",
+		"cookie tip":          "Отправляя эту форму, вы разрешаете вики хранить cookie в вашем браузере. Это позволит движку связывать ваши правки с вашей учётной записью. Вы будете авторизованы, пока не выйдете из учётной записи.",
+		"log in to x":         "Войти в {{.}}",
+		"lock title":          "Доступ закрыт",
+		"error":               "Ошибка",
+		"error login":         "Неправильное имя пользователя или пароль.",
+		"error telegram":      "Не удалось войти через Телеграм.",
+		"error oidc":          "Не удалось войти через {{.}}.",
+		"log in with x":       "Войти через {{.}}",
+		"one-time code":       "Одноразовый код",
+		"totp tip":            "Введите код из приложения-аутентификатора. Если у вас нет доступа к нему, введите один из кодов восстановления.",
+		"register":            "Регистрация",
+		"error passkey":       "Не удалось войти с ключом доступа.",
+		"log in with passkey": "Войти с ключом доступа",
+	}, "views/auth-base.html", "views/auth-telegram.html", "views/auth-oidc.html", "views/auth-passkey.html", "views/auth-login.html")
 
 	pageAuthRegister = newtmpl.NewPage(fs, map[string]string{
 		"username":      "Логин",
@@ -187,7 +243,8 @@ func initPages() {
 		"error":         "Ошибка",
 		"register btn":  "Зарегистрироваться",
 		"register on x": "Регистрация на {{.}}",
-	}, "views/auth-base.html", "views/auth-telegram.html", "views/auth-register.html")
+		"log in with x": "Войти через {{.}}",
+	}, "views/auth-base.html", "views/auth-telegram.html", "views/auth-oidc.html", "views/auth-register.html")
 
 	pageCatPage = newtmpl.NewPage(fs, map[string]string{
 		"category x": "Категория {{. | beautifulName}}",
@@ -219,4 +276,13 @@ func initPages() {
 		"shutting down":         "Выключение {{template `wiki name`}}",
 		"shutting down message": "{{template `wiki name`}} сейчас выключится.",
 	}, "views/admin-shutdown.html")
+	pageAdminLinks = newtmpl.NewPage(fs, map[string]string{
+		"broken links":                     "Битые ссылки",
+		"broken links description":         "Ниже перечислены ссылки на несуществующие гифы, трансклюзии таких гиф и интервики-ссылки с неизвестными префиксами.",
+		"broken link missing hypha":        "ссылка на",
+		"broken link missing transclusion": "трансклюзия",
+		"broken link unknown interwiki":    "неизвестный интервики-префикс",
+		"broken links none":                "Битых ссылок нет.",
+		"broken links back":                "Назад к панели администратора",
+	}, "views/admin-links.html")
 }
@@ -0,0 +1,120 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/bouncepaw/mycorrhiza/internal/cfg"
+	"github.com/bouncepaw/mycorrhiza/internal/user"
+	"github.com/bouncepaw/mycorrhiza/util"
+	"github.com/bouncepaw/mycorrhiza/web/viewutil"
+)
+
+// Passkeys are created and used by static/passkey.js. It asks for the
+// options here, passes them to the browser and submits the browser's answer
+// with a usual form.
+
+// handlerPasskeyLoginOptions starts a passkey login.
+func handlerPasskeyLoginOptions(w http.ResponseWriter, rq *http.Request) {
+	opts, err := user.PasskeyRequestOptions()
+	writePasskeyOptions(w, opts, err)
+}
+
+// handlerPasskeyLogin logs the owner of the passkey in.
+func handlerPasskeyLogin(w http.ResponseWriter, rq *http.Request) {
+	username, err := user.LoginPasskeyHTTP(
+		w,
+		rq.PostFormValue("id"),
+		rq.PostFormValue("client_data"),
+		rq.PostFormValue("authenticator_data"),
+		rq.PostFormValue("signature"),
+	)
+	if err != nil {
+		meta := viewutil.MetaFrom(w, rq)
+		_ = pageAuthLogin.RenderTo(meta, map[string]any{
+			"AllowRegistration": cfg.AllowRegistration,
+			"OIDCEnabled":       cfg.OIDCEnabled,
+			"OIDCProviderName":  cfg.OIDCProviderName,
+			"Err":               err.Error(),
+			"ErrPasskey":        true,
+			"Locked":            meta.U.ShowLock(),
+			"WikiName":          cfg.WikiName,
+		})
+		slog.Info("Failed to log in", "username", username, "err", err.Error(), "method", "passkey")
+		return
+	}
+	http.Redirect(w, rq, cfg.Root, http.StatusSeeOther)
+	slog.Info("Logged in", "username", username, "method", "passkey")
+}
+
+// handlerPasskeyOptions starts adding a passkey.
+func handlerPasskeyOptions(w http.ResponseWriter, rq *http.Request) {
+	opts, err := user.PasskeyCreationOptions(user.FromRequest(rq))
+	writePasskeyOptions(w, opts, err)
+}
+
+func handlerPasskeyAdd(w http.ResponseWriter, rq *http.Request) {
+	meta := viewutil.MetaFrom(w, rq)
+	f := util.FormDataFromRequest(rq, []string{"name", "current_password", "client_data", "attestation_object"})
+
+	var u *user.User
+	err := error(nil)
+	if !meta.U.IsCorrectPassword(f.Get("current_password")) {
+		err = fmt.Errorf("incorrect password")
+	} else if u, err = meta.U.WithPasskey(f.Get("name"), f.Get("client_data"), f.Get("attestation_object")); err == nil {
+		err = user.ReplaceUser(meta.U, u)
+	}
+	if err == nil {
+		slog.Info("Added passkey", "username", u.Name())
+		http.Redirect(w, rq, cfg.Root + "settings", http.StatusSeeOther)
+		return
+	}
+
+	slog.Info("Failed to add passkey", "username", meta.U.Name(), "err", err)
+	w.WriteHeader(http.StatusBadRequest)
+	_ = pageUserSettings.RenderTo(meta, map[string]any{
+		"Form": f.WithError(err),
+		"ReturnTo": cfg.Root + "hypha/" + cfg.UserHypha + "/" + meta.U.Name(),
+	})
+}
+
+func handlerPasskeyDelete(w http.ResponseWriter, rq *http.Request) {
+	meta := viewutil.MetaFrom(w, rq)
+
+	var u *user.User
+	err := error(nil)
+	if !meta.U.IsCorrectPassword(rq.PostFormValue("current_password")) {
+		err = fmt.Errorf("incorrect password")
+	} else if u, err = meta.U.WithoutPasskey(rq.PostFormValue("id")); err == nil {
+		err = user.ReplaceUser(meta.U, u)
+	}
+	if err == nil {
+		slog.Info("Deleted passkey", "username", u.Name())
+		http.Redirect(w, rq, cfg.Root + "settings", http.StatusSeeOther)
+		return
+	}
+
+	slog.Info("Failed to delete passkey", "username", meta.U.Name(), "err", err)
+	w.WriteHeader(http.StatusBadRequest)
+	_ = pageUserSettings.RenderTo(meta, map[string]any{
+		"Form": util.NewFormData().WithError(err),
+		"ReturnTo": cfg.Root + "hypha/" + cfg.UserHypha + "/" + meta.U.Name(),
+	})
+}
+
+// writePasskeyOptions writes the options in the form the browser expects
+// them, or the error.
+func writePasskeyOptions(w http.ResponseWriter, opts map[string]any, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	var v any = map[string]any{"publicKey": opts}
+	if err != nil {
+		slog.Info("Failed to make passkey options", "err", err)
+		w.WriteHeader(http.StatusBadRequest)
+		v = map[string]string{"error": err.Error()}
+	}
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("Failed to write JSON", "err", err)
+	}
+}
@@ -15,6 +15,7 @@ import (
 	"time"
 
 	"github.com/bouncepaw/mycorrhiza/history"
+	"github.com/bouncepaw/mycorrhiza/history/histweb"
 	"github.com/bouncepaw/mycorrhiza/hypview"
 	"github.com/bouncepaw/mycorrhiza/internal/categories"
 	"github.com/bouncepaw/mycorrhiza/internal/cfg"
@@ -46,6 +47,8 @@ func initReaders(r *mux.Router) {
 	// Backlinks
 	r.PathPrefix("/backlinks/").HandlerFunc(handlerBacklinks).Methods("GET")
 	r.PathPrefix("/orphans").HandlerFunc(handlerOrphans).Methods("GET")
+	r.PathPrefix("/wanted").HandlerFunc(handlerWanted).Methods("GET")
+	r.PathPrefix("/deleted").HandlerFunc(handlerDeleted).Methods("GET")
 	r.PathPrefix("/subhyphae/").HandlerFunc(handlerSubhyphae).Methods("GET")
 }
 
@@ -338,11 +341,16 @@ func handlerHypha(w http.ResponseWriter, rq *http.Request) {
 		"IsMediaHypha":            false,
 		"HasText":                 h.HasTextFile(),
 		"HasSubhyphae":            hasSubhyphae,
+		"ProfileUsername":         "",
+	}
+	if util.IsProfileName(h.CanonicalName()) {
+		data["ProfileUsername"] = strings.TrimPrefix(h.CanonicalName(), cfg.UserHypha + "/")
 	}
 	slog.Info("reading hypha", "name", h.CanonicalName(), "can edit", data["GivenPermissionToModify"])
 	meta.BodyAttributes = map[string]string{
 		"cats": category_list,
 	}
+	meta.HeadElements = append(meta.HeadElements, hyphaFeedLinks(h.CanonicalName(), hasSubhyphae)...)
 
 	switch h := h.(type) {
 	case *hyphae.EmptyHypha:
@@ -380,6 +388,24 @@ func handlerHypha(w http.ResponseWriter, rq *http.Request) {
 	_ = pageHypha.RenderTo(meta, data)
 }
 
+// hyphaFeedLinks returns the links to the feeds of the hypha history and,
+// for user hyphae, of the user contributions.
+func hyphaFeedLinks(hyphaName string, hasSubhyphae bool) []template.HTML {
+	beautifulName := util.BeautifulName(hyphaName)
+	links := histweb.FeedLinks("history", hyphaName, "History of " + beautifulName, nil)
+	if hasSubhyphae {
+		links = append(links, histweb.FeedLinks(
+			"history", hyphaName, "History of " + beautifulName + " and its subhyphae",
+			url.Values{"subhyphae": {"1"}},
+		)...)
+	}
+	if util.IsProfileName(hyphaName) {
+		username := strings.TrimPrefix(hyphaName, cfg.UserHypha + "/")
+		links = append(links, histweb.FeedLinks("contributions", username, "Contributions of " + username, nil)...)
+	}
+	return links
+}
+
 // handlerBacklinks lists all backlinks to a hypha.
 func handlerBacklinks(w http.ResponseWriter, rq *http.Request) {
 	hyphaName := util.HyphaNameFromRq(rq, "backlinks")
@@ -404,6 +430,29 @@ func handlerSubhyphae(w http.ResponseWriter, rq *http.Request) {
 		})
 }
 
+// handlerDeleted lists hyphae that were deleted and do not exist now.
+func handlerDeleted(w http.ResponseWriter, rq *http.Request) {
+	meta := viewutil.MetaFrom(w, rq)
+	deletions, err := history.Deletions()
+	if err != nil {
+		viewutil.HttpErr(meta, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+	var deleted []history.Deletion
+	for _, deletion := range deletions {
+		if _, empty := hyphae.ByName(deletion.HyphaName).(*hyphae.EmptyHypha); empty {
+			deleted = append(deleted, deletion)
+		}
+	}
+	_ = pageDeleted.RenderTo(meta,
+		map[string]any{
+			"Addr":        cfg.Root + "deleted",
+			"Deletions":   deleted,
+			"CanUndelete": meta.U.CanProceed("undelete"),
+			"UserHypha":   cfg.UserHypha,
+		})
+}
+
 func handlerOrphans(w http.ResponseWriter, rq *http.Request) {
 	_ = pageOrphans.RenderTo(viewutil.MetaFrom(w, rq),
 		map[string]any{
@@ -411,3 +460,14 @@ func handlerOrphans(w http.ResponseWriter, rq *http.Request) {
 			"Orphans": hyphae.Orphans(),
 		})
 }
+
+// handlerWanted lists hyphae that do not exist but are linked to.
+func handlerWanted(w http.ResponseWriter, rq *http.Request) {
+	meta := viewutil.MetaFrom(w, rq)
+	_ = pageWanted.RenderTo(meta,
+		map[string]any{
+			"Addr":      cfg.Root + "wanted",
+			"Wanted":    hyphae.Wanted(),
+			"CanCreate": meta.U.CanProceed("edit"),
+		})
+}
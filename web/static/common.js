@@ -26,4 +26,42 @@ const rrh = {
         }
         return this.l10nMap[text] || text
     },
+
+    // complete fetches hypha names starting with or resembling the query.
+    async complete(query, limit = 10) {
+        const params = new URLSearchParams({ q: query, limit })
+        const response = await fetch(`${this.root}api/complete?${params}`)
+        if (!response.ok) return []
+        return response.json()
+    },
+
+    debounce(fn, delay = 200) {
+        let timer
+        return (...args) => {
+            clearTimeout(timer)
+            timer = setTimeout(() => fn(...args), delay)
+        }
+    },
 }
+
+// Suggest hypha names in the top bar search
+;(() => {
+    const input = $('.top-bar__search-bar')
+    const list = $('#top-bar__suggestions')
+    if (!input || !list) return
+    let latest = ''
+    input.addEventListener('input', rrh.debounce(async () => {
+        const query = latest = input.value.trim()
+        if (query === '') {
+            list.replaceChildren()
+            return
+        }
+        const completions = await rrh.complete(query).catch(() => [])
+        if (query !== latest) return
+        list.replaceChildren(...completions.map(c => {
+            const option = document.createElement('option')
+            option.value = c.display
+            return option
+        }))
+    }))
+})()
@@ -17,3 +17,122 @@ form.addEventListener('submit', function () {
 });
 
 window.addEventListener('beforeunload', warnBeforeClosing);
+
+// Hypha name completion for links and transclusions
+const completion = {
+    list: document.createElement('ul'),
+    items: [],
+    selected: 0,
+    start: -1,
+    latest: '',
+    accepted: null,
+
+    // context finds the hypha name being typed before the cursor, if any.
+    context() {
+        const pos = textarea.selectionStart
+        if (pos !== textarea.selectionEnd) return null
+        const before = textarea.value.slice(0, pos)
+        const line = before.slice(before.lastIndexOf('\n') + 1)
+        let match = line.match(/\[\[([^\]|]*)$/)
+            || line.match(/^\s*<=\s*([^|]*)$/)
+            || line.match(/^\s*=>\s*([^|\s]*)$/)
+        if (!match || match[1].trim() === '') return null
+        const query = match[1].trimStart()
+        return { query: query, start: pos - query.length }
+    },
+
+    open(items, start) {
+        this.items = items
+        this.start = start
+        this.selected = 0
+        this.list.replaceChildren(...items.map((item, i) => {
+            const li = document.createElement('li')
+            li.className = 'edit-completion__item'
+            li.textContent = item.display
+            li.addEventListener('mousedown', ev => {
+                ev.preventDefault()
+                this.accept(i)
+            })
+            return li
+        }))
+        this.list.hidden = items.length === 0
+        this.highlight()
+    },
+
+    close() {
+        this.items = []
+        this.list.hidden = true
+    },
+
+    isOpen() {
+        return !this.list.hidden
+    },
+
+    highlight() {
+        Array.from(this.list.children).forEach((li, i) => {
+            li.classList.toggle('edit-completion__item_selected', i === this.selected)
+        })
+    },
+
+    move(delta) {
+        const n = this.items.length
+        this.selected = (this.selected + delta + n) % n
+        this.highlight()
+    },
+
+    accept(i = this.selected) {
+        const item = this.items[i]
+        const pos = textarea.selectionStart
+        const line = textarea.value.slice(0, this.start)
+        let text = item.name
+        if (/\[\[[^\]|]*$/.test(line) && !textarea.value.startsWith(']]', pos)) {
+            text += ']]'
+        }
+        textarea.setRangeText(text, this.start, pos, 'end')
+        textarea.focus()
+        window.hyphaChanged = true
+        this.accepted = item.name
+        this.close()
+    },
+
+    update: rrh.debounce(async () => {
+        const ctx = completion.context()
+        if (!ctx || ctx.query === completion.accepted) {
+            completion.latest = ''
+            completion.close()
+            return
+        }
+        const query = completion.latest = ctx.query
+        const items = await rrh.complete(query).catch(() => [])
+        if (query !== completion.latest) return
+        completion.open(items, ctx.start)
+    }),
+}
+
+completion.list.className = 'edit-completion'
+completion.list.hidden = true
+textarea.after(completion.list)
+
+textarea.addEventListener('input', completion.update)
+textarea.addEventListener('blur', () => completion.close())
+textarea.addEventListener('keydown', ev => {
+    if (!completion.isOpen()) return
+    switch (ev.key) {
+        case 'ArrowDown':
+            completion.move(1)
+            break
+        case 'ArrowUp':
+            completion.move(-1)
+            break
+        case 'Enter':
+        case 'Tab':
+            completion.accept()
+            break
+        case 'Escape':
+            completion.close()
+            break
+        default:
+            return
+    }
+    ev.preventDefault()
+})
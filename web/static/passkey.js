@@ -0,0 +1,62 @@
+// Passkey login and creation. The options are asked from the wiki, passed to
+// the browser, and the browser's answer is submitted with the form. Binary
+// values are base64url-encoded both ways.
+;(() => {
+    const decode = s => Uint8Array.from(
+        atob(s.replace(/-/g, '+').replace(/_/g, '/')),
+        c => c.charCodeAt(0),
+    )
+    const encode = buf => btoa(String.fromCharCode(...new Uint8Array(buf)))
+        .replace(/\+/g, '-')
+        .replace(/\//g, '_')
+        .replace(/=+$/, '')
+
+    async function fetchOptions(form) {
+        const response = await fetch(form.dataset.options, {
+            method: 'POST',
+            body: new FormData(),
+        })
+        const json = await response.json()
+        if (!response.ok) throw new Error(json.error)
+        return json.publicKey
+    }
+
+    function handle(form, ceremony) {
+        if (!form) return
+        if (!window.PublicKeyCredential) {
+            form.hidden = true
+            return
+        }
+        const error = form.querySelector('.passkey-error')
+        form.addEventListener('submit', async event => {
+            event.preventDefault()
+            error.hidden = true
+            try {
+                const publicKey = await fetchOptions(form)
+                await ceremony(form.elements, publicKey)
+                form.submit()
+            } catch (err) {
+                error.textContent = err.message
+                error.hidden = false
+            }
+        })
+    }
+
+    handle(document.getElementById('passkey-login-form'), async (fields, publicKey) => {
+        publicKey.challenge = decode(publicKey.challenge)
+        const credential = await navigator.credentials.get({ publicKey })
+        fields.id.value = credential.id
+        fields.client_data.value = encode(credential.response.clientDataJSON)
+        fields.authenticator_data.value = encode(credential.response.authenticatorData)
+        fields.signature.value = encode(credential.response.signature)
+    })
+
+    handle(document.getElementById('passkey-add-form'), async (fields, publicKey) => {
+        publicKey.challenge = decode(publicKey.challenge)
+        publicKey.user.id = decode(publicKey.user.id)
+        publicKey.excludeCredentials.forEach(c => c.id = decode(c.id))
+        const credential = await navigator.credentials.create({ publicKey })
+        fields.client_data.value = encode(credential.response.clientDataJSON)
+        fields.attestation_object.value = encode(credential.response.attestationObject)
+    })
+})()
@@ -1,7 +1,9 @@
 package web
 
 import (
+	"encoding/base64"
 	"fmt"
+	"html/template"
 	"log/slog"
 	"net/http"
 	"slices"
@@ -10,6 +12,8 @@ import (
 	"github.com/bouncepaw/mycorrhiza/internal/user"
 	"github.com/bouncepaw/mycorrhiza/util"
 	"github.com/bouncepaw/mycorrhiza/web/viewutil"
+
+	"rsc.io/qr"
 )
 
 func handlerUserList(w http.ResponseWriter, rq *http.Request) {
@@ -101,3 +105,121 @@ func handlerUserChangePassword(w http.ResponseWriter, rq *http.Request) {
 		"ReturnTo": cfg.Root + "hypha/" + cfg.UserHypha + "/" + meta.U.Name(),
 	})
 }
+
+func handlerUserTOTP(w http.ResponseWriter, rq *http.Request) {
+	meta := viewutil.MetaFrom(w, rq)
+	if !meta.U.IsLocal() || meta.U.HasTOTP() {
+		http.Redirect(w, rq, cfg.Root + "settings", http.StatusSeeOther)
+		return
+	}
+	f := util.FormDataFromRequest(rq, []string{"secret", "current_password", "code"})
+	secret := f.Get("secret")
+
+	if rq.Method == http.MethodPost {
+		err := error(nil)
+		if !meta.U.IsCorrectPassword(f.Get("current_password")) {
+			err = fmt.Errorf("incorrect password")
+		} else if !user.CheckTOTPSecret(secret, f.Get("code")) {
+			err = user.ErrTOTP
+		} else {
+			var (
+				u     *user.User
+				codes []string
+			)
+			u, codes, err = meta.U.WithTOTP(secret)
+			if err == nil {
+				err = user.ReplaceUser(meta.U, u)
+			}
+			if err == nil {
+				slog.Info("Turned on two-factor authentication", "username", u.Name())
+				_ = pageUserTOTP.RenderTo(meta, map[string]any{
+					"RecoveryCodes": codes,
+				})
+				return
+			}
+		}
+		f = f.WithError(err)
+		w.WriteHeader(http.StatusBadRequest)
+	} else {
+		secret = user.NewTOTPSecret()
+	}
+
+	uri := user.TOTPURI(meta.U.Name(), secret)
+	code, err := qr.Encode(uri, qr.M)
+	if err != nil {
+		slog.Error("Failed to make QR code", "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	_ = pageUserTOTP.RenderTo(meta, map[string]any{
+		"Form":   f,
+		"Secret": secret,
+		"URI":    template.URL(uri),
+		"QR":     template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(code.PNG())),
+	})
+}
+
+func handlerUserTOTPDisable(w http.ResponseWriter, rq *http.Request) {
+	meta := viewutil.MetaFrom(w, rq)
+	f := util.FormDataFromRequest(rq, []string{"current_password", "code"})
+
+	err := checkTOTPForm(meta.U, f)
+	if err == nil && meta.U.TOTPRequired() {
+		err = user.ErrTOTPRequired
+	}
+	if err == nil {
+		err = user.ReplaceUser(meta.U, meta.U.WithoutTOTP())
+	}
+	if err == nil {
+		slog.Info("Turned off two-factor authentication", "username", meta.U.Name())
+		http.Redirect(w, rq, cfg.Root + "settings", http.StatusSeeOther)
+		return
+	}
+
+	w.WriteHeader(http.StatusBadRequest)
+	_ = pageUserSettings.RenderTo(meta, map[string]any{
+		"Form": f.WithError(err),
+		"ReturnTo": cfg.Root + "hypha/" + cfg.UserHypha + "/" + meta.U.Name(),
+	})
+}
+
+func handlerUserRecoveryCodes(w http.ResponseWriter, rq *http.Request) {
+	meta := viewutil.MetaFrom(w, rq)
+	f := util.FormDataFromRequest(rq, []string{"current_password", "code"})
+
+	err := checkTOTPForm(meta.U, f)
+	if err == nil {
+		var (
+			u     *user.User
+			codes []string
+		)
+		u, codes, err = meta.U.WithNewRecoveryCodes()
+		if err == nil {
+			err = user.ReplaceUser(meta.U, u)
+		}
+		if err == nil {
+			_ = pageUserTOTP.RenderTo(meta, map[string]any{
+				"RecoveryCodes": codes,
+			})
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusBadRequest)
+	_ = pageUserSettings.RenderTo(meta, map[string]any{
+		"Form": f.WithError(err),
+		"ReturnTo": cfg.Root + "hypha/" + cfg.UserHypha + "/" + meta.U.Name(),
+	})
+}
+
+// checkTOTPForm checks the password and the one-time code the user entered to
+// change their two-factor authentication.
+func checkTOTPForm(u *user.User, f util.FormData) error {
+	switch {
+	case !u.HasTOTP():
+		return user.ErrTOTPNotConfigured
+	case !u.IsCorrectPassword(f.Get("current_password")):
+		return fmt.Errorf("incorrect password")
+	}
+	return user.CheckSecondFactor(u, f.Get("code"))
+}
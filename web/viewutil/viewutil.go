@@ -51,9 +51,11 @@ func Init() {
 <ul class="top-bar__auth auth-links">
 	<li class="auth-links__box auth-links__user-box">
 		{{if .Meta.U.IsEmpty }}
+			{{block "login link" .}}
 			<a href="{{ .Meta.Root }}login" class="auth-links__link auth-links__login-link">
 				{{block "login" .}}Login{{end}}
 			</a>
+			{{end}}
 		{{else}}
 			<a href="{{ .Meta.Root }}hypha/{{block "user hypha" .}}{{end}}/{{.Meta.U.Name}}" class="auth-links__link auth-links__user-link">
 				{{beautifulName .Meta.U.Name}}
@@ -65,7 +67,11 @@ func Init() {
 {{end}}
 `))
 	}
-	if cfg.AllowRegistration {
+	if cfg.ProxyAuthEnabled {
+		// The proxy logs users in, there is no login page
+		m(BaseEn.Parse(`{{define "login link"}}{{end}}`))
+	}
+	if cfg.AllowRegistration && !cfg.ProxyAuthEnabled {
 		m(BaseEn.Parse(`{{define "registration"}}
 {{if .Meta.U.IsEmpty}}
 	 <li class="auth-links__box auth-links__register-box">
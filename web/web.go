@@ -42,13 +42,22 @@ func Handler() *mux.Router {
 	r.Use(authMiddleware)
 	// Auth
 	// The check below saves a lot of extra checks and lines of codes in other places in this file.
-	if cfg.UseAuth {
+	// The proxy logs users in and out itself if there is one.
+	if cfg.UseAuth && !cfg.ProxyAuthEnabled {
 		if cfg.AllowRegistration {
 			r.HandleFunc("/register", handlerRegister).Methods(http.MethodPost, http.MethodGet)
 		}
 		if cfg.TelegramEnabled {
 			r.HandleFunc("/telegram-login", handlerTelegramLogin).Methods(http.MethodPost, http.MethodGet)
 		}
+		if cfg.OIDCEnabled {
+			r.HandleFunc("/oidc-login", handlerOIDCLogin).Methods(http.MethodGet)
+			r.HandleFunc("/oidc-callback", handlerOIDCCallback).Methods(http.MethodGet)
+		}
+		if cfg.PasskeysEnabled {
+			r.HandleFunc("/passkey-login/options", handlerPasskeyLoginOptions).Methods(http.MethodPost)
+			r.HandleFunc("/passkey-login", handlerPasskeyLogin).Methods(http.MethodPost)
+		}
 		r.HandleFunc("/login", handlerLogin).Methods(http.MethodPost, http.MethodGet)
 		r.HandleFunc("/logout", handlerLogout).Methods(http.MethodPost)
 	}
@@ -81,11 +90,13 @@ func Handler() *mux.Router {
 		adminRouter.HandleFunc("/reindex-users", handlerAdminReindexUsers).Methods(http.MethodPost)
 		adminRouter.HandleFunc("/reindex-hyphae", handlerAdminReindexHyphae).Methods(http.MethodPost)
 		adminRouter.HandleFunc("/update-header-links", handlerAdminUpdateHeaderLinks).Methods(http.MethodPost)
+		adminRouter.HandleFunc("/links", handlerAdminLinks).Methods(http.MethodGet)
 
 		adminRouter.HandleFunc("/new-user", handlerAdminUserNew).Methods(http.MethodGet, http.MethodPost)
 		adminRouter.HandleFunc("/users/{username}/edit", handlerAdminUserEdit).Methods(http.MethodGet, http.MethodPost)
 		adminRouter.HandleFunc("/users/{username}/change-password", handlerAdminUserChangePassword).Methods(http.MethodPost)
 		adminRouter.HandleFunc("/users/{username}/delete", handlerAdminUserDelete).Methods(http.MethodGet, http.MethodPost)
+		adminRouter.HandleFunc("/users/{username}/reset-totp", handlerAdminUserResetTOTP).Methods(http.MethodPost)
 
 		adminRouter.HandleFunc("/", handlerAdmin).Methods("GET")
 
@@ -95,6 +106,14 @@ func Handler() *mux.Router {
 		}
 		settingsRouter.HandleFunc("/change-password", handlerUserChangePassword).Methods(http.MethodPost)
 		settingsRouter.HandleFunc("/delete", handlerUserDelete).Methods(http.MethodGet, http.MethodPost)
+		settingsRouter.HandleFunc("/totp", handlerUserTOTP).Methods(http.MethodGet, http.MethodPost)
+		settingsRouter.HandleFunc("/totp/disable", handlerUserTOTPDisable).Methods(http.MethodPost)
+		settingsRouter.HandleFunc("/totp/recovery-codes", handlerUserRecoveryCodes).Methods(http.MethodPost)
+		if cfg.PasskeysEnabled {
+			settingsRouter.HandleFunc("/passkeys/options", handlerPasskeyOptions).Methods(http.MethodPost)
+			settingsRouter.HandleFunc("/passkeys/add", handlerPasskeyAdd).Methods(http.MethodPost)
+			settingsRouter.HandleFunc("/passkeys/delete", handlerPasskeyDelete).Methods(http.MethodPost)
+		}
 		settingsRouter.HandleFunc("/", handlerUserSettings).Methods(http.MethodGet)
 	}
 
@@ -123,6 +142,8 @@ func handlerRegister(w http.ResponseWriter, rq *http.Request) {
 		_ = pageAuthRegister.RenderTo(viewutil.MetaFrom(w, rq), map[string]any{
 			"RawQuery":             rq.URL.RawQuery,
 			"RegisterAnonOnLocked": registerAnonOnLocked,
+			"OIDCEnabled":          cfg.OIDCEnabled,
+			"OIDCProviderName":     cfg.OIDCProviderName,
 		})
 		return
 	}
@@ -140,6 +161,8 @@ func handlerRegister(w http.ResponseWriter, rq *http.Request) {
 			"Username":             username,
 			"Password":             password,
 			"RegisterAnonOnLocked": registerAnonOnLocked,
+			"OIDCEnabled":          cfg.OIDCEnabled,
+			"OIDCProviderName":     cfg.OIDCProviderName,
 		})
 		return
 	}
@@ -173,20 +196,57 @@ func handlerLogin(w http.ResponseWriter, rq *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		_ = pageAuthLogin.RenderTo(meta, map[string]any{
 			"AllowRegistration": cfg.AllowRegistration,
+			"OIDCEnabled":       cfg.OIDCEnabled,
+			"OIDCProviderName":  cfg.OIDCProviderName,
 			"Locked":            locked,
 			"WikiName":          cfg.WikiName,
 		})
 		return
 	}
 
+	if rq.PostFormValue("step") == "totp" {
+		username, err := user.LoginTOTPHTTP(w, rq, rq.PostFormValue("code"))
+		if err != nil {
+			_ = pageAuthLogin.RenderTo(meta, map[string]any{
+				"AllowRegistration": cfg.AllowRegistration,
+				"OIDCEnabled":       cfg.OIDCEnabled,
+				"OIDCProviderName":  cfg.OIDCProviderName,
+				"TOTP":              !errors.Is(err, user.ErrTOTPLoginExpired),
+				"Err":               err.Error(),
+				"Locked":            locked,
+				"WikiName":          cfg.WikiName,
+				"Username":          username,
+			})
+			slog.Info("Failed to log in", "username", username, "err", err.Error(), "method", "totp")
+			return
+		}
+		http.Redirect(w, rq, cfg.Root, http.StatusSeeOther)
+		slog.Info("Logged in", "username", username, "method", "totp")
+		return
+	}
+
 	var (
 		username = util.CanonicalName(rq.PostFormValue("username"))
 		password = rq.PostFormValue("password")
 		err      = user.LoginDataHTTP(w, username, password)
 	)
+	if errors.Is(err, user.ErrTOTPNeeded) {
+		_ = pageAuthLogin.RenderTo(meta, map[string]any{
+			"AllowRegistration": cfg.AllowRegistration,
+			"OIDCEnabled":       cfg.OIDCEnabled,
+			"OIDCProviderName":  cfg.OIDCProviderName,
+			"TOTP":              true,
+			"Locked":            locked,
+			"WikiName":          cfg.WikiName,
+			"Username":          username,
+		})
+		return
+	}
 	if err != nil {
 		_ = pageAuthLogin.RenderTo(meta, map[string]any{
 			"AllowRegistration": cfg.AllowRegistration,
+			"OIDCEnabled":       cfg.OIDCEnabled,
+			"OIDCProviderName":  cfg.OIDCProviderName,
 			"ErrLogin":    errors.Is(err, user.ErrLogin),
 			"ErrTelegram": false, // TODO: ?
 			"Err":         err.Error(),